@@ -0,0 +1,144 @@
+package ecspresso
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwTypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/samber/lo"
+)
+
+var alarmCheckInterval = 10 * time.Second
+
+// ConfigAlarms represents CloudWatch alarms watched while waiting for the service stable.
+type ConfigAlarms struct {
+	Names    []string  `yaml:"names,omitempty" json:"names,omitempty"`
+	Prefixes []string  `yaml:"prefixes,omitempty" json:"prefixes,omitempty"`
+	BakeTime *Duration `yaml:"bake_time,omitempty" json:"bake_time,omitempty"`
+	Rollback bool      `yaml:"rollback,omitempty" json:"rollback,omitempty"`
+}
+
+func (c *ConfigAlarms) validate() error {
+	if len(c.Names) == 0 && len(c.Prefixes) == 0 {
+		return errors.New("alarms.names or alarms.prefixes is required")
+	}
+	return nil
+}
+
+func (c *ConfigAlarms) bakeTime() time.Duration {
+	if c == nil || c.BakeTime == nil {
+		return 0
+	}
+	return c.BakeTime.Duration
+}
+
+func (c *ConfigAlarms) describeAlarmsInputs() []*cloudwatch.DescribeAlarmsInput {
+	alarmTypes := []cwTypes.AlarmType{cwTypes.AlarmTypeMetricAlarm, cwTypes.AlarmTypeCompositeAlarm}
+	var ins []*cloudwatch.DescribeAlarmsInput
+	// DescribeAlarms accepts alarm names up to 100
+	for _, names := range lo.Chunk(c.Names, 100) {
+		ins = append(ins, &cloudwatch.DescribeAlarmsInput{
+			AlarmNames: names,
+			AlarmTypes: alarmTypes,
+			StateValue: cwTypes.StateValueAlarm,
+		})
+	}
+	for _, prefix := range c.Prefixes {
+		ins = append(ins, &cloudwatch.DescribeAlarmsInput{
+			AlarmNamePrefix: aws.String(prefix),
+			AlarmTypes:      alarmTypes,
+			StateValue:      cwTypes.StateValueAlarm,
+		})
+	}
+	return ins
+}
+
+// firingAlarms returns the names of the alarms in ALARM state.
+func (d *App) firingAlarms(ctx context.Context) ([]string, error) {
+	var names []string
+	for _, in := range d.config.Alarms.describeAlarmsInputs() {
+		pager := cloudwatch.NewDescribeAlarmsPaginator(d.cw, in)
+		for pager.HasMorePages() {
+			out, err := pager.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to describe alarms: %w", err)
+			}
+			for _, a := range out.MetricAlarms {
+				names = append(names, aws.ToString(a.AlarmName))
+			}
+			for _, a := range out.CompositeAlarms {
+				names = append(names, aws.ToString(a.AlarmName))
+			}
+		}
+	}
+	names = lo.Uniq(names)
+	sort.Strings(names)
+	return names, nil
+}
+
+// watchAlarms checks the alarms periodically until ctx is done or the duration elapsed.
+// When the duration is 0, it checks until ctx is done.
+// It returns ErrAlarm when any alarms are in ALARM state.
+func (d *App) watchAlarms(ctx context.Context, duration time.Duration) error {
+	var timeout <-chan time.Time
+	if duration > 0 {
+		t := time.NewTimer(duration)
+		defer t.Stop()
+		timeout = t.C
+	}
+	tick := time.NewTicker(alarmCheckInterval)
+	defer tick.Stop()
+	for {
+		names, err := d.firingAlarms(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			d.Log("[WARNING] %s", err)
+		} else if len(names) > 0 {
+			return ErrAlarm(fmt.Sprintf("alarms are in ALARM state: %s", strings.Join(names, ", ")))
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timeout:
+			return nil
+		case <-tick.C:
+		}
+	}
+}
+
+// bakeAlarms watches the alarms for the bake time after the service became stable.
+func (d *App) bakeAlarms(ctx context.Context) error {
+	bakeTime := d.config.Alarms.bakeTime()
+	if bakeTime <= 0 {
+		return nil
+	}
+	d.Log("Watching alarms for %s (bake time)", bakeTime)
+	d.emitPhase("bake_alarms", phaseStatusStarted, nil)
+	err := d.watchAlarms(ctx, bakeTime)
+	if err == nil && ctx.Err() != nil {
+		err = fmt.Errorf("failed to watch alarms: %w", ctx.Err())
+	}
+	d.emitPhaseResult("bake_alarms", err)
+	if err != nil {
+		return err
+	}
+	d.Log("No alarms fired in the bake time")
+	return nil
+}
+
+// shouldRollbackOnAlarm reports whether the service should be rolled back by the error of alarms.
+func (d *App) shouldRollbackOnAlarm(sv *Service, err error) bool {
+	if d.config.Alarms == nil || !d.config.Alarms.Rollback || sv.isCodeDeploy() {
+		return false
+	}
+	var e ErrAlarm
+	return errors.As(err, &e)
+}
@@ -0,0 +1,132 @@
+package ecspresso_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwTypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/kayac/ecspresso/v2"
+)
+
+// alarmsTestingMiddleware returns the alarms in ALARM state for DescribeAlarms.
+func alarmsTestingMiddleware(firing []string) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(
+			middleware.InitializeMiddlewareFunc(
+				"test",
+				func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+					params, ok := in.Parameters.(*cloudwatch.DescribeAlarmsInput)
+					if !ok {
+						return next.HandleInitialize(ctx, in)
+					}
+					out := &cloudwatch.DescribeAlarmsOutput{}
+					for _, name := range firing {
+						matched := aws.ToString(params.AlarmNamePrefix) != "" && strings.HasPrefix(name, *params.AlarmNamePrefix)
+						for _, n := range params.AlarmNames {
+							if n == name {
+								matched = true
+							}
+						}
+						if matched {
+							out.MetricAlarms = append(out.MetricAlarms, cwTypes.MetricAlarm{
+								AlarmName:  aws.String(name),
+								StateValue: cwTypes.StateValueAlarm,
+							})
+						}
+					}
+					return middleware.InitializeOutput{Result: out}, middleware.Metadata{}, nil
+				},
+			),
+			middleware.Before,
+		)
+	}
+}
+
+func TestLoadConfigAlarms(t *testing.T) {
+	ctx := context.Background()
+	loader := ecspresso.NewConfigLoader(nil, nil)
+	conf, err := loader.Load(ctx, "tests/alarms.yml", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := conf.Alarms
+	if len(a.Names) != 2 || len(a.Prefixes) != 1 || !a.Rollback {
+		t.Errorf("unexpected alarms: %#v", a)
+	}
+	if a.BakeTime.Duration != 5*time.Minute {
+		t.Errorf("unexpected bake time: %s", a.BakeTime.Duration)
+	}
+
+	_, err = loader.Load(ctx, "tests/alarms_invalid.yml", "")
+	if err == nil || !strings.Contains(err.Error(), "alarms.names or alarms.prefixes is required") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+var watchAlarmsTests = []struct {
+	name   string
+	firing []string
+	expect string
+}{
+	{
+		name:   "no alarms",
+		firing: nil,
+	},
+	{
+		name:   "other alarms",
+		firing: []string{"other-5xx"},
+	},
+	{
+		name:   "by name",
+		firing: []string{"test-latency"},
+		expect: "alarms are in ALARM state: test-latency",
+	},
+	{
+		name:   "by prefix",
+		firing: []string{"test-api-errors", "test-5xx"},
+		expect: "alarms are in ALARM state: test-5xx, test-api-errors",
+	},
+}
+
+func TestWatchAlarms(t *testing.T) {
+	ctx := context.Background()
+	ecspresso.SetAlarmCheckInterval(10 * time.Millisecond)
+	defer ecspresso.SetAlarmCheckInterval(10 * time.Second)
+	defer ecspresso.ResetAWSV2ConfigLoadOptionsFunc()
+
+	for _, tt := range watchAlarmsTests {
+		t.Run(tt.name, func(t *testing.T) {
+			ecspresso.SetAWSV2ConfigLoadOptionsFunc([]func(*config.LoadOptions) error{
+				config.WithRegion("ap-northeast-1"),
+				config.WithAPIOptions([]func(*middleware.Stack) error{
+					alarmsTestingMiddleware(tt.firing),
+				}),
+			})
+			app, err := ecspresso.New(ctx, &ecspresso.CLIOptions{ConfigFilePath: "tests/alarms.yml"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = app.WatchAlarms(ctx, 50*time.Millisecond)
+			if tt.expect == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+				return
+			}
+			var alarmErr ecspresso.ErrAlarm
+			if !errors.As(err, &alarmErr) {
+				t.Fatalf("expected ErrAlarm, got %v", err)
+			}
+			if err.Error() != tt.expect {
+				t.Errorf("unexpected error: %s expected %s", err, tt.expect)
+			}
+		})
+	}
+}
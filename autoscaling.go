@@ -43,9 +43,8 @@ func (p *modifyAutoScalingParams) SuspendState() *aasTypes.SuspendedState {
 	}
 }
 
-func (d *App) modifyAutoScaling(ctx context.Context, opt DeployOption) error {
-	p := opt.ModifyAutoScalingParams()
-	if p.isEmpty() {
+func (d *App) modifyAutoScaling(ctx context.Context, p *modifyAutoScalingParams, dryRun bool) error {
+	if p == nil || p.isEmpty() {
 		return nil
 	}
 	d.Log("[INFO] Modify auto scaling settings %s", p.String())
@@ -68,7 +67,7 @@ func (d *App) modifyAutoScaling(ctx context.Context, opt DeployOption) error {
 		return nil
 	}
 
-	if opt.DryRun {
+	if dryRun {
 		return nil
 	}
 	for _, target := range out.ScalableTargets {
@@ -0,0 +1,304 @@
+package ecspresso
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+const DefaultCanaryServiceSuffix = "-canary"
+
+var canaryCheckInterval = 10 * time.Second
+
+// ConfigCanary represents a configuration of canary deployments.
+type ConfigCanary struct {
+	Steps         []ConfigCanaryStep `yaml:"steps,omitempty" json:"steps,omitempty"`
+	ServiceSuffix string             `yaml:"service_suffix,omitempty" json:"service_suffix,omitempty"`
+}
+
+// ConfigCanaryStep represents a step of canary deployments.
+type ConfigCanaryStep struct {
+	Percent int32     `yaml:"percent" json:"percent"`
+	Pause   *Duration `yaml:"pause,omitempty" json:"pause,omitempty"`
+}
+
+var defaultCanarySteps = []ConfigCanaryStep{
+	{Percent: 10, Pause: &Duration{time.Minute}},
+	{Percent: 50, Pause: &Duration{time.Minute}},
+}
+
+func (c *ConfigCanary) validate() error {
+	var prev int32
+	for i, s := range c.Steps {
+		if s.Percent <= 0 || s.Percent > 100 {
+			return fmt.Errorf("canary.steps[%d].percent must be between 1 and 100", i)
+		}
+		if s.Percent <= prev {
+			return fmt.Errorf("canary.steps[%d].percent must be greater than the previous step", i)
+		}
+		prev = s.Percent
+	}
+	return nil
+}
+
+func (c *ConfigCanary) serviceName(service string) string {
+	if c == nil || c.ServiceSuffix == "" {
+		return service + DefaultCanaryServiceSuffix
+	}
+	return service + c.ServiceSuffix
+}
+
+type canaryStep struct {
+	count int32
+	pause time.Duration
+}
+
+// canarySteps returns the desired counts of the canary service for each step.
+// Steps of 100% are not included because the last step is always deploying to the service.
+func canarySteps(c *ConfigCanary, desired int32) []canaryStep {
+	steps := defaultCanarySteps
+	if c != nil && len(c.Steps) > 0 {
+		steps = c.Steps
+	}
+	var result []canaryStep
+	for _, s := range steps {
+		if s.Percent >= 100 {
+			break
+		}
+		count := int32(math.Ceil(float64(desired) * float64(s.Percent) / 100))
+		if count < 1 {
+			count = 1
+		}
+		if count > desired {
+			count = desired
+		}
+		var pause time.Duration
+		if s.Pause != nil {
+			pause = s.Pause.Duration
+		}
+		result = append(result, canaryStep{count: count, pause: pause})
+	}
+	return result
+}
+
+// DeployByCanary deploys the task definition to a temporary canary service step by step,
+// and then deploys it to the service.
+// When a health check of the canary fails, the canary service is deleted and
+// the service keeps running the previous task definition.
+func (d *App) DeployByCanary(ctx context.Context, taskDefinitionArn string, count *int32, sv *Service, opt DeployOption) error {
+	current, err := d.DescribeService(ctx)
+	if err != nil {
+		return err
+	}
+	if dc := current.DeploymentController; dc != nil && dc.Type != types.DeploymentControllerTypeEcs {
+		return fmt.Errorf("canary deployment supports only ECS deployment controller: %s", dc.Type)
+	}
+	if current.SchedulingStrategy == types.SchedulingStrategyDaemon {
+		return errors.New("canary deployment does not support DAEMON scheduling strategy")
+	}
+	prevTdArn := aws.ToString(current.TaskDefinition)
+	desired := aws.ToInt32(current.DesiredCount)
+	if count != nil {
+		desired = *count
+	}
+	canaryName := d.config.Canary.serviceName(d.Service)
+
+	for i, step := range canarySteps(d.config.Canary, desired) {
+		d.Log("Canary step %d: %d/%d tasks of %s", i+1, step.count, desired, arnToName(taskDefinitionArn))
+		if err := d.deployCanaryStep(ctx, canaryName, current, taskDefinitionArn, step); err != nil {
+			d.Log("[WARNING] canary step %d failed: %s", i+1, err)
+			d.abortCanary(canaryName, "", sv)
+			return fmt.Errorf("canary deployment aborted: %w", err)
+		}
+	}
+
+	d.Log("Canary steps completed. Deploying %s to the service", arnToName(taskDefinitionArn))
+	if err := d.UpdateServiceTasks(ctx, taskDefinitionArn, count, sv, opt); err != nil {
+		d.abortCanary(canaryName, "", sv)
+		return err
+	}
+	if err := d.WaitServiceStable(ctx, sv); err != nil {
+		d.Log("[WARNING] %s", err)
+		d.abortCanary(canaryName, prevTdArn, sv)
+		return fmt.Errorf("canary deployment aborted: %w", err)
+	}
+	return d.deleteCanaryService(ctx, canaryName)
+}
+
+// abortCanary restores the previous task definition of the service when prevTdArn is not empty,
+// and deletes the canary service.
+// It runs on a new context, because the context of the deployment may be expired by the timeout or interrupted.
+func (d *App) abortCanary(name, prevTdArn string, sv *Service) {
+	ctx, cancel := d.Start(context.Background())
+	defer cancel()
+	if prevTdArn != "" {
+		d.Log("Restoring the previous task definition %s", arnToName(prevTdArn))
+		if err := d.UpdateServiceTasks(ctx, prevTdArn, nil, sv, DeployOption{}); err != nil {
+			d.Log("[WARNING] failed to restore the previous task definition: %s", err)
+		}
+	}
+	if err := d.deleteCanaryService(ctx, name); err != nil {
+		d.Log("[WARNING] %s", err)
+	}
+}
+
+func (d *App) deployCanaryStep(ctx context.Context, name string, sv *Service, taskDefinitionArn string, step canaryStep) error {
+	exists, err := d.existsService(ctx, name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		d.Log("Updating canary service %s", name)
+		if _, err := d.ecs.UpdateService(ctx, &ecs.UpdateServiceInput{
+			Cluster:        aws.String(d.Cluster),
+			Service:        aws.String(name),
+			TaskDefinition: aws.String(taskDefinitionArn),
+			DesiredCount:   aws.Int32(step.count),
+		}); err != nil {
+			return fmt.Errorf("failed to update canary service %s: %w", name, err)
+		}
+	} else {
+		d.Log("Creating canary service %s", name)
+		if _, err := d.ecs.CreateService(ctx, canaryServiceInput(d.Cluster, name, sv, taskDefinitionArn, step.count)); err != nil {
+			return fmt.Errorf("failed to create canary service %s: %w", name, err)
+		}
+	}
+	time.Sleep(delayForServiceChanged) // wait for service updated
+
+	d.Log("Waiting for canary service %s stable", name)
+	waiter := ecs.NewServicesStableWaiter(d.ecs, func(o *ecs.ServicesStableWaiterOptions) {
+		o.MaxDelay = waiterMaxDelay
+	})
+	in := &ecs.DescribeServicesInput{
+		Cluster:  aws.String(d.Cluster),
+		Services: []string{name},
+	}
+	if err := waiter.Wait(ctx, in, d.Timeout()); err != nil {
+		return fmt.Errorf("failed to wait for canary service stable: %w", err)
+	}
+
+	if step.pause > 0 {
+		d.Log("Pausing %s to check the canary", step.pause)
+	}
+	pause := time.NewTimer(step.pause)
+	defer pause.Stop()
+	tick := time.NewTicker(canaryCheckInterval)
+	defer tick.Stop()
+	for {
+		if err := d.checkCanaryHealth(ctx, name); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-pause.C:
+			d.Log("Canary service %s is healthy", name)
+			return nil
+		case <-tick.C:
+		}
+	}
+}
+
+// checkCanaryHealth checks the canary service is healthy.
+// It fails when the deployment of the canary failed, any tasks failed or running tasks are less than desired.
+func (d *App) checkCanaryHealth(ctx context.Context, name string) error {
+	out, err := d.ecs.DescribeServices(ctx, &ecs.DescribeServicesInput{
+		Cluster:  aws.String(d.Cluster),
+		Services: []string{name},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to describe canary service: %w", err)
+	}
+	if len(out.Services) == 0 {
+		return ErrNotFound(fmt.Sprintf("canary service %s is not found", name))
+	}
+	sv := out.Services[0]
+	for _, dp := range sv.Deployments {
+		if aws.ToString(dp.Status) != "PRIMARY" {
+			continue
+		}
+		d.Log("[DEBUG] canary %s", formatDeployment(dp))
+		if dp.RolloutState == types.DeploymentRolloutStateFailed {
+			return fmt.Errorf("canary deployment failed: %s", aws.ToString(dp.RolloutStateReason))
+		}
+		if dp.FailedTasks > 0 {
+			return fmt.Errorf("%d tasks of the canary failed", dp.FailedTasks)
+		}
+	}
+	if sv.RunningCount < sv.DesiredCount {
+		return fmt.Errorf("canary running tasks %d are less than desired %d", sv.RunningCount, sv.DesiredCount)
+	}
+	return nil
+}
+
+func (d *App) existsService(ctx context.Context, name string) (bool, error) {
+	out, err := d.ecs.DescribeServices(ctx, &ecs.DescribeServicesInput{
+		Cluster:  aws.String(d.Cluster),
+		Services: []string{name},
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to describe service %s: %w", name, err)
+	}
+	for _, s := range out.Services {
+		if aws.ToString(s.Status) == "ACTIVE" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (d *App) deleteCanaryService(ctx context.Context, name string) error {
+	exists, err := d.existsService(ctx, name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+	d.Log("Deleting canary service %s", name)
+	if _, err := d.ecs.DeleteService(ctx, &ecs.DeleteServiceInput{
+		Cluster: aws.String(d.Cluster),
+		Service: aws.String(name),
+		Force:   aws.Bool(true),
+	}); err != nil {
+		return fmt.Errorf("failed to delete canary service %s: %w", name, err)
+	}
+	return nil
+}
+
+// canaryServiceInput creates a CreateServiceInput for the canary service from the service.
+// ServiceRegistries and ServiceConnectConfiguration are not copied to avoid conflicts of service discovery names.
+func canaryServiceInput(cluster, name string, sv *Service, taskDefinitionArn string, count int32) *ecs.CreateServiceInput {
+	in := &ecs.CreateServiceInput{
+		Cluster:                       aws.String(cluster),
+		ServiceName:                   aws.String(name),
+		TaskDefinition:                aws.String(taskDefinitionArn),
+		DesiredCount:                  aws.Int32(count),
+		CapacityProviderStrategy:      sv.CapacityProviderStrategy,
+		DeploymentConfiguration:       sv.DeploymentConfiguration,
+		EnableECSManagedTags:          sv.EnableECSManagedTags,
+		EnableExecuteCommand:          sv.EnableExecuteCommand,
+		HealthCheckGracePeriodSeconds: sv.HealthCheckGracePeriodSeconds,
+		LoadBalancers:                 sv.LoadBalancers,
+		NetworkConfiguration:          sv.NetworkConfiguration,
+		PlacementConstraints:          sv.PlacementConstraints,
+		PlacementStrategy:             sv.PlacementStrategy,
+		PlatformVersion:               sv.PlatformVersion,
+		PropagateTags:                 sv.PropagateTags,
+		Tags:                          sv.Tags,
+		VolumeConfigurations:          sv.VolumeConfigurations,
+	}
+	if len(sv.CapacityProviderStrategy) == 0 {
+		in.LaunchType = sv.LaunchType
+	}
+	if len(in.Tags) == 0 {
+		in.Tags = nil
+	}
+	return in
+}
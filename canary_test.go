@@ -0,0 +1,166 @@
+package ecspresso_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/google/go-cmp/cmp"
+	"github.com/kayac/ecspresso/v2"
+)
+
+var canaryStepsTests = []struct {
+	name    string
+	steps   []ecspresso.ConfigCanaryStep
+	desired int32
+	counts  []int32
+	pauses  []time.Duration
+}{
+	{
+		name:    "default",
+		desired: 10,
+		counts:  []int32{1, 5},
+		pauses:  []time.Duration{time.Minute, time.Minute},
+	},
+	{
+		name: "rounded up",
+		steps: []ecspresso.ConfigCanaryStep{
+			{Percent: 10, Pause: &ecspresso.Duration{Duration: 30 * time.Second}},
+			{Percent: 60},
+			{Percent: 100},
+		},
+		desired: 3,
+		counts:  []int32{1, 2},
+		pauses:  []time.Duration{30 * time.Second, 0},
+	},
+	{
+		name: "at least one task",
+		steps: []ecspresso.ConfigCanaryStep{
+			{Percent: 1},
+		},
+		desired: 5,
+		counts:  []int32{1},
+		pauses:  []time.Duration{0},
+	},
+	{
+		name: "no desired tasks",
+		steps: []ecspresso.ConfigCanaryStep{
+			{Percent: 1},
+		},
+		desired: 0,
+		counts:  []int32{0},
+		pauses:  []time.Duration{0},
+	},
+}
+
+func TestCanarySteps(t *testing.T) {
+	for _, tt := range canaryStepsTests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c *ecspresso.ConfigCanary
+			if tt.steps != nil {
+				c = &ecspresso.ConfigCanary{Steps: tt.steps}
+			}
+			counts, pauses := ecspresso.CanarySteps(c, tt.desired)
+			if diff := cmp.Diff(tt.counts, counts); diff != "" {
+				t.Errorf("unexpected counts: %s", diff)
+			}
+			if diff := cmp.Diff(tt.pauses, pauses); diff != "" {
+				t.Errorf("unexpected pauses: %s", diff)
+			}
+		})
+	}
+}
+
+func TestLoadConfigCanary(t *testing.T) {
+	ctx := context.Background()
+	loader := ecspresso.NewConfigLoader(nil, nil)
+	conf, err := loader.Load(ctx, "tests/canary.yml", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts, pauses := ecspresso.CanarySteps(conf.Canary, 40)
+	if diff := cmp.Diff([]int32{2, 10}, counts); diff != "" {
+		t.Errorf("unexpected counts: %s", diff)
+	}
+	if diff := cmp.Diff([]time.Duration{30 * time.Second, 2 * time.Minute}, pauses); diff != "" {
+		t.Errorf("unexpected pauses: %s", diff)
+	}
+	if conf.Canary.ServiceSuffix != "-cn" {
+		t.Errorf("unexpected service suffix: %s", conf.Canary.ServiceSuffix)
+	}
+
+	_, err = loader.Load(ctx, "tests/canary_invalid.yml", "")
+	if err == nil || !strings.Contains(err.Error(), "canary.steps[1].percent must be greater than the previous step") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestAbortCanary(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("AWS_REGION", "ap-northeast-1")
+	ecspresso.SetDelayForServiceChanged(0)
+	defer ecspresso.SetDelayForServiceChanged(3 * time.Second)
+	prevTdArn := "arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:1"
+	var calls []string
+	ecspresso.SetAWSV2ConfigLoadOptionsFunc([]func(*config.LoadOptions) error{
+		config.WithRegion("ap-northeast-1"),
+		config.WithAPIOptions([]func(*middleware.Stack) error{
+			func(stack *middleware.Stack) error {
+				return stack.Initialize.Add(
+					middleware.InitializeMiddlewareFunc(
+						"test",
+						func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+							if err := ctx.Err(); err != nil {
+								return middleware.InitializeOutput{}, middleware.Metadata{}, err
+							}
+							var out any
+							switch p := in.Parameters.(type) {
+							case *ecs.UpdateServiceInput:
+								calls = append(calls, "UpdateService "+aws.ToString(p.Service)+" "+aws.ToString(p.TaskDefinition))
+								out = &ecs.UpdateServiceOutput{}
+							case *ecs.DescribeServicesInput:
+								out = &ecs.DescribeServicesOutput{Services: []types.Service{
+									{ServiceName: aws.String(p.Services[0]), Status: aws.String("ACTIVE")},
+								}}
+							case *ecs.DeleteServiceInput:
+								calls = append(calls, "DeleteService "+aws.ToString(p.Service))
+								out = &ecs.DeleteServiceOutput{}
+							default:
+								return middleware.InitializeOutput{}, middleware.Metadata{}, fmt.Errorf("unexpected call %T", in.Parameters)
+							}
+							return middleware.InitializeOutput{Result: out}, middleware.Metadata{}, nil
+						},
+					),
+					middleware.Before,
+				)
+			},
+		}),
+	})
+	defer ecspresso.ResetAWSV2ConfigLoadOptionsFunc()
+
+	app, err := ecspresso.New(ctx, &ecspresso.CLIOptions{ConfigFilePath: "tests/ecspresso.yml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.SetLogger(log.New(io.Discard, "", 0))
+
+	// abortCanary runs on its own context, so it does not depend on the context of the deployment
+	sv := &ecspresso.Service{Service: types.Service{ServiceName: aws.String("test")}}
+	app.AbortCanary("test-canary", prevTdArn, sv)
+	expected := []string{
+		"UpdateService test " + prevTdArn,
+		"DeleteService test-canary",
+	}
+	if diff := cmp.Diff(expected, calls); diff != "" {
+		t.Errorf("unexpected calls: %s", diff)
+	}
+}
@@ -2,11 +2,17 @@ package ecspresso
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// ExitCodeRolledBack is the exit code when the service was rolled back after a failed deployment.
+const ExitCodeRolledBack = 3
+
 type CLIOptions struct {
 	Envfile        []string          `help:"environment files" env:"ECSPRESSO_ENVFILE"`
 	Debug          bool              `help:"enable debug log" env:"ECSPRESSO_DEBUG"`
@@ -16,21 +22,31 @@ type CLIOptions struct {
 	AssumeRoleARN  string            `help:"the ARN of the role to assume" default:"" env:"ECSPRESSO_ASSUME_ROLE_ARN"`
 	Timeout        *time.Duration    `help:"timeout. Override in a configuration file." env:"ECSPRESSO_TIMEOUT"`
 	FilterCommand  string            `help:"filter command" env:"ECSPRESSO_FILTER_COMMAND"`
+	LockHolder     string            `help:"holder of the deployment lock (default: user@hostname)" env:"ECSPRESSO_LOCK_HOLDER"`
+	LockReason     string            `help:"reason of the deployment lock" env:"ECSPRESSO_LOCK_REASON"`
+	SummaryFile    string            `help:"file to write Markdown reports of diff, deploy, rollback and verify (default: $GITHUB_STEP_SUMMARY)" env:"ECSPRESSO_SUMMARY_FILE"`
+	OTLPEndpoint   string            `name:"otlp-endpoint" help:"OTLP/HTTP endpoint URL to export traces (e.g. http://localhost:4318)" env:"ECSPRESSO_OTLP_ENDPOINT"`
+	OutputEvents   string            `help:"output events to STDOUT in the format (jsonl). logs are written to STDERR" enum:",jsonl" default:"" env:"ECSPRESSO_OUTPUT_EVENTS"`
 
 	Appspec    *AppSpecOption    `cmd:"" help:"output AppSpec YAML for CodeDeploy to STDOUT"`
+	Apply      *ApplyOption      `cmd:"" help:"apply a deployment plan created by deploy --plan-out"`
 	Delete     *DeleteOption     `cmd:"" help:"delete service"`
 	Deploy     *DeployOption     `cmd:"" help:"deploy service"`
 	Deregister *DeregisterOption `cmd:"" help:"deregister task definition"`
 	Diff       *DiffOption       `cmd:"" help:"show diff between task definition, service definition with current running service and task definition"`
 	Exec       *ExecOption       `cmd:"" help:"execute command on task"`
+	History    *HistoryOption    `cmd:"" help:"show deployment history"`
 	Init       *InitOption       `cmd:"" help:"create configuration files from existing ECS service"`
+	Lock       *LockOption       `cmd:"" help:"show status of the deployment lock or force unlock it"`
+	Logs       *LogsOption       `cmd:"" help:"show logs of the containers in the tasks of service"`
 	Refresh    *RefreshOption    `cmd:"" help:"refresh service. equivalent to deploy --skip-task-definition --force-new-deployment --no-update-service"`
 	Register   *RegisterOption   `cmd:"" help:"register task definition"`
-	Render     *RenderOption     `cmd:"" help:"render config, service definition or task definition file to STDOUT"`
+	Render     *RenderOption     `cmd:"" help:"render config, service definition, task definition or docker compose file to STDOUT"`
 	Revisions  *RevisionsOption  `cmd:"" help:"show revisions of task definitions"`
 	Rollback   *RollbackOption   `cmd:"" help:"rollback service"`
 	Run        *RunOption        `cmd:"" help:"run task"`
 	Scale      *ScaleOption      `cmd:"" help:"scale service. equivalent to deploy --skip-task-definition --no-update-service"`
+	Stack      *StackOption      `cmd:"" help:"deploy, diff, verify or show status of multiple services defined in a stack file"`
 	Status     *StatusOption     `cmd:"" help:"show status of service"`
 	Tasks      *TasksOption      `cmd:"" help:"list tasks that are in a service or having the same family"`
 	Verify     *VerifyOption     `cmd:"" help:"verify resources in configurations"`
@@ -60,6 +76,8 @@ func (opts *CLIOptions) ForSubCommand(sub string) interface{} {
 	switch sub {
 	case "appspec":
 		return opts.Appspec
+	case "apply":
+		return opts.Apply
 	case "delete":
 		return opts.Delete
 	case "deploy":
@@ -70,8 +88,14 @@ func (opts *CLIOptions) ForSubCommand(sub string) interface{} {
 		return opts.Diff
 	case "exec":
 		return opts.Exec
+	case "history":
+		return opts.History
 	case "init":
 		return opts.Init
+	case "lock":
+		return opts.Lock
+	case "logs":
+		return opts.Logs
 	case "refresh":
 		return opts.Refresh
 	case "register":
@@ -86,6 +110,8 @@ func (opts *CLIOptions) ForSubCommand(sub string) interface{} {
 		return opts.Run
 	case "scale":
 		return opts.Scale
+	case "stack":
+		return opts.Stack
 	case "status":
 		return opts.Status
 	case "tasks":
@@ -99,12 +125,31 @@ func (opts *CLIOptions) ForSubCommand(sub string) interface{} {
 	}
 }
 
-func dispatchCLI(ctx context.Context, sub string, usage func(), opts *CLIOptions) error {
+func dispatchCLI(ctx context.Context, sub string, usage func(), opts *CLIOptions) (err error) {
 	switch sub {
 	case "version", "":
 		fmt.Println("ecspresso", Version)
 		return nil
 	}
+	shutdownTracing, err := setupTracing(ctx, opts.OTLPEndpoint)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			Log("[WARNING] failed to export traces: %s", err)
+		}
+	}()
+	ctx, span := startSpan(ctx, "ecspresso "+sub, attribute.String("ecspresso.command", sub))
+	defer func() { endSpan(span, err) }()
+
+	switch sub {
+	case "stack":
+		// stack loads multiple configurations by itself
+		return opts.Stack.run(ctx, opts)
+	}
 	var appOpts []AppOption
 	if sub == "init" {
 		config, err := opts.Init.NewConfig(ctx, opts.ConfigFilePath)
@@ -117,10 +162,13 @@ func dispatchCLI(ctx context.Context, sub string, usage func(), opts *CLIOptions
 	if err != nil {
 		return err
 	}
+	span.SetAttributes(app.spanAttributes()...)
 	app.Log("[DEBUG] dispatching subcommand: %s", sub)
 	switch sub {
 	case "deploy":
 		return app.Deploy(ctx, *opts.Deploy)
+	case "apply":
+		return app.Apply(ctx, *opts.Apply)
 	case "refresh":
 		return app.Deploy(ctx, opts.Refresh.DeployOption())
 	case "scale":
@@ -129,6 +177,10 @@ func dispatchCLI(ctx context.Context, sub string, usage func(), opts *CLIOptions
 		return app.Status(ctx, *opts.Status)
 	case "rollback":
 		return app.Rollback(ctx, *opts.Rollback)
+	case "lock":
+		return app.Lock(ctx, *opts.Lock)
+	case "history":
+		return app.History(ctx, *opts.History)
 	case "create":
 		return fmt.Errorf("create command is deprecated. use deploy command instead")
 	case "delete":
@@ -157,6 +209,8 @@ func dispatchCLI(ctx context.Context, sub string, usage func(), opts *CLIOptions
 		return app.Tasks(ctx, *opts.Tasks)
 	case "exec":
 		return app.Exec(ctx, *opts.Exec)
+	case "logs":
+		return app.Logs(ctx, *opts.Logs)
 	default:
 		usage()
 	}
@@ -171,6 +225,10 @@ func CLI(ctx context.Context, parse CLIParseFunc) (int, error) {
 		return 1, err
 	}
 	if err := dispatchCLI(ctx, sub, usage, opts); err != nil {
+		var e ErrRolledBack
+		if errors.As(err, &e) {
+			return ExitCodeRolledBack, err
+		}
 		return 1, err
 	}
 	return 0, nil
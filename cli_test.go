@@ -4,6 +4,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/kayac/ecspresso/v2"
@@ -37,7 +38,9 @@ var cliTests = []struct {
 			AssumeRoleARN:  "arn:aws:iam::123456789012:role/exampleRole",
 		},
 		subOption: &ecspresso.StatusOption{
-			Events: 10,
+			Events:   10,
+			Interval: 5 * time.Second,
+			Output:   "table",
 		},
 		fn: func(t *testing.T, _ any) {
 			if v := os.Getenv("ECSPRESSO_TEST"); v != "ok" {
@@ -61,7 +64,9 @@ var cliTests = []struct {
 			AssumeRoleARN:  "",
 		},
 		subOption: &ecspresso.StatusOption{
-			Events: 100,
+			Events:   100,
+			Interval: 5 * time.Second,
+			Output:   "table",
 		},
 	},
 	{
@@ -80,25 +85,73 @@ var cliTests = []struct {
 			}
 		},
 	},
+	{
+		args: []string{
+			"--config", "config.yml",
+			"--lock-holder", "alice",
+			"--lock-reason", "release v1.2.3",
+			"--output-events", "jsonl",
+			"--summary-file", "summary.md",
+			"--otlp-endpoint", "http://localhost:4318",
+			"deploy",
+		},
+		sub: "deploy",
+		option: &ecspresso.CLIOptions{
+			ConfigFilePath: "config.yml",
+			ExtStr:         map[string]string{},
+			ExtCode:        map[string]string{},
+			LockHolder:     "alice",
+			LockReason:     "release v1.2.3",
+			OutputEvents:   "jsonl",
+			SummaryFile:    "summary.md",
+			OTLPEndpoint:   "http://localhost:4318",
+		},
+	},
 	{
 		args: []string{"status"},
 		sub:  "status",
 		subOption: &ecspresso.StatusOption{
-			Events: 10,
+			Events:   10,
+			Interval: 5 * time.Second,
+			Output:   "table",
 		},
 	},
 	{
 		args: []string{"status", "--events=100"},
 		sub:  "status",
 		subOption: &ecspresso.StatusOption{
-			Events: 100,
+			Events:   100,
+			Interval: 5 * time.Second,
+			Output:   "table",
 		},
 	},
 	{
 		args: []string{"status", "--events", "20"},
 		sub:  "status",
 		subOption: &ecspresso.StatusOption{
-			Events: 20,
+			Events:   20,
+			Interval: 5 * time.Second,
+			Output:   "table",
+		},
+	},
+	{
+		args: []string{"status", "--watch", "--interval", "10s"},
+		sub:  "status",
+		subOption: &ecspresso.StatusOption{
+			Events:   10,
+			Watch:    true,
+			Interval: 10 * time.Second,
+			Output:   "table",
+		},
+	},
+	{
+		args: []string{"status", "--output", "json", "--query", ".deployments[].rolloutState"},
+		sub:  "status",
+		subOption: &ecspresso.StatusOption{
+			Events:   10,
+			Interval: 5 * time.Second,
+			Output:   "json",
+			Query:    ".deployments[].rolloutState",
 		},
 	},
 	{
@@ -133,6 +186,63 @@ var cliTests = []struct {
 			LatestTaskDefinition: true,
 		},
 	},
+	{
+		args: []string{"deploy", "--canary"},
+		sub:  "deploy",
+		subOption: &ecspresso.DeployOption{
+			DryRun:               false,
+			DesiredCount:         ptr(int32(-1)),
+			SkipTaskDefinition:   false,
+			Revision:             0,
+			ForceNewDeployment:   false,
+			Wait:                 true,
+			RollbackEvents:       "",
+			UpdateService:        true,
+			LatestTaskDefinition: false,
+			Canary:               true,
+		},
+	},
+	{
+		args: []string{"deploy", "--plan-out=plan.json", "--tasks=3"},
+		sub:  "deploy",
+		subOption: &ecspresso.DeployOption{
+			DryRun:               false,
+			DesiredCount:         ptr(int32(3)),
+			SkipTaskDefinition:   false,
+			Revision:             0,
+			ForceNewDeployment:   false,
+			Wait:                 true,
+			RollbackEvents:       "",
+			UpdateService:        true,
+			LatestTaskDefinition: false,
+			PlanOut:              "plan.json",
+		},
+	},
+	{
+		args: []string{"apply", "plan.json", "--dry-run"},
+		sub:  "apply",
+		subOption: &ecspresso.ApplyOption{
+			Plan:   "plan.json",
+			DryRun: true,
+		},
+	},
+	{
+		args: []string{"deploy", "--rollback-on-failure", "--deregister-failed-task-definition"},
+		sub:  "deploy",
+		subOption: &ecspresso.DeployOption{
+			DryRun:                   false,
+			DesiredCount:             ptr(int32(-1)),
+			SkipTaskDefinition:       false,
+			Revision:                 0,
+			ForceNewDeployment:       false,
+			Wait:                     true,
+			RollbackEvents:           "",
+			UpdateService:            true,
+			LatestTaskDefinition:     false,
+			RollbackOnFailure:        true,
+			DeregisterTaskDefinition: true,
+		},
+	},
 	{
 		args: []string{"deploy", "--resume-auto-scaling"},
 		sub:  "deploy",
@@ -390,6 +500,73 @@ var cliTests = []struct {
 			RollbackEvents:           "",
 		},
 	},
+	{
+		args: []string{"rollback", "--to-deployment", "abcdef123456"},
+		sub:  "rollback",
+		subOption: &ecspresso.RollbackOption{
+			DeregisterTaskDefinition: true,
+			Wait:                     true,
+			ToDeployment:             "abcdef123456",
+		},
+	},
+	{
+		args: []string{"rollback", "--revision", "42"},
+		sub:  "rollback",
+		subOption: &ecspresso.RollbackOption{
+			DeregisterTaskDefinition: true,
+			Wait:                     true,
+			Revision:                 42,
+		},
+	},
+	{
+		args: []string{"rollback", "--select"},
+		sub:  "rollback",
+		subOption: &ecspresso.RollbackOption{
+			DeregisterTaskDefinition: true,
+			Wait:                     true,
+			Select:                   true,
+		},
+	},
+	{
+		args: []string{"rollback", "--no-select"},
+		sub:  "rollback",
+		subOption: &ecspresso.RollbackOption{
+			DeregisterTaskDefinition: true,
+			Wait:                     true,
+			NoSelect:                 true,
+		},
+	},
+	{
+		args: []string{"history"},
+		sub:  "history",
+		subOption: &ecspresso.HistoryOption{
+			Limit:  20,
+			Output: "table",
+		},
+	},
+	{
+		args: []string{"history", "--id", "0123abcd", "--limit", "5", "--output", "json"},
+		sub:  "history",
+		subOption: &ecspresso.HistoryOption{
+			ID:     "0123abcd",
+			Limit:  5,
+			Output: "json",
+		},
+	},
+	{
+		args: []string{"lock", "status"},
+		sub:  "lock",
+		subOption: &ecspresso.LockOption{
+			Action: "status",
+		},
+	},
+	{
+		args: []string{"lock", "force-unlock"},
+		sub:  "lock",
+		subOption: &ecspresso.LockOption{
+			Action: "force-unlock",
+		},
+	},
 	{
 		args: []string{"delete"},
 		sub:  "delete",
@@ -436,6 +613,10 @@ var cliTests = []struct {
 			Revision:               ptr(int64(0)),
 			ClientToken:            nil,
 			EBSDeleteOnTermination: ptr(true),
+			MaxConcurrency:         0,
+			Exec:                   false,
+			ExecCommand:            "sh",
+			Logs:                   "watch",
 		},
 	},
 	{
@@ -457,6 +638,10 @@ var cliTests = []struct {
 			Revision:               ptr(int64(0)),
 			ClientToken:            nil,
 			EBSDeleteOnTermination: ptr(true),
+			MaxConcurrency:         0,
+			Exec:                   false,
+			ExecCommand:            "sh",
+			Logs:                   "watch",
 		},
 	},
 	{
@@ -467,6 +652,7 @@ var cliTests = []struct {
 			"--latest-task-definition", "--tags", "KeyFoo=ValueFoo,KeyBar=ValueBar",
 			"--wait-until", "running", "--revision", "1",
 			"--client-token", "3abb3a41-c4dc-4c16-a3be-aaab729008a0",
+			"--logs", "all", "--max-concurrency", "5",
 		},
 		sub: "run",
 		subOption: &ecspresso.RunOption{
@@ -485,6 +671,10 @@ var cliTests = []struct {
 			Revision:               ptr(int64(1)),
 			ClientToken:            ptr("3abb3a41-c4dc-4c16-a3be-aaab729008a0"),
 			EBSDeleteOnTermination: ptr(true),
+			MaxConcurrency:         5,
+			Exec:                   false,
+			ExecCommand:            "sh",
+			Logs:                   "all",
 		},
 	},
 	{
@@ -506,6 +696,10 @@ var cliTests = []struct {
 			Revision:               ptr(int64(0)),
 			ClientToken:            nil,
 			EBSDeleteOnTermination: ptr(false),
+			MaxConcurrency:         0,
+			Exec:                   false,
+			ExecCommand:            "sh",
+			Logs:                   "watch",
 		},
 	},
 	{
@@ -763,6 +957,95 @@ var cliTests = []struct {
 			Trace:  true,
 		},
 	},
+	{
+		args: []string{"stack", "deploy"},
+		sub:  "stack",
+		subOption: &ecspresso.StackOption{
+			Action:      "deploy",
+			Stack:       "ecspresso-stack.yml",
+			MaxParallel: 0,
+			Unified:     true,
+			Events:      2,
+			Deploy: ecspresso.DeployOption{
+				DesiredCount:  ptr(int32(-1)),
+				Wait:          true,
+				UpdateService: true,
+			},
+			Verify: ecspresso.VerifyOption{
+				GetSecrets: true,
+				PutLogs:    true,
+				Cache:      true,
+			},
+		},
+	},
+	{
+		args: []string{"stack", "diff", "--stack", "stack.jsonnet", "--no-unified"},
+		sub:  "stack",
+		subOption: &ecspresso.StackOption{
+			Action:  "diff",
+			Stack:   "stack.jsonnet",
+			Unified: false,
+			Events:  2,
+			Deploy: ecspresso.DeployOption{
+				DesiredCount:  ptr(int32(-1)),
+				Wait:          true,
+				UpdateService: true,
+			},
+			Verify: ecspresso.VerifyOption{
+				GetSecrets: true,
+				PutLogs:    true,
+				Cache:      true,
+			},
+		},
+	},
+	{
+		args: []string{"stack", "deploy", "--max-parallel", "3", "--dry-run",
+			"--skip-task-definition", "--force-new-deployment", "--no-wait",
+			"--rollback-on-failure", "--no-update-service",
+		},
+		sub: "stack",
+		subOption: &ecspresso.StackOption{
+			Action:      "deploy",
+			Stack:       "ecspresso-stack.yml",
+			MaxParallel: 3,
+			Unified:     true,
+			Events:      2,
+			Deploy: ecspresso.DeployOption{
+				DryRun:             true,
+				DesiredCount:       ptr(int32(-1)),
+				SkipTaskDefinition: true,
+				ForceNewDeployment: true,
+				Wait:               false,
+				UpdateService:      false,
+				RollbackOnFailure:  true,
+			},
+			Verify: ecspresso.VerifyOption{
+				GetSecrets: true,
+				PutLogs:    true,
+				Cache:      true,
+			},
+		},
+	},
+	{
+		args: []string{"stack", "verify", "--no-get-secrets", "--no-cache"},
+		sub:  "stack",
+		subOption: &ecspresso.StackOption{
+			Action:  "verify",
+			Stack:   "ecspresso-stack.yml",
+			Unified: true,
+			Events:  2,
+			Deploy: ecspresso.DeployOption{
+				DesiredCount:  ptr(int32(-1)),
+				Wait:          true,
+				UpdateService: true,
+			},
+			Verify: ecspresso.VerifyOption{
+				GetSecrets: false,
+				PutLogs:    true,
+				Cache:      false,
+			},
+		},
+	},
 	{
 		args: []string{"exec"},
 		sub:  "exec",
@@ -797,6 +1080,32 @@ var cliTests = []struct {
 			Host:        "example.com",
 		},
 	},
+	{
+		args: []string{"logs"},
+		sub:  "logs",
+		subOption: &ecspresso.LogsOption{
+			Since:  5 * time.Minute,
+			Follow: true,
+		},
+	},
+	{
+		args: []string{"logs",
+			"--id", "abcdefff",
+			"--container", "app",
+			"--container", "nginx",
+			"--since", "1h",
+			"--filter-pattern", "ERROR",
+			"--no-follow",
+		},
+		sub: "logs",
+		subOption: &ecspresso.LogsOption{
+			ID:            "abcdefff",
+			Container:     []string{"app", "nginx"},
+			Since:         time.Hour,
+			FilterPattern: "ERROR",
+			Follow:        false,
+		},
+	},
 }
 
 func TestParseCLIv2(t *testing.T) {
@@ -837,5 +1146,10 @@ func CLIOptionsGlobalOnly(opts *ecspresso.CLIOptions) *ecspresso.CLIOptions {
 		AssumeRoleARN:  opts.AssumeRoleARN,
 		Timeout:        opts.Timeout,
 		FilterCommand:  opts.FilterCommand,
+		LockHolder:     opts.LockHolder,
+		LockReason:     opts.LockReason,
+		OutputEvents:   opts.OutputEvents,
+		SummaryFile:    opts.SummaryFile,
+		OTLPEndpoint:   opts.OTLPEndpoint,
 	}
 }
@@ -46,17 +46,24 @@ func newConfigLoader(extStr, extCode map[string]string) *configLoader {
 
 // Config represents a configuration.
 type Config struct {
-	RequiredVersion       string            `yaml:"required_version,omitempty" json:"required_version,omitempty"`
-	Region                string            `yaml:"region" json:"region"`
-	Cluster               string            `yaml:"cluster" json:"cluster"`
-	Service               string            `yaml:"service" json:"service"`
-	ServiceDefinitionPath string            `yaml:"service_definition" json:"service_definition"`
-	TaskDefinitionPath    string            `yaml:"task_definition" json:"task_definition"`
-	Plugins               []ConfigPlugin    `yaml:"plugins,omitempty" json:"plugins,omitempty"`
-	AppSpec               *appspec.AppSpec  `yaml:"appspec,omitempty" json:"appspec,omitempty"`
-	FilterCommand         string            `yaml:"filter_command,omitempty" json:"filter_command,omitempty"`
-	Timeout               *Duration         `yaml:"timeout,omitempty" json:"timeout,omitempty"`
-	CodeDeploy            *ConfigCodeDeploy `yaml:"codedeploy,omitempty" json:"codedeploy,omitempty"`
+	RequiredVersion       string                `yaml:"required_version,omitempty" json:"required_version,omitempty"`
+	Region                string                `yaml:"region" json:"region"`
+	Cluster               string                `yaml:"cluster" json:"cluster"`
+	Service               string                `yaml:"service" json:"service"`
+	ServiceDefinitionPath string                `yaml:"service_definition" json:"service_definition"`
+	TaskDefinitionPath    string                `yaml:"task_definition" json:"task_definition"`
+	Plugins               []ConfigPlugin        `yaml:"plugins,omitempty" json:"plugins,omitempty"`
+	AppSpec               *appspec.AppSpec      `yaml:"appspec,omitempty" json:"appspec,omitempty"`
+	FilterCommand         string                `yaml:"filter_command,omitempty" json:"filter_command,omitempty"`
+	Timeout               *Duration             `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	CodeDeploy            *ConfigCodeDeploy     `yaml:"codedeploy,omitempty" json:"codedeploy,omitempty"`
+	Canary                *ConfigCanary         `yaml:"canary,omitempty" json:"canary,omitempty"`
+	Hooks                 *ConfigHooks          `yaml:"hooks,omitempty" json:"hooks,omitempty"`
+	Alarms                *ConfigAlarms         `yaml:"alarms,omitempty" json:"alarms,omitempty"`
+	Lock                  *ConfigLock           `yaml:"lock,omitempty" json:"lock,omitempty"`
+	History               *ConfigHistory        `yaml:"history,omitempty" json:"history,omitempty"`
+	Notifications         []*ConfigNotification `yaml:"notifications,omitempty" json:"notifications,omitempty"`
+	Schedules             []*ConfigSchedule     `yaml:"schedules,omitempty" json:"schedules,omitempty"`
 
 	path               string
 	templateFuncs      []template.FuncMap
@@ -119,6 +126,10 @@ func (c *Config) OverrideByCLIOptions(opt *CLIOptions) {
 	if opt.FilterCommand != "" {
 		c.FilterCommand = opt.FilterCommand
 	}
+	if c.Lock != nil {
+		c.Lock.holder = opt.LockHolder
+		c.Lock.reason = opt.LockReason
+	}
 }
 
 // Restrict restricts a configuration.
@@ -145,6 +156,53 @@ func (c *Config) Restrict(ctx context.Context) error {
 	if c.Timeout == nil {
 		c.Timeout = &Duration{Duration: DefaultTimeout}
 	}
+	if c.Canary != nil {
+		if err := c.Canary.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Hooks != nil {
+		if err := c.Hooks.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Alarms != nil {
+		if err := c.Alarms.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Lock != nil {
+		if err := c.Lock.validate(); err != nil {
+			return err
+		}
+	}
+	if c.History != nil {
+		if err := c.History.validate(); err != nil {
+			return err
+		}
+		if c.History.Path != "" && !filepath.IsAbs(c.History.Path) {
+			c.History.Path = filepath.Join(c.dir, c.History.Path)
+		}
+	}
+	for i, n := range c.Notifications {
+		if n == nil {
+			return fmt.Errorf("notifications[%d] is empty", i)
+		}
+		if err := n.validate(i); err != nil {
+			return err
+		}
+	}
+	for i, s := range c.Schedules {
+		if s == nil {
+			return fmt.Errorf("schedules[%d] is empty", i)
+		}
+		if err := s.validate(i); err != nil {
+			return err
+		}
+		if !filepath.IsAbs(s.Path) {
+			s.Path = filepath.Join(c.dir, s.Path)
+		}
+	}
 	if c.Region == "" {
 		c.Region = os.Getenv("AWS_REGION")
 	}
@@ -164,6 +222,7 @@ func (c *Config) Restrict(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("failed to load aws config: %w", err)
 	}
+	c.awsv2Config.APIOptions = append(c.awsv2Config.APIOptions, tracingMiddleware)
 	if err := c.setupPlugins(ctx); err != nil {
 		return fmt.Errorf("failed to setup plugins: %w", err)
 	}
@@ -183,7 +242,9 @@ func (c *Config) AssumeRole(assumeRoleARN string) {
 	c.awsv2Config.Credentials = aws.NewCredentialsCache(assumeRoleProvider)
 }
 
-func (c *Config) setupPlugins(ctx context.Context) error {
+func (c *Config) setupPlugins(ctx context.Context) (err error) {
+	ctx, span := startSpan(ctx, "setup plugins")
+	defer func() { endSpan(span, err) }()
 	plugins := []ConfigPlugin{}
 	for _, name := range defaultPluginNames {
 		plugins = append(plugins, ConfigPlugin{Name: name})
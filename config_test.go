@@ -282,6 +282,20 @@ func TestLoadConfigWithoutTimeout(t *testing.T) {
 	}
 }
 
+func TestLoadConfigHistoryPath(t *testing.T) {
+	t.Setenv("HISTORY_PATH", ".ecspresso/history.jsonl")
+
+	ctx := context.Background()
+	loader := ecspresso.NewConfigLoader(nil, nil)
+	conf, err := loader.Load(ctx, "tests/history.yml", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.History.Path != "tests/.ecspresso/history.jsonl" {
+		t.Errorf("expected history path relative to the config file, but %v", conf.History.Path)
+	}
+}
+
 func TestLoadConfigForCodeDeploy(t *testing.T) {
 	ctx := context.Background()
 	loader := ecspresso.NewConfigLoader(nil, nil)
@@ -77,10 +77,25 @@ func (d *App) createService(ctx context.Context, opt DeployOption) error {
 		TaskDefinition:                aws.String(tdArn),
 		VolumeConfigurations:          svd.VolumeConfigurations,
 	}
+	if svd.isExternal() {
+		// these attributes are specified to task sets.
+		createServiceInput.TaskDefinition = nil
+		createServiceInput.LaunchType = ""
+		createServiceInput.CapacityProviderStrategy = nil
+		createServiceInput.PlatformVersion = nil
+		createServiceInput.NetworkConfiguration = nil
+		createServiceInput.LoadBalancers = nil
+		createServiceInput.ServiceRegistries = nil
+	}
 	if _, err := d.ecs.CreateService(ctx, createServiceInput); err != nil {
 		return fmt.Errorf("failed to create service: %w", err)
 	}
 	d.Log("Service is created")
+	if svd.isExternal() {
+		if err := d.shiftTaskSet(ctx, svd, tdArn, false, false); err != nil {
+			return err
+		}
+	}
 
 	if !opt.Wait {
 		return nil
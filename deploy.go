@@ -25,19 +25,24 @@ const (
 )
 
 type DeployOption struct {
-	DryRun               bool   `help:"dry run" default:"false"`
-	DesiredCount         *int32 `name:"tasks" help:"desired count of tasks" default:"-1"`
-	SkipTaskDefinition   bool   `help:"skip register a new task definition" default:"false"`
-	Revision             int64  `help:"revision of the task definition to run when --skip-task-definition" default:"0"`
-	ForceNewDeployment   bool   `help:"force a new deployment of the service" default:"false"`
-	Wait                 bool   `help:"wait for service stable" default:"true" negatable:""`
-	SuspendAutoScaling   *bool  `help:"suspend application auto-scaling attached with the ECS service"`
-	ResumeAutoScaling    *bool  `help:"resume application auto-scaling attached with the ECS service"`
-	AutoScalingMin       *int32 `help:"set minimum capacity of application auto-scaling attached with the ECS service"`
-	AutoScalingMax       *int32 `help:"set maximum capacity of application auto-scaling attached with the ECS service"`
-	RollbackEvents       string `help:"roll back when specified events happened (DEPLOYMENT_FAILURE,DEPLOYMENT_STOP_ON_ALARM,DEPLOYMENT_STOP_ON_REQUEST,...) CodeDeploy only." default:""`
-	UpdateService        bool   `help:"update service attributes by service definition" default:"true" negatable:""`
-	LatestTaskDefinition bool   `help:"deploy with the latest task definition without registering a new task definition" default:"false"`
+	DryRun                   bool   `help:"dry run" default:"false"`
+	DesiredCount             *int32 `name:"tasks" help:"desired count of tasks" default:"-1"`
+	SkipTaskDefinition       bool   `help:"skip register a new task definition" default:"false"`
+	Revision                 int64  `help:"revision of the task definition to run when --skip-task-definition" default:"0"`
+	ForceNewDeployment       bool   `help:"force a new deployment of the service" default:"false"`
+	Wait                     bool   `help:"wait for service stable" default:"true" negatable:""`
+	SuspendAutoScaling       *bool  `help:"suspend application auto-scaling attached with the ECS service"`
+	ResumeAutoScaling        *bool  `help:"resume application auto-scaling attached with the ECS service"`
+	AutoScalingMin           *int32 `help:"set minimum capacity of application auto-scaling attached with the ECS service"`
+	AutoScalingMax           *int32 `help:"set maximum capacity of application auto-scaling attached with the ECS service"`
+	RollbackEvents           string `help:"roll back when specified events happened (DEPLOYMENT_FAILURE,DEPLOYMENT_STOP_ON_ALARM,DEPLOYMENT_STOP_ON_REQUEST,...) CodeDeploy only." default:""`
+	UpdateService            bool   `help:"update service attributes by service definition" default:"true" negatable:""`
+	LatestTaskDefinition     bool   `help:"deploy with the latest task definition without registering a new task definition" default:"false"`
+	Canary                   bool   `help:"deploy step by step with a temporary canary service. ECS deployment controller only." default:"false"`
+	PlanOut                  string `help:"save the deployment plan to the file instead of deploying. apply it by ecspresso apply" default:""`
+	RollbackOnFailure        bool   `help:"roll back to the previous task definition when the service does not become stable. ECS deployment controller only." default:"false"`
+	DeregisterTaskDefinition bool   `name:"deregister-failed-task-definition" help:"deregister the failed task definition when rolled back. works with --rollback-on-failure" default:"false"`
+	DiagnosticsFile          string `help:"file to save the diagnostics of the stopped tasks as JSON when the service does not become stable (default: a temporary file)" default:""`
 }
 
 func (opt DeployOption) DryRunString() string {
@@ -61,6 +66,19 @@ func (opt DeployOption) ModifyAutoScalingParams() *modifyAutoScalingParams {
 	return p
 }
 
+// registersTaskDefinition reports whether the deployment registers a new task definition.
+func (opt DeployOption) registersTaskDefinition() bool {
+	return opt.Revision == 0 && !opt.LatestTaskDefinition && !opt.SkipTaskDefinition
+}
+
+func (opt DeployOption) rollbackOption() RollbackOption {
+	return RollbackOption{
+		DryRun:                   opt.DryRun,
+		DeregisterTaskDefinition: opt.DeregisterTaskDefinition,
+		Wait:                     true,
+	}
+}
+
 func calcDesiredCount(sv *Service, opt DeployOption) *int32 {
 	if sv.SchedulingStrategy == types.SchedulingStrategyDaemon {
 		return nil
@@ -75,21 +93,58 @@ func calcDesiredCount(sv *Service, opt DeployOption) *int32 {
 }
 
 func (d *App) Deploy(ctx context.Context, opt DeployOption) error {
+	return d.deploy(ctx, opt, nil)
+}
+
+// deploy deploys the service. When plan is not nil, the task definition and the service definition in the plan are used.
+func (d *App) deploy(ctx context.Context, opt DeployOption, plan *DeployPlan) (err error) {
 	d.Log("[DEBUG] deploy")
 	d.LogJSON(opt)
 	ctx, cancel := d.Start(ctx)
 	defer cancel()
 
+	if !opt.DryRun && opt.PlanOut == "" {
+		unlock, err := d.lock(ctx, "deploy")
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	var rec *HistoryRecord
+	if !opt.DryRun && opt.PlanOut == "" {
+		rec = d.newHistoryRecord(historyOperationDeploy)
+		defer func() { d.recordHistory(rec, err) }()
+		ctx = d.withNotification(ctx, "deploy")
+		d.notify(ctx, NotificationEventStarted, nil)
+		defer func() { d.notifyResult(ctx, err) }()
+	}
+	var report *deploymentReport
+	if !opt.DryRun && opt.PlanOut == "" {
+		report = d.newDeploymentReport("deploy")
+		defer func() { d.writeDeploymentReport(ctx, report, err) }()
+	}
+
 	var sv *Service
 	d.Log("Starting deploy %s", opt.DryRunString())
-	sv, err := d.DescribeServiceStatus(ctx, 0)
+	if d.config.Service == "" && len(d.config.Schedules) > 0 {
+		return d.deployScheduledTask(ctx, opt)
+	}
+	sv, err = d.DescribeServiceStatus(ctx, 0)
 	if err != nil {
 		if errors.As(err, &errNotFound) {
+			if opt.PlanOut != "" || plan != nil {
+				return fmt.Errorf("deployment plan is not supported for creating a new service: %w", err)
+			}
 			d.Log("Service %s not found. Creating a new service %s", d.Service, opt.DryRunString())
 			return d.createService(ctx, opt)
 		}
 		return err
 	}
+	if plan != nil {
+		if err := plan.checkDrift(sv); err != nil {
+			return fmt.Errorf("refused to apply the plan: %w", err)
+		}
+	}
 
 	doDeploy, err := d.DeployFunc(sv)
 	if err != nil {
@@ -99,25 +154,101 @@ func (d *App) Deploy(ctx context.Context, opt DeployOption) error {
 	if err != nil {
 		return err
 	}
+	if opt.Canary {
+		if sv.isCodeDeploy() {
+			return ErrConflictOptions("canary deployment is not supported for CodeDeploy")
+		}
+		if sv.isExternal() {
+			return ErrConflictOptions("canary deployment is not supported for EXTERNAL deployment controller")
+		}
+		if sv.isNativeBlueGreen() {
+			return ErrConflictOptions(fmt.Sprintf("canary deployment is not supported for %s deployment strategy", sv.deploymentStrategy()))
+		}
+		if !opt.Wait {
+			return ErrConflictOptions("canary and no-wait are exclusive")
+		}
+		doDeploy = d.DeployByCanary
+	}
+	if opt.RollbackOnFailure {
+		if sv.isCodeDeploy() {
+			return ErrConflictOptions("rollback-on-failure is not supported for CodeDeploy")
+		}
+		if !opt.Wait {
+			return ErrConflictOptions("rollback-on-failure and no-wait are exclusive")
+		}
+		if opt.Canary {
+			return ErrConflictOptions("rollback-on-failure and canary are exclusive. canary deployment restores the previous task definition by itself")
+		}
+	} else if opt.DeregisterTaskDefinition {
+		return ErrConflictOptions("deregister-failed-task-definition works with rollback-on-failure only")
+	}
+	if opt.DeregisterTaskDefinition && !opt.registersTaskDefinition() {
+		return ErrConflictOptions("deregister-failed-task-definition can't be used with revision, latest-task-definition or skip-task-definition. it deregisters only the task definition registered by the deployment")
+	}
+	if opt.PlanOut != "" {
+		return d.savePlan(ctx, sv, opt)
+	}
 
-	tdArn, err := d.taskDefinitionArnForDeploy(ctx, sv, opt)
+	var tdArn string
+	if plan != nil {
+		tdArn, err = d.taskDefinitionArnForPlan(ctx, plan, opt)
+	} else {
+		tdArn, err = d.taskDefinitionArnForDeploy(ctx, sv, opt)
+	}
 	if err != nil {
 		return err
 	}
+	prevTdArn := aws.ToString(sv.TaskDefinition)
+	setNotificationTaskDefinition(ctx, tdArn)
+	if report != nil {
+		report.TaskDefinitionArn = tdArn
+		report.PreviousTaskDefinitionArn = prevTdArn
+	}
+	if rec != nil {
+		rec.TaskDefinitionArn = tdArn
+		rec.PreviousTaskDefinitionArn = prevTdArn
+		if tdArn != prevTdArn {
+			rec.addDiffSummary(fmt.Sprintf("task definition %s -> %s", arnToName(prevTdArn), arnToName(tdArn)))
+		}
+	}
+	// canary deployment does not change the task definition of the service until the last step.
+	svTdArn := tdArn
+	if opt.Canary {
+		svTdArn = prevTdArn
+	}
+	// hooks run only when the task definition of the service will be changed.
+	withHooks := tdArn != prevTdArn
+	if withHooks {
+		if err := d.runHooks(ctx, hookPhasePreDeploy, tdArn, opt.DryRun); err != nil {
+			return err
+		}
+	}
 
 	var count *int32
-	if d.config.ServiceDefinitionPath != "" && opt.UpdateService {
-		newSv, err := d.LoadServiceDefinition(d.config.ServiceDefinitionPath)
-		if err != nil {
+	var newSv *Service
+	if plan != nil {
+		if newSv, err = plan.serviceDefinition(); err != nil {
+			return err
+		}
+	} else if d.config.ServiceDefinitionPath != "" && opt.UpdateService {
+		if newSv, err = d.LoadServiceDefinition(d.config.ServiceDefinitionPath); err != nil {
 			return err
 		}
+	}
+	if newSv != nil {
 		addedTags, updatedTags, deletedTags := CompareTags(sv.Tags, newSv.Tags)
 		ds, err := diffServices(newSv, sv, d.config.ServiceDefinitionPath, true)
 		if err != nil {
 			return fmt.Errorf("failed to diff of service definitions: %w", err)
 		}
 		if ds != "" {
-			if err = d.UpdateServiceAttributes(ctx, newSv, tdArn, opt); err != nil {
+			if rec != nil {
+				rec.addDiffSummary("service definition " + diffSummary(ds))
+			}
+			if report != nil {
+				report.ServiceDiff = ds
+			}
+			if err = d.UpdateServiceAttributes(ctx, newSv, svTdArn, opt); err != nil {
 				return err
 			}
 			sv = newSv // updated
@@ -131,6 +262,12 @@ func (d *App) Deploy(ctx context.Context, opt DeployOption) error {
 	} else {
 		count = calcDesiredCount(sv, opt)
 	}
+	autoScaling := opt.ModifyAutoScalingParams()
+	if plan != nil {
+		// apply the desired count and the auto scaling settings as planned
+		count = plan.DesiredCount
+		autoScaling = plan.AutoScaling
+	}
 	if count != nil {
 		d.Log("desired count: %d", *count)
 	} else {
@@ -138,11 +275,14 @@ func (d *App) Deploy(ctx context.Context, opt DeployOption) error {
 	}
 
 	// manage auto scaling
-	if err := d.modifyAutoScaling(ctx, opt); err != nil {
+	if err := d.modifyAutoScaling(ctx, autoScaling, opt.DryRun); err != nil {
 		return err
 	}
 
 	if opt.DryRun {
+		if err := d.deploySchedules(ctx, tdArn, true); err != nil {
+			return err
+		}
 		d.Log("DRY RUN OK")
 		return nil
 	}
@@ -152,24 +292,59 @@ func (d *App) Deploy(ctx context.Context, opt DeployOption) error {
 	}
 
 	if !opt.Wait {
+		if withHooks && len(d.config.Hooks.of(hookPhasePostDeploy)) > 0 {
+			d.Log("[WARNING] %s hooks are skipped with --no-wait", hookPhasePostDeploy)
+		}
+		if err := d.deploySchedules(ctx, tdArn, false); err != nil {
+			return err
+		}
 		d.Log("Service is deployed.")
 		return nil
 	}
 
-	if err := doWait(ctx, sv); err != nil {
-		if errors.As(err, &errNotFound) {
-			d.Log("[INFO] %s", err)
-			// no need to wait
-			return nil
+	// DeployByCanary waits for the service stable by itself
+	if !opt.Canary {
+		if err := doWait(ctx, sv); err != nil {
+			if errors.As(err, &errNotFound) {
+				d.Log("[INFO] %s", err)
+				// no need to wait
+				return nil
+			}
+			d.diagnoseFailedDeployment(ctx, sv, tdArn, err, opt.DiagnosticsFile)
+			if opt.RollbackOnFailure || d.shouldRollbackOnAlarm(sv, err) {
+				return d.rollbackFailedDeployment(ctx, err, tdArn, prevTdArn, opt.rollbackOption())
+			}
+			return err
+		}
+		// the deployment circuit breaker may have rolled back the service before it became stable.
+		if !sv.isCodeDeploy() && !sv.isExternal() {
+			if err := d.checkRolledBack(ctx, tdArn); err != nil {
+				d.diagnoseFailedDeployment(ctx, sv, tdArn, err, opt.DiagnosticsFile)
+				return err
+			}
 		}
-		return err
 	}
 
+	if withHooks {
+		if err := d.runHooks(ctx, hookPhasePostDeploy, tdArn, false); err != nil {
+			if d.config.Hooks.RollbackOnFailure || opt.RollbackOnFailure {
+				return d.rollbackFailedDeployment(ctx, err, tdArn, prevTdArn, opt.rollbackOption())
+			}
+			return err
+		}
+	}
+
+	// schedules run the new task definition after the service is deployed successfully.
+	if err := d.deploySchedules(ctx, tdArn, false); err != nil {
+		return err
+	}
 	d.Log("Service is stable now. Completed!")
 	return nil
 }
 
-func (d *App) UpdateServiceTasks(ctx context.Context, taskDefinitionArn string, count *int32, sv *Service, opt DeployOption) error {
+func (d *App) UpdateServiceTasks(ctx context.Context, taskDefinitionArn string, count *int32, sv *Service, opt DeployOption) (err error) {
+	ctx, span := startSpan(ctx, "update service tasks", d.spanAttributes()...)
+	defer func() { endSpan(span, err) }()
 	in := &ecs.UpdateServiceInput{
 		Service:            sv.ServiceName,
 		Cluster:            aws.String(d.Cluster),
@@ -185,10 +360,12 @@ func (d *App) UpdateServiceTasks(ctx context.Context, taskDefinitionArn string,
 	d.Log(msg)
 	d.LogJSON(in)
 
-	_, err := d.ecs.UpdateService(ctx, in)
-	if err != nil {
-		return fmt.Errorf("failed to update service tasks: %w", err)
+	if _, err = d.ecs.UpdateService(ctx, in); err != nil {
+		err = fmt.Errorf("failed to update service tasks: %w", err)
+		d.emitPhase("update_service", phaseStatusFailed, err)
+		return err
 	}
+	d.emitPhase("update_service", phaseStatusCompleted, nil)
 	time.Sleep(delayForServiceChanged) // wait for service updated
 	return nil
 }
@@ -217,7 +394,9 @@ func svToUpdateServiceInput(sv *Service) *ecs.UpdateServiceInput {
 	return in
 }
 
-func (d *App) UpdateServiceAttributes(ctx context.Context, sv *Service, taskDefinitionArn string, opt DeployOption) error {
+func (d *App) UpdateServiceAttributes(ctx context.Context, sv *Service, taskDefinitionArn string, opt DeployOption) (err error) {
+	ctx, span := startSpan(ctx, "update service attributes", d.spanAttributes()...)
+	defer func() { endSpan(span, err) }()
 	in := svToUpdateServiceInput(sv)
 	if sv.isCodeDeploy() {
 		d.Log("[INFO] deployment by CodeDeploy")
@@ -229,6 +408,18 @@ func (d *App) UpdateServiceAttributes(ctx context.Context, sv *Service, taskDefi
 		in.ServiceRegistries = nil
 		in.TaskDefinition = nil
 		in.CapacityProviderStrategy = nil
+	} else if sv.isExternal() {
+		d.Log("[INFO] deployment by task sets (EXTERNAL)")
+		// these attributes are managed by task sets.
+		in.NetworkConfiguration = nil
+		in.PlatformVersion = nil
+		in.ForceNewDeployment = false
+		in.LoadBalancers = nil
+		in.ServiceRegistries = nil
+		in.TaskDefinition = nil
+		in.CapacityProviderStrategy = nil
+		in.ServiceConnectConfiguration = nil
+		in.VolumeConfigurations = nil
 	} else {
 		d.Log("[INFO] deployment by ECS rolling update")
 		in.ForceNewDeployment = opt.ForceNewDeployment
@@ -383,7 +574,9 @@ func (d *App) findCodeDeployDeploymentGroups(ctx context.Context, appName string
 	return groups, nil
 }
 
-func (d *App) createDeployment(ctx context.Context, sv *Service, taskDefinitionArn string, rollbackEvents string) error {
+func (d *App) createDeployment(ctx context.Context, sv *Service, taskDefinitionArn string, rollbackEvents string) (err error) {
+	ctx, span := startSpan(ctx, "create CodeDeploy deployment", d.spanAttributes()...)
+	defer func() { endSpan(span, err) }()
 	spec, err := appspec.NewWithService(&sv.Service, taskDefinitionArn)
 	if err != nil {
 		return fmt.Errorf("failed to create appspec: %w", err)
@@ -444,6 +637,14 @@ func (d *App) createDeployment(ctx context.Context, sv *Service, taskDefinitionA
 	)
 	d.Log("Deployment %s is created on CodeDeploy:", id)
 	d.Log(u)
+	setNotificationCodeDeployment(ctx, id, u)
+	d.emitEvent(&OutputEvent{
+		Type:    OutputEventTypePhase,
+		Phase:   "create_codedeploy_deployment",
+		Status:  phaseStatusCompleted,
+		ID:      id,
+		Message: u,
+	})
 
 	if isatty.IsTerminal(os.Stdout.Fd()) {
 		if err := exec.Command("open", u).Start(); err != nil {
@@ -464,6 +665,8 @@ func (d *App) DeployFunc(sv *Service) (deployFunc, error) {
 		switch dc.Type {
 		case types.DeploymentControllerTypeCodeDeploy:
 			return d.DeployByCodeDeploy, nil
+		case types.DeploymentControllerTypeExternal:
+			return d.DeployByTaskSet, nil
 		case types.DeploymentControllerTypeEcs:
 			return d.UpdateServiceTasks, nil
 		default:
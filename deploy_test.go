@@ -1,10 +1,19 @@
 package ecspresso_test
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
 	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/smithy-go/middleware"
 	"github.com/kayac/ecspresso/v2"
 )
 
@@ -72,3 +81,65 @@ func TestCalcDesiredCount(t *testing.T) {
 		}
 	}
 }
+
+func TestDeployDeregisterFailedTaskDefinitionConflicts(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("AWS_REGION", "ap-northeast-1")
+	t.Setenv("GITHUB_STEP_SUMMARY", "")
+	const tdArn = "arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:1"
+	ecspresso.SetAWSV2ConfigLoadOptionsFunc([]func(*config.LoadOptions) error{
+		config.WithRegion("ap-northeast-1"),
+		config.WithAPIOptions([]func(*middleware.Stack) error{
+			func(stack *middleware.Stack) error {
+				return stack.Initialize.Add(
+					middleware.InitializeMiddlewareFunc(
+						"test",
+						func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+							var out any
+							switch in.Parameters.(type) {
+							case *ecs.DescribeServicesInput:
+								out = &ecs.DescribeServicesOutput{Services: []types.Service{
+									{
+										ServiceName:    aws.String("test"),
+										ClusterArn:     aws.String("arn:aws:ecs:ap-northeast-1:123456789012:cluster/default"),
+										Status:         aws.String("ACTIVE"),
+										TaskDefinition: aws.String(tdArn),
+										DesiredCount:   1,
+									},
+								}}
+							case *applicationautoscaling.DescribeScalableTargetsInput:
+								out = &applicationautoscaling.DescribeScalableTargetsOutput{}
+							default:
+								return middleware.InitializeOutput{}, middleware.Metadata{}, fmt.Errorf("unexpected call %T", in.Parameters)
+							}
+							return middleware.InitializeOutput{Result: out}, middleware.Metadata{}, nil
+						},
+					),
+					middleware.Before,
+				)
+			},
+		}),
+	})
+	defer ecspresso.ResetAWSV2ConfigLoadOptionsFunc()
+	app, err := ecspresso.New(ctx, &ecspresso.CLIOptions{ConfigFilePath: "tests/ecspresso.yml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.SetLogger(log.New(io.Discard, "", 0))
+
+	// deregistering is allowed only for the task definition registered by the deployment
+	for name, opt := range map[string]ecspresso.DeployOption{
+		"revision":               {Revision: 1},
+		"latest task definition": {LatestTaskDefinition: true},
+		"skip task definition":   {SkipTaskDefinition: true},
+	} {
+		opt.DryRun = true
+		opt.Wait = true
+		opt.RollbackOnFailure = true
+		opt.DeregisterTaskDefinition = true
+		var e ecspresso.ErrConflictOptions
+		if err := app.Deploy(ctx, opt); !errors.As(err, &e) {
+			t.Errorf("%s: expected ErrConflictOptions, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package ecspresso
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+const (
+	diagnosticsMaxTasks = 5
+	diagnosticsLogLines = 20
+	diagnosticsTimeout  = time.Minute
+)
+
+// Diagnostics is a bundle of the stopped tasks of a failed deployment.
+type Diagnostics struct {
+	Cluster           string                   `json:"cluster"`
+	Service           string                   `json:"service"`
+	DeploymentID      string                   `json:"deployment_id,omitempty"`
+	TaskDefinitionArn string                   `json:"task_definition_arn"`
+	Error             string                   `json:"error"`
+	CollectedAt       time.Time                `json:"collected_at"`
+	StoppedTasks      []StoppedTaskDiagnostics `json:"stopped_tasks"`
+}
+
+// StoppedTaskDiagnostics represents a stopped task in Diagnostics.
+type StoppedTaskDiagnostics struct {
+	TaskArn           string                 `json:"task_arn"`
+	TaskDefinitionArn string                 `json:"task_definition_arn"`
+	StopCode          string                 `json:"stop_code,omitempty"`
+	StoppedReason     string                 `json:"stopped_reason,omitempty"`
+	StartedAt         *time.Time             `json:"started_at,omitempty"`
+	StoppedAt         *time.Time             `json:"stopped_at,omitempty"`
+	Containers        []ContainerDiagnostics `json:"containers"`
+}
+
+// ContainerDiagnostics represents a container of a stopped task in Diagnostics.
+type ContainerDiagnostics struct {
+	Name      string   `json:"name"`
+	ExitCode  *int32   `json:"exit_code,omitempty"`
+	Reason    string   `json:"reason,omitempty"`
+	LogGroup  string   `json:"log_group,omitempty"`
+	LogStream string   `json:"log_stream,omitempty"`
+	Logs      []string `json:"logs,omitempty"`
+}
+
+// diagnoseFailedDeployment shows the stopped tasks of the deployment of the task definition,
+// and saves them as a JSON bundle to the path (a temporary file when empty).
+// It is best effort and never fails.
+func (d *App) diagnoseFailedDeployment(ctx context.Context, sv *Service, tdArn string, cause error, path string) {
+	if errors.Is(ctx.Err(), context.Canceled) || sv.isCodeDeploy() || sv.isExternal() {
+		return
+	}
+	// the context may be expired by the timeout of the deployment
+	ctx, cancel := context.WithTimeout(context.Background(), diagnosticsTimeout)
+	defer cancel()
+	dg, err := d.collectDiagnostics(ctx, tdArn, cause)
+	if err != nil {
+		d.Log("[WARNING] failed to collect diagnostics: %s", err)
+		return
+	}
+	if len(dg.StoppedTasks) == 0 {
+		d.Log("[INFO] no stopped tasks of the deployment are found")
+	}
+	for _, task := range dg.StoppedTasks {
+		d.Log("Stopped task %s (%s): %s %s", arnToName(task.TaskArn), arnToName(task.TaskDefinitionArn), task.StopCode, task.StoppedReason)
+		for _, c := range task.Containers {
+			exitCode := "-"
+			if c.ExitCode != nil {
+				exitCode = fmt.Sprintf("%d", *c.ExitCode)
+			}
+			d.Log("  container %s: exit code %s %s", c.Name, exitCode, c.Reason)
+			for _, line := range c.Logs {
+				fmt.Fprintln(d.humanOutput(), spcIndent+spcIndent+line)
+			}
+		}
+	}
+	if path == "" {
+		path = filepath.Join(os.TempDir(), fmt.Sprintf("ecspresso-diagnostics-%s-%d.json", d.Service, dg.CollectedAt.Unix()))
+	}
+	b, err := json.MarshalIndent(dg, "", "  ")
+	if err != nil {
+		d.Log("[WARNING] failed to marshal diagnostics: %s", err)
+		return
+	}
+	if err := os.WriteFile(path, append(b, '\n'), CreateFileMode); err != nil {
+		d.Log("[WARNING] failed to write diagnostics to %s: %s", path, err)
+		return
+	}
+	d.Log("Diagnostics of the failed deployment are saved to %s", path)
+}
+
+func (d *App) collectDiagnostics(ctx context.Context, tdArn string, cause error) (*Diagnostics, error) {
+	dg := &Diagnostics{
+		Cluster:           d.Cluster,
+		Service:           d.Service,
+		TaskDefinitionArn: tdArn,
+		CollectedAt:       time.Now(),
+		StoppedTasks:      []StoppedTaskDiagnostics{},
+	}
+	if cause != nil {
+		dg.Error = cause.Error()
+	}
+
+	// the deployment of the task definition. ECS sets its ID to startedBy of the tasks.
+	out, err := d.ecs.DescribeServices(ctx, d.DescribeServicesInput())
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe service: %w", err)
+	}
+	var deployedAt time.Time
+	for _, s := range out.Services {
+		for _, dp := range s.Deployments {
+			if aws.ToString(dp.TaskDefinition) == tdArn && aws.ToTime(dp.CreatedAt).After(deployedAt) {
+				dg.DeploymentID = aws.ToString(dp.Id)
+				deployedAt = aws.ToTime(dp.CreatedAt)
+			}
+		}
+	}
+
+	tasks, err := d.stoppedTasks(ctx, tdArn, dg.DeploymentID)
+	if err != nil {
+		return nil, err
+	}
+	tds := map[string]*TaskDefinitionInput{}
+	for _, task := range tasks {
+		d.emitEvent(taskStateEvent(task))
+		st := StoppedTaskDiagnostics{
+			TaskArn:           aws.ToString(task.TaskArn),
+			TaskDefinitionArn: aws.ToString(task.TaskDefinitionArn),
+			StopCode:          string(task.StopCode),
+			StoppedReason:     aws.ToString(task.StoppedReason),
+			StartedAt:         task.StartedAt,
+			StoppedAt:         task.StoppedAt,
+		}
+		td, ok := tds[st.TaskDefinitionArn]
+		if !ok {
+			if td, err = d.DescribeTaskDefinition(ctx, st.TaskDefinitionArn); err != nil {
+				return nil, err
+			}
+			tds[st.TaskDefinitionArn] = td
+		}
+		for _, c := range task.Containers {
+			cd := ContainerDiagnostics{
+				Name:     aws.ToString(c.Name),
+				ExitCode: c.ExitCode,
+				Reason:   aws.ToString(c.Reason),
+			}
+			if def := containerOf(td, c.Name); def != nil && task.StartedAt != nil {
+				if lt, err := containerLogTarget(&task, def); err != nil {
+					d.Log("[DEBUG] %s", err)
+				} else {
+					cd.LogGroup, cd.LogStream = lt.Group, lt.Stream
+					if cd.Logs, err = d.lastLogLines(ctx, cd.LogGroup, cd.LogStream, *task.StartedAt); err != nil {
+						d.Log("[WARNING] %s", err)
+					}
+				}
+			}
+			st.Containers = append(st.Containers, cd)
+		}
+		dg.StoppedTasks = append(dg.StoppedTasks, st)
+	}
+	return dg, nil
+}
+
+// stoppedTasks returns the recently stopped tasks started by the deployment (or running the task definition when the deployment is unknown), newest first.
+func (d *App) stoppedTasks(ctx context.Context, tdArn, deploymentID string) ([]types.Task, error) {
+	lt, err := d.ecs.ListTasks(ctx, &ecs.ListTasksInput{
+		Cluster:       aws.String(d.Cluster),
+		ServiceName:   aws.String(d.Service),
+		DesiredStatus: types.DesiredStatusStopped,
+		MaxResults:    aws.Int32(100),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tasks: %w", err)
+	}
+	if len(lt.TaskArns) == 0 {
+		return nil, nil
+	}
+	out, err := d.ecs.DescribeTasks(ctx, &ecs.DescribeTasksInput{
+		Cluster: aws.String(d.Cluster),
+		Tasks:   lt.TaskArns,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe tasks: %w", err)
+	}
+	var tasks []types.Task
+	for _, task := range out.Tasks {
+		if deploymentID != "" && aws.ToString(task.StartedBy) != deploymentID {
+			continue
+		}
+		if aws.ToString(task.TaskDefinitionArn) != tdArn {
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return aws.ToTime(tasks[i].StoppedAt).After(aws.ToTime(tasks[j].StoppedAt))
+	})
+	if len(tasks) > diagnosticsMaxTasks {
+		tasks = tasks[:diagnosticsMaxTasks]
+	}
+	return tasks, nil
+}
+
+// lastLogLines returns the last lines of the log stream.
+func (d *App) lastLogLines(ctx context.Context, logGroup, logStream string, startedAt time.Time) ([]string, error) {
+	in := d.GetLogEventsInput(logGroup, logStream, startedAt.UnixMilli(), nil)
+	in.Limit = aws.Int32(diagnosticsLogLines)
+	in.StartFromHead = aws.Bool(false)
+	out, err := d.cwl.GetLogEvents(ctx, in)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get log events of %s: %w", logStream, err)
+	}
+	lines := make([]string, 0, len(out.Events))
+	for _, e := range out.Events {
+		lines = append(lines, formatLogEvent(e))
+	}
+	return lines, nil
+}
@@ -0,0 +1,171 @@
+package ecspresso_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	logsTypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/google/go-cmp/cmp"
+	"github.com/kayac/ecspresso/v2"
+)
+
+const (
+	diagnosticsNewTdArn = "arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:2"
+	diagnosticsOldTdArn = "arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:1"
+)
+
+// diagnosticsMiddleware returns the service deploying test:2 by ecs-svc/new, and the stopped tasks:
+// crashed (test:2, ecs-svc/new), older (test:2, ecs-svc/new, stopped before crashed), replaced (test:1, ecs-svc/old).
+func diagnosticsMiddleware(stack *middleware.Stack) error {
+	now := time.Now()
+	task := func(id, tdArn, startedBy string, stoppedAt time.Time, exitCode int32) types.Task {
+		return types.Task{
+			TaskArn:           aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task/default/" + id),
+			TaskDefinitionArn: aws.String(tdArn),
+			StartedBy:         aws.String(startedBy),
+			StopCode:          types.TaskStopCodeEssentialContainerExited,
+			StoppedReason:     aws.String("Essential container in task exited"),
+			StartedAt:         aws.Time(stoppedAt.Add(-time.Minute)),
+			StoppedAt:         aws.Time(stoppedAt),
+			Containers: []types.Container{
+				{Name: aws.String("app"), ExitCode: aws.Int32(exitCode), Reason: aws.String("")},
+			},
+		}
+	}
+	tasks := []types.Task{
+		task("older", diagnosticsNewTdArn, "ecs-svc/new", now.Add(-2*time.Minute), 2),
+		task("replaced", diagnosticsOldTdArn, "ecs-svc/old", now, 0),
+		task("crashed", diagnosticsNewTdArn, "ecs-svc/new", now.Add(-time.Minute), 1),
+	}
+	return stack.Initialize.Add(
+		middleware.InitializeMiddlewareFunc(
+			"test",
+			func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+				var out any
+				switch params := in.Parameters.(type) {
+				case *ecs.DescribeServicesInput:
+					out = &ecs.DescribeServicesOutput{
+						Services: []types.Service{{
+							ServiceName: aws.String("test"),
+							Deployments: []types.Deployment{
+								{Id: aws.String("ecs-svc/new"), TaskDefinition: aws.String(diagnosticsNewTdArn), CreatedAt: aws.Time(now.Add(-10 * time.Minute))},
+								{Id: aws.String("ecs-svc/old"), TaskDefinition: aws.String(diagnosticsOldTdArn), CreatedAt: aws.Time(now.Add(-time.Hour))},
+							},
+						}},
+					}
+				case *ecs.ListTasksInput:
+					if params.DesiredStatus != types.DesiredStatusStopped {
+						return middleware.InitializeOutput{}, middleware.Metadata{}, errors.New("unexpected desired status")
+					}
+					res := &ecs.ListTasksOutput{}
+					for _, t := range tasks {
+						res.TaskArns = append(res.TaskArns, aws.ToString(t.TaskArn))
+					}
+					out = res
+				case *ecs.DescribeTasksInput:
+					out = &ecs.DescribeTasksOutput{Tasks: tasks}
+				case *ecs.DescribeTaskDefinitionInput:
+					out = &ecs.DescribeTaskDefinitionOutput{
+						TaskDefinition: &types.TaskDefinition{
+							TaskDefinitionArn: params.TaskDefinition,
+							ContainerDefinitions: []types.ContainerDefinition{{
+								Name: aws.String("app"),
+								LogConfiguration: &types.LogConfiguration{
+									LogDriver: types.LogDriverAwslogs,
+									Options: map[string]string{
+										"awslogs-group":         "/ecs/test",
+										"awslogs-stream-prefix": "ecs",
+									},
+								},
+							}},
+						},
+					}
+				case *cloudwatchlogs.GetLogEventsInput:
+					if aws.ToBool(params.StartFromHead) || aws.ToInt32(params.Limit) == 0 {
+						return middleware.InitializeOutput{}, middleware.Metadata{}, errors.New("expected to get the last lines")
+					}
+					out = &cloudwatchlogs.GetLogEventsOutput{
+						Events: []logsTypes.OutputLogEvent{
+							{Timestamp: aws.Int64(now.UnixMilli()), Message: aws.String("panic: " + aws.ToString(params.LogStreamName))},
+						},
+					}
+				default:
+					return next.HandleInitialize(ctx, in)
+				}
+				return middleware.InitializeOutput{Result: out}, middleware.Metadata{}, nil
+			},
+		),
+		middleware.Before,
+	)
+}
+
+func TestDiagnoseFailedDeployment(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("AWS_REGION", "ap-northeast-1")
+	ecspresso.SetAWSV2ConfigLoadOptionsFunc([]func(*config.LoadOptions) error{
+		config.WithRegion("ap-northeast-1"),
+		config.WithAPIOptions([]func(*middleware.Stack) error{diagnosticsMiddleware}),
+	})
+	defer ecspresso.ResetAWSV2ConfigLoadOptionsFunc()
+	app, err := ecspresso.New(ctx, &ecspresso.CLIOptions{ConfigFilePath: "tests/ecspresso.yml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "diagnostics.json")
+	app.DiagnoseFailedDeployment(ctx, &ecspresso.Service{}, diagnosticsNewTdArn, errors.New("deployment failed"), path)
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dg ecspresso.Diagnostics
+	if err := json.Unmarshal(b, &dg); err != nil {
+		t.Fatal(err)
+	}
+	if dg.DeploymentID != "ecs-svc/new" || dg.Error != "deployment failed" {
+		t.Errorf("unexpected diagnostics: %#v", dg)
+	}
+	var ids []string
+	for _, task := range dg.StoppedTasks {
+		ids = append(ids, filepath.Base(task.TaskArn))
+	}
+	if diff := cmp.Diff([]string{"crashed", "older"}, ids); diff != "" {
+		t.Errorf("unexpected stopped tasks: %s", diff)
+	}
+	c := dg.StoppedTasks[0].Containers[0]
+	if aws.ToInt32(c.ExitCode) != 1 || c.LogStream != "ecs/app/crashed" || c.LogGroup != "/ecs/test" {
+		t.Errorf("unexpected container: %#v", c)
+	}
+	if len(c.Logs) != 1 || !strings.HasSuffix(c.Logs[0], "panic: ecs/app/crashed") {
+		t.Errorf("unexpected logs: %v", c.Logs)
+	}
+}
+
+func TestDiagnoseFailedDeploymentSkipsCodeDeploy(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("AWS_REGION", "ap-northeast-1")
+	app, err := ecspresso.New(ctx, &ecspresso.CLIOptions{ConfigFilePath: "tests/ecspresso.yml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv := &ecspresso.Service{}
+	sv.DeploymentController = &types.DeploymentController{Type: types.DeploymentControllerTypeCodeDeploy}
+	path := filepath.Join(t.TempDir(), "diagnostics.json")
+	app.DiagnoseFailedDeployment(ctx, sv, diagnosticsNewTdArn, errors.New("deployment failed"), path)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("diagnostics must not be saved for CodeDeploy: %v", err)
+	}
+}
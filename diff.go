@@ -28,7 +28,7 @@ func (d *App) Diff(ctx context.Context, opt DiffOption) error {
 	ctx, cancel := d.Start(ctx)
 	defer cancel()
 
-	var remoteTaskDefArn string
+	var remoteTaskDefArn, serviceDiff string
 	// diff for services only when service defined
 	if d.config.Service != "" {
 		d.Log("[DEBUG] diff service compare with %s", d.config.Service)
@@ -48,6 +48,7 @@ func (d *App) Diff(ctx context.Context, opt DiffOption) error {
 			return err
 		} else if ds != "" {
 			fmt.Print(coloredDiff(ds))
+			serviceDiff = ds
 		}
 		if remoteSv != nil {
 			remoteTaskDefArn = *remoteSv.TaskDefinition
@@ -79,12 +80,24 @@ func (d *App) Diff(ctx context.Context, opt DiffOption) error {
 		}
 	}
 
-	if ds, err := diffTaskDefs(newTd, remoteTd, d.config.TaskDefinitionPath, remoteTaskDefArn, opt.Unified); err != nil {
+	ds, err := diffTaskDefs(newTd, remoteTd, d.config.TaskDefinitionPath, remoteTaskDefArn, opt.Unified)
+	if err != nil {
 		return err
-	} else if ds != "" {
+	}
+	if ds != "" {
 		fmt.Print(coloredDiff(ds))
 	}
 
+	// schedules
+	scheduleDiffs, err := d.scheduleDiffs(ctx, opt.Unified)
+	if err != nil {
+		return err
+	}
+	for _, sd := range scheduleDiffs {
+		fmt.Print(coloredDiff(sd))
+	}
+	d.summarizeDiff(serviceDiff, ds)
+
 	return nil
 }
 
@@ -233,6 +246,10 @@ func ServiceDefinitionForDiff(sv *Service) *ServiceForDiff {
 				Rollback: false,
 			}
 		}
+		if dc := sv.DeploymentConfiguration; dc.Strategy == "" || dc.Strategy == types.DeploymentStrategyRolling {
+			dc.Strategy = types.DeploymentStrategyRolling
+			dc.BakeTimeInMinutes = nil // bake time works with blue/green, linear and canary only
+		}
 	} else if sv.SchedulingStrategy == types.SchedulingStrategyDaemon && sv.DeploymentConfiguration == nil {
 		sv.DeploymentConfiguration = &types.DeploymentConfiguration{
 			MaximumPercent:        aws.Int32(100),
@@ -16,16 +16,19 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/applicationautoscaling"
 	aasTypes "github.com/aws/aws-sdk-go-v2/service/applicationautoscaling/types"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
 	"github.com/aws/aws-sdk-go-v2/service/codedeploy"
 	"github.com/aws/aws-sdk-go-v2/service/ecs"
 	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
 	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/scheduler"
 	"github.com/aws/aws-sdk-go-v2/service/servicediscovery"
 	"github.com/aws/smithy-go"
 	"github.com/goccy/go-yaml"
 	"github.com/samber/lo"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const DefaultDesiredCount = -1
@@ -64,6 +67,11 @@ func (d *App) newServiceFromTypes(ctx context.Context, in types.Service) (*Servi
 		// CodeDeploy does not support ServiceConnectConfiguration and VolumeConfigurations
 		return &sv, nil
 	}
+	if sv.isExternal() {
+		// the service has no deployments. task sets have the attributes instead.
+		sv.applyPrimaryTaskSet()
+		return &sv, nil
+	}
 	if len(dps) == 0 {
 		d.Log("[WARNING] no primary deployment")
 		return &sv, nil
@@ -114,10 +122,14 @@ type App struct {
 	autoScaling *applicationautoscaling.Client
 	codedeploy  *codedeploy.Client
 	cwl         *cloudwatchlogs.Client
+	cw          *cloudwatch.Client
 	iam         *iam.Client
 	elbv2       *elasticloadbalancingv2.Client
 	sd          *servicediscovery.Client
+	scheduler   *scheduler.Client
 	verifier    *verifier
+	events      *eventEmitter
+	summary     *stepSummary
 
 	config *Config
 	loader *configLoader
@@ -171,11 +183,13 @@ func New(ctx context.Context, opt *CLIOptions, newAppOptions ...AppOption) (*App
 
 	// load config file
 	if appOpts.config == nil {
-		if config, err := appOpts.loader.Load(ctx, opt.ConfigFilePath, Version); err != nil {
+		spanCtx, span := startSpan(ctx, "load config", attribute.String("ecspresso.config", opt.ConfigFilePath))
+		config, err := appOpts.loader.Load(spanCtx, opt.ConfigFilePath, Version)
+		endSpan(span, err)
+		if err != nil {
 			return nil, fmt.Errorf("failed to load config file %s: %w", opt.ConfigFilePath, err)
-		} else {
-			appOpts.config = config
 		}
+		appOpts.config = config
 	}
 	conf := appOpts.config
 	conf.OverrideByCLIOptions(opt)
@@ -190,14 +204,25 @@ func New(ctx context.Context, opt *CLIOptions, newAppOptions ...AppOption) (*App
 		autoScaling: applicationautoscaling.NewFromConfig(conf.awsv2Config),
 		codedeploy:  codedeploy.NewFromConfig(conf.awsv2Config),
 		cwl:         cloudwatchlogs.NewFromConfig(conf.awsv2Config),
+		cw:          cloudwatch.NewFromConfig(conf.awsv2Config),
 		iam:         iam.NewFromConfig(conf.awsv2Config),
 		elbv2:       elasticloadbalancingv2.NewFromConfig(conf.awsv2Config),
 		sd:          servicediscovery.NewFromConfig(conf.awsv2Config),
+		scheduler:   scheduler.NewFromConfig(conf.awsv2Config),
 		loader:      appOpts.loader,
 		config:      appOpts.config,
 		logger:      appOpts.logger,
 	}
 
+	if opt.OutputEvents == OutputEventsJSONL {
+		d.events = newEventEmitter(os.Stdout)
+	}
+	summaryFile := opt.SummaryFile
+	if summaryFile == "" {
+		summaryFile = os.Getenv(envGitHubStepSummary)
+	}
+	d.summary = newStepSummary(summaryFile, os.Getenv(envGitHubOutput))
+
 	d.Log("[DEBUG] config file path: %s", opt.ConfigFilePath)
 	d.Log("[DEBUG] timeout: %s", d.config.Timeout)
 	return d, nil
@@ -260,46 +285,56 @@ func (d *App) DescribeService(ctx context.Context) (*Service, error) {
 	default:
 		d.Log("[DEBUG] service %s is %s", d.Service, status)
 	}
-	return d.newServiceFromTypes(ctx, out.Services[0])
+	sv, err := d.newServiceFromTypes(ctx, out.Services[0])
+	if err != nil {
+		return nil, err
+	}
+	sv.Tags = d.excludeLockTags(sv.Tags)
+	return sv, nil
 }
 
 func (d *App) DescribeServiceStatus(ctx context.Context, events int) (*Service, error) {
-	s, err := d.DescribeService(ctx)
+	s, st, err := d.describeServiceStatus(ctx, events)
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println("Service:", *s.ServiceName)
-	fmt.Println("Cluster:", arnToName(*s.ClusterArn))
-	fmt.Println("TaskDefinition:", arnToName(*s.TaskDefinition))
-	if len(s.Deployments) > 0 {
-		fmt.Println("Deployments:")
-		for _, dep := range s.Deployments {
-			fmt.Println(spcIndent + formatDeployment(dep))
-		}
-	}
-	if len(s.TaskSets) > 0 {
-		fmt.Println("TaskSets:")
-		for _, ts := range s.TaskSets {
-			fmt.Println(spcIndent + formatTaskSet(ts))
-		}
+	if err := st.OutputTable(d.humanOutput()); err != nil {
+		return nil, err
 	}
+	return s, nil
+}
 
-	if err := d.describeAutoScaling(ctx, s); err != nil {
-		return nil, fmt.Errorf("failed to describe autoscaling: %w", err)
+// describeServiceStatus returns the service and its status with the last events.
+func (d *App) describeServiceStatus(ctx context.Context, events int) (*Service, *ServiceStatus, error) {
+	s, err := d.DescribeService(ctx)
+	if err != nil {
+		return nil, nil, err
 	}
-
-	fmt.Println("Events:")
-	sort.SliceStable(s.Events, func(i, j int) bool {
-		return s.Events[i].CreatedAt.Before(*s.Events[j].CreatedAt)
-	})
-	head := lo.Max([]int{len(s.Events) - events, 0})
-	for i := head; i < len(s.Events); i++ {
-		fmt.Println(formatEvent(s.Events[i]))
+	st := &ServiceStatus{
+		Service:        aws.ToString(s.ServiceName),
+		Cluster:        arnToName(aws.ToString(s.ClusterArn)),
+		TaskDefinition: arnToName(aws.ToString(s.TaskDefinition)),
+		Deployments:    s.Deployments,
+		TaskSets:       s.TaskSets,
 	}
-	return s, nil
+	if st.AutoScaling, err = d.describeAutoScaling(ctx, s); err != nil {
+		return nil, nil, fmt.Errorf("failed to describe autoscaling: %w", err)
+	}
+	if st.Targets, err = d.describeTargetHealth(ctx, s); err != nil {
+		d.Log("[WARNING] %s", err)
+	}
+	st.Events = append(st.Events, s.Events...)
+	sort.SliceStable(st.Events, func(i, j int) bool {
+		return st.Events[i].CreatedAt.Before(*st.Events[j].CreatedAt)
+	})
+	head := lo.Max([]int{len(st.Events) - events, 0})
+	st.Events = st.Events[head:]
+	return s, st, nil
 }
 
-func (d *App) describeAutoScaling(ctx context.Context, s *Service) error {
+// describeAutoScaling returns the scalable targets and the scaling policies of the service.
+// It returns nil when the service is not a scalable target.
+func (d *App) describeAutoScaling(ctx context.Context, s *Service) (*AutoScalingStatus, error) {
 	resourceId := fmt.Sprintf("service/%s/%s", arnToName(*s.ClusterArn), *s.ServiceName)
 	tout, err := d.autoScaling.DescribeScalableTargets(
 		ctx,
@@ -313,18 +348,14 @@ func (d *App) describeAutoScaling(ctx context.Context, s *Service) error {
 		var oe *smithy.OperationError
 		if errors.As(err, &oe) {
 			d.Log("[WARNING] failed to describe scalable targets: %s", oe)
-			return nil
+			return nil, nil
 		}
-		return fmt.Errorf("failed to describe scalable targets: %w", err)
+		return nil, fmt.Errorf("failed to describe scalable targets: %w", err)
 	}
 	if len(tout.ScalableTargets) == 0 {
-		return nil
-	}
-
-	fmt.Println("AutoScaling:")
-	for _, target := range tout.ScalableTargets {
-		fmt.Println(formatScalableTarget(target))
+		return nil, nil
 	}
+	as := &AutoScalingStatus{ResourceID: resourceId, Targets: tout.ScalableTargets}
 
 	pout, err := d.autoScaling.DescribeScalingPolicies(
 		ctx,
@@ -338,14 +369,12 @@ func (d *App) describeAutoScaling(ctx context.Context, s *Service) error {
 		var oe *smithy.OperationError
 		if errors.As(err, &oe) {
 			d.Log("[WARNING] failed to describe scaling policies: %s", oe)
-			return nil
+			return as, nil
 		}
-		return fmt.Errorf("failed to describe scaling policies: %w", err)
-	}
-	for _, policy := range pout.ScalingPolicies {
-		fmt.Println(formatScalingPolicy(policy))
+		return nil, fmt.Errorf("failed to describe scaling policies: %w", err)
 	}
-	return nil
+	as.Policies = pout.ScalingPolicies
+	return as, nil
 }
 
 func (d *App) DescribeTaskStatus(ctx context.Context, task *types.Task, watchContainer *types.ContainerDefinition) error {
@@ -359,7 +388,11 @@ func (d *App) DescribeTaskStatus(ctx context.Context, task *types.Task, watchCon
 		return fmt.Errorf(*f.Reason)
 	}
 
-	ts := out.Tasks[0]
+	return taskExitError(out.Tasks[0], watchContainer)
+}
+
+// taskExitError returns an error when the task failed to start or the watch container exited abnormally.
+func taskExitError(ts types.Task, watchContainer *types.ContainerDefinition) error {
 	if ts.StopCode == types.TaskStopCodeTaskFailedToStart {
 		return fmt.Errorf("task failed to start: %s", aws.ToString(ts.StoppedReason))
 	}
@@ -408,7 +441,8 @@ func (d *App) GetLogEvents(ctx context.Context, logGroup string, logStream strin
 		return nextToken, nil
 	}
 	for _, event := range out.Events {
-		fmt.Println(formatLogEvent(event))
+		fmt.Fprintln(d.humanOutput(), formatLogEvent(event))
+		d.emitEvent(logEvent(logGroup, logStream, event))
 	}
 	return out.NextForwardToken, nil
 }
@@ -447,8 +481,11 @@ func (d *App) Name() string {
 	return fmt.Sprintf("%s/%s", d.Service, d.Cluster)
 }
 
-func (d *App) RegisterTaskDefinition(ctx context.Context, td *TaskDefinitionInput) (*TaskDefinition, error) {
+func (d *App) RegisterTaskDefinition(ctx context.Context, td *TaskDefinitionInput) (_ *TaskDefinition, err error) {
+	ctx, span := startSpan(ctx, "register task definition", attribute.String("ecspresso.task_definition.family", aws.ToString(td.Family)))
+	defer func() { endSpan(span, err) }()
 	d.Log("Registering a new task definition...")
+	d.emitPhase("register_task_definition", phaseStatusStarted, nil)
 	if len(td.Tags) == 0 {
 		td.Tags = nil // Tags can not be empty.
 	}
@@ -457,9 +494,12 @@ func (d *App) RegisterTaskDefinition(ctx context.Context, td *TaskDefinitionInpu
 		td,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to register task definition: %w", err)
+		err = fmt.Errorf("failed to register task definition: %w", err)
+		d.emitPhase("register_task_definition", phaseStatusFailed, err)
+		return nil, err
 	}
 	d.Log("Task definition is registered %s", taskDefinitionName(out.TaskDefinition))
+	d.emitPhase("register_task_definition", phaseStatusCompleted, nil)
 	return out.TaskDefinition, nil
 }
 
@@ -535,18 +575,15 @@ func (d *App) LoadServiceDefinition(path string) (*Service, error) {
 }
 
 func (d *App) GetLogInfo(task *types.Task, c *types.ContainerDefinition) (string, string) {
-	p := strings.Split(*task.TaskArn, "/")
-	taskID := p[len(p)-1]
-	lc := c.LogConfiguration
-	logStreamPrefix := lc.Options["awslogs-stream-prefix"]
-
-	logStream := strings.Join([]string{logStreamPrefix, *c.Name, taskID}, "/")
-	logGroup := lc.Options["awslogs-group"]
-
-	d.Log("logGroup: %s", logGroup)
-	d.Log("logStream: %s", logStream)
+	t, err := containerLogTarget(task, c)
+	if err != nil {
+		d.Log("[WARNING] %s", err)
+		return "", ""
+	}
+	d.Log("logGroup: %s", t.Group)
+	d.Log("logStream: %s", t.Stream)
 
-	return logGroup, logStream
+	return t.Group, t.Stream
 }
 
 func (d *App) FilterCommand() string {
@@ -18,6 +18,24 @@ func (e ErrConflictOptions) Error() string {
 	return string(e)
 }
 
+type ErrAlarm string
+
+func (e ErrAlarm) Error() string {
+	return string(e)
+}
+
+type ErrRolledBack string
+
+func (e ErrRolledBack) Error() string {
+	return string(e)
+}
+
+type ErrLocked string
+
+func (e ErrLocked) Error() string {
+	return string(e)
+}
+
 var (
 	errNotFound   = ErrNotFound("not found")
 	errSkipVerify = ErrSkipVerify("skip verify")
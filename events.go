@@ -0,0 +1,247 @@
+package ecspresso
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	logsTypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+const (
+	OutputEventsJSONL = "jsonl"
+
+	OutputEventTypePhase               = "phase"
+	OutputEventTypeServiceEvent        = "service_event"
+	OutputEventTypeDeployment          = "deployment"
+	OutputEventTypeServiceDeployment   = "service_deployment"
+	OutputEventTypeCodeDeployLifecycle = "codedeploy_lifecycle"
+	OutputEventTypeCodeDeployTraffic   = "codedeploy_traffic"
+	OutputEventTypeTaskState           = "task_state"
+	OutputEventTypeLog                 = "log"
+	OutputEventTypeTargetHealth        = "target_health"
+
+	phaseStatusStarted   = "started"
+	phaseStatusCompleted = "completed"
+	phaseStatusFailed    = "failed"
+)
+
+// OutputEvent represents an event emitted by --output-events.
+// Type determines which fields are set.
+type OutputEvent struct {
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	Cluster string    `json:"cluster"`
+	Service string    `json:"service,omitempty"`
+
+	// phase
+	Phase  string `json:"phase,omitempty"`
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+
+	// service_event, log
+	Message string `json:"message,omitempty"`
+
+	// service_event, deployment, service_deployment, codedeploy_lifecycle, codedeploy_traffic
+	ID string `json:"id,omitempty"`
+
+	// deployment
+	TaskDefinition     string `json:"task_definition,omitempty"`
+	DesiredCount       *int32 `json:"desired_count,omitempty"`
+	PendingCount       *int32 `json:"pending_count,omitempty"`
+	RunningCount       *int32 `json:"running_count,omitempty"`
+	FailedTasks        *int32 `json:"failed_tasks,omitempty"`
+	RolloutState       string `json:"rollout_state,omitempty"`
+	RolloutStateReason string `json:"rollout_state_reason,omitempty"`
+
+	// codedeploy_lifecycle
+	LifecycleEvent string `json:"lifecycle_event,omitempty"`
+
+	// service_deployment
+	LifecycleStage string `json:"lifecycle_stage,omitempty"`
+
+	// codedeploy_traffic, service_deployment
+	TaskSetLabel  string   `json:"task_set_label,omitempty"`
+	TrafficWeight *float64 `json:"traffic_weight,omitempty"`
+
+	// task_state, log
+	TaskArn       string                 `json:"task_arn,omitempty"`
+	LastStatus    string                 `json:"last_status,omitempty"`
+	DesiredStatus string                 `json:"desired_status,omitempty"`
+	StopCode      string                 `json:"stop_code,omitempty"`
+	StoppedReason string                 `json:"stopped_reason,omitempty"`
+	Containers    []OutputEventContainer `json:"containers,omitempty"`
+
+	// log
+	LogGroup  string `json:"log_group,omitempty"`
+	LogStream string `json:"log_stream,omitempty"`
+
+	// target_health
+	TargetGroupArn string `json:"target_group_arn,omitempty"`
+	Target         string `json:"target,omitempty"`
+	TaskID         string `json:"task_id,omitempty"`
+	Reason         string `json:"reason,omitempty"`
+}
+
+// OutputEventContainer represents a container state in task_state events.
+type OutputEventContainer struct {
+	Name       string `json:"name"`
+	LastStatus string `json:"last_status,omitempty"`
+	ExitCode   *int32 `json:"exit_code,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+type eventEmitter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newEventEmitter(w io.Writer) *eventEmitter {
+	return &eventEmitter{enc: json.NewEncoder(w)}
+}
+
+func (e *eventEmitter) emit(ev *OutputEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.enc.Encode(ev)
+}
+
+// emitEvent writes the event as a JSON line when --output-events is enabled.
+func (d *App) emitEvent(ev *OutputEvent) {
+	if d.events == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	ev.Cluster = d.Cluster
+	ev.Service = d.Service
+	d.events.emit(ev)
+}
+
+func (d *App) emitPhase(phase, status string, err error) {
+	ev := &OutputEvent{Type: OutputEventTypePhase, Phase: phase, Status: status}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	d.emitEvent(ev)
+}
+
+// emitPhaseResult emits the phase completed or failed by err.
+func (d *App) emitPhaseResult(phase string, err error) {
+	if err != nil {
+		d.emitPhase(phase, phaseStatusFailed, err)
+	} else {
+		d.emitPhase(phase, phaseStatusCompleted, nil)
+	}
+}
+
+// humanOutput returns the writer for human readable outputs.
+// It is STDERR when --output-events is enabled because STDOUT is used for the events.
+func (d *App) humanOutput() io.Writer {
+	if d.events != nil {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+func serviceEventEvent(e types.ServiceEvent) *OutputEvent {
+	return &OutputEvent{
+		Type:    OutputEventTypeServiceEvent,
+		Time:    aws.ToTime(e.CreatedAt),
+		ID:      aws.ToString(e.Id),
+		Message: aws.ToString(e.Message),
+	}
+}
+
+func deploymentEvent(dp types.Deployment) *OutputEvent {
+	return &OutputEvent{
+		Type:               OutputEventTypeDeployment,
+		ID:                 aws.ToString(dp.Id),
+		Status:             aws.ToString(dp.Status),
+		TaskDefinition:     aws.ToString(dp.TaskDefinition),
+		DesiredCount:       aws.Int32(dp.DesiredCount),
+		PendingCount:       aws.Int32(dp.PendingCount),
+		RunningCount:       aws.Int32(dp.RunningCount),
+		FailedTasks:        aws.Int32(dp.FailedTasks),
+		RolloutState:       string(dp.RolloutState),
+		RolloutStateReason: aws.ToString(dp.RolloutStateReason),
+	}
+}
+
+func logEvent(group, stream string, e logsTypes.OutputLogEvent) *OutputEvent {
+	return &OutputEvent{
+		Type:      OutputEventTypeLog,
+		Time:      time.UnixMilli(aws.ToInt64(e.Timestamp)),
+		LogGroup:  group,
+		LogStream: stream,
+		Message:   aws.ToString(e.Message),
+	}
+}
+
+func targetHealthEvent(th TargetHealth) *OutputEvent {
+	return &OutputEvent{
+		Type:           OutputEventTypeTargetHealth,
+		TargetGroupArn: th.TargetGroupArn,
+		Target:         th.target(),
+		TaskID:         th.TaskID,
+		Status:         th.State,
+		Reason:         th.Reason,
+		Message:        th.Description,
+	}
+}
+
+func taskStateEvent(task types.Task) *OutputEvent {
+	ev := &OutputEvent{
+		Type:           OutputEventTypeTaskState,
+		TaskArn:        aws.ToString(task.TaskArn),
+		TaskDefinition: aws.ToString(task.TaskDefinitionArn),
+		LastStatus:     aws.ToString(task.LastStatus),
+		DesiredStatus:  aws.ToString(task.DesiredStatus),
+		StopCode:       string(task.StopCode),
+		StoppedReason:  aws.ToString(task.StoppedReason),
+	}
+	for _, c := range task.Containers {
+		ev.Containers = append(ev.Containers, OutputEventContainer{
+			Name:       aws.ToString(c.Name),
+			LastStatus: aws.ToString(c.LastStatus),
+			ExitCode:   c.ExitCode,
+			Reason:     aws.ToString(c.Reason),
+		})
+	}
+	return ev
+}
+
+// taskStateTracker tracks the states of tasks to emit the changes only.
+type taskStateTracker struct {
+	mu     sync.Mutex
+	states map[string]string
+}
+
+func newTaskStateTracker() *taskStateTracker {
+	return &taskStateTracker{states: map[string]string{}}
+}
+
+// changes returns the events of tasks whose state has been changed since the last call.
+func (t *taskStateTracker) changes(tasks []types.Task) []*OutputEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var evs []*OutputEvent
+	for _, task := range tasks {
+		arn := aws.ToString(task.TaskArn)
+		state := aws.ToString(task.LastStatus) + "/" + aws.ToString(task.DesiredStatus)
+		for _, c := range task.Containers {
+			state += "/" + aws.ToString(c.LastStatus)
+		}
+		if t.states[arn] == state {
+			continue
+		}
+		t.states[arn] = state
+		evs = append(evs, taskStateEvent(task))
+	}
+	return evs
+}
@@ -0,0 +1,203 @@
+package ecspresso_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/google/go-cmp/cmp"
+	"github.com/kayac/ecspresso/v2"
+)
+
+func decodeEvents(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var evs []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		ev := map[string]any{}
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			t.Fatalf("invalid JSON line: %s", line)
+		}
+		delete(ev, "time")
+		evs = append(evs, ev)
+	}
+	return evs
+}
+
+func TestOutputEvents(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("AWS_REGION", "ap-northeast-1")
+	app, err := ecspresso.New(ctx, &ecspresso.CLIOptions{ConfigFilePath: "tests/ecspresso.yml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	app.SetEventsOutput(&buf)
+
+	app.EmitDeploymentEvent(types.Deployment{
+		Id:             aws.String("ecs-svc/123"),
+		Status:         aws.String("PRIMARY"),
+		TaskDefinition: aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:2"),
+		DesiredCount:   2,
+		RunningCount:   1,
+		RolloutState:   types.DeploymentRolloutStateInProgress,
+	})
+
+	tracker := ecspresso.NewTaskStateTracker()
+	task := types.Task{
+		TaskArn:       aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task/default/abc"),
+		LastStatus:    aws.String("PENDING"),
+		DesiredStatus: aws.String("RUNNING"),
+		Containers: []types.Container{
+			{Name: aws.String("app"), LastStatus: aws.String("PENDING")},
+		},
+	}
+	app.EmitTaskStateChanges(tracker, []types.Task{task})
+	app.EmitTaskStateChanges(tracker, []types.Task{task}) // not changed
+	task.LastStatus = aws.String("STOPPED")
+	task.DesiredStatus = aws.String("STOPPED")
+	task.Containers[0].LastStatus = aws.String("STOPPED")
+	task.Containers[0].ExitCode = aws.Int32(1)
+	app.EmitTaskStateChanges(tracker, []types.Task{task})
+
+	expected := []map[string]any{
+		{
+			"type":            "deployment",
+			"cluster":         "default",
+			"service":         "test",
+			"id":              "ecs-svc/123",
+			"status":          "PRIMARY",
+			"task_definition": "arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:2",
+			"desired_count":   float64(2),
+			"pending_count":   float64(0),
+			"running_count":   float64(1),
+			"failed_tasks":    float64(0),
+			"rollout_state":   "IN_PROGRESS",
+		},
+		{
+			"type":           "task_state",
+			"cluster":        "default",
+			"service":        "test",
+			"task_arn":       "arn:aws:ecs:ap-northeast-1:123456789012:task/default/abc",
+			"last_status":    "PENDING",
+			"desired_status": "RUNNING",
+			"containers": []any{
+				map[string]any{"name": "app", "last_status": "PENDING"},
+			},
+		},
+		{
+			"type":           "task_state",
+			"cluster":        "default",
+			"service":        "test",
+			"task_arn":       "arn:aws:ecs:ap-northeast-1:123456789012:task/default/abc",
+			"last_status":    "STOPPED",
+			"desired_status": "STOPPED",
+			"containers": []any{
+				map[string]any{"name": "app", "last_status": "STOPPED", "exit_code": float64(1)},
+			},
+		},
+	}
+	if diff := cmp.Diff(expected, decodeEvents(t, &buf)); diff != "" {
+		t.Errorf("unexpected events: %s", diff)
+	}
+}
+
+func TestDeployOutputEventsJSONL(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("AWS_REGION", "ap-northeast-1")
+	t.Setenv("GITHUB_STEP_SUMMARY", "")
+	t.Setenv("GITHUB_OUTPUT", "")
+	ecspresso.SetDelayForServiceChanged(0)
+	defer ecspresso.SetDelayForServiceChanged(3 * time.Second)
+	const tdArn = "arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:1"
+	ecspresso.SetAWSV2ConfigLoadOptionsFunc([]func(*config.LoadOptions) error{
+		config.WithRegion("ap-northeast-1"),
+		config.WithAPIOptions([]func(*middleware.Stack) error{
+			func(stack *middleware.Stack) error {
+				return stack.Initialize.Add(
+					middleware.InitializeMiddlewareFunc(
+						"test",
+						func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+							var out any
+							sv := types.Service{
+								ServiceName:    aws.String("test"),
+								ClusterArn:     aws.String("arn:aws:ecs:ap-northeast-1:123456789012:cluster/default"),
+								Status:         aws.String("ACTIVE"),
+								TaskDefinition: aws.String(tdArn),
+								DesiredCount:   1,
+								Deployments: []types.Deployment{
+									{Id: aws.String("ecs-svc/1"), Status: aws.String("PRIMARY"), TaskDefinition: aws.String(tdArn), DesiredCount: 1, RunningCount: 1},
+								},
+							}
+							switch in.Parameters.(type) {
+							case *ecs.DescribeServicesInput:
+								out = &ecs.DescribeServicesOutput{Services: []types.Service{sv}}
+							case *ecs.UpdateServiceInput:
+								out = &ecs.UpdateServiceOutput{Service: &sv}
+							case *applicationautoscaling.DescribeScalableTargetsInput:
+								out = &applicationautoscaling.DescribeScalableTargetsOutput{}
+							default:
+								return middleware.InitializeOutput{}, middleware.Metadata{}, fmt.Errorf("unexpected call %T", in.Parameters)
+							}
+							return middleware.InitializeOutput{Result: out}, middleware.Metadata{}, nil
+						},
+					),
+					middleware.Before,
+				)
+			},
+		}),
+	})
+	defer ecspresso.ResetAWSV2ConfigLoadOptionsFunc()
+
+	// events are written to os.Stdout
+	stdout, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdout.Close()
+	orig := os.Stdout
+	os.Stdout = stdout
+	defer func() { os.Stdout = orig }()
+
+	app, err := ecspresso.New(ctx, &ecspresso.CLIOptions{ConfigFilePath: "tests/ecspresso.yml", OutputEvents: "jsonl"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Deploy(ctx, ecspresso.DeployOption{
+		SkipTaskDefinition: true,
+		UpdateService:      false,
+		Wait:               false,
+		DesiredCount:       aws.Int32(ecspresso.DefaultDesiredCount),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = orig
+
+	b, err := os.ReadFile(stdout.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	for _, line := range lines {
+		if !json.Valid([]byte(line)) {
+			t.Errorf("stdout must be JSON lines: %q", line)
+		}
+	}
+	if !strings.Contains(string(b), `"phase":"update_service"`) {
+		t.Errorf("update_service phase event is not emitted: %s", b)
+	}
+}
@@ -2,9 +2,14 @@ package ecspresso
 
 import (
 	"context"
+	"io"
 	"log"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/goccy/go-yaml"
 )
 
 var (
@@ -22,12 +27,38 @@ var (
 	NewVerifier        = newVerifier
 	ArnToName          = arnToName
 	InitVerifyState    = initVerifyState
-	VerifyResource     = verifyResource
 	Map2str            = map2str
 	DiffServices       = diffServices
 	DiffTaskDefs       = diffTaskDefs
+	LoadStack          = loadStack
+	FailedRollout      = failedRollout
+	RolledBackRollout  = rolledBackRollout
 )
 
+// ContainerLogGroupStream returns the log group and stream of the container resolved by containerLogTarget.
+func ContainerLogGroupStream(task *types.Task, c *types.ContainerDefinition) (string, string, error) {
+	t, err := containerLogTarget(task, c)
+	return t.Group, t.Stream, err
+}
+
+type LogGroupCursor = logGroupCursor
+
+var NewLogGroupCursor = newLogGroupCursor
+
+// FilterLogEventMessages returns the messages of the log events of the streams in the group after the cursor.
+func (d *App) FilterLogEventMessages(ctx context.Context, group string, streams []string, cursor *LogGroupCursor) ([]string, error) {
+	targets := map[string]logTarget{}
+	for _, s := range streams {
+		targets[s] = logTarget{Group: group, Stream: s}
+	}
+	events, err := d.filterLogEvents(ctx, group, targets, cursor, "")
+	var messages []string
+	for _, ev := range events {
+		messages = append(messages, aws.ToString(ev.event.Message))
+	}
+	return messages, err
+}
+
 type ModifyAutoScalingParams = modifyAutoScalingParams
 
 func (d *App) SetLogger(logger *log.Logger) {
@@ -49,3 +80,224 @@ func ResetAWSV2ConfigLoadOptionsFunc() {
 func (d *App) TaskDefinitionArnForRun(ctx context.Context, opt RunOption) (string, error) {
 	return d.taskDefinitionArnForRun(ctx, opt)
 }
+
+func (o *StackOption) Validate() error {
+	return o.validate()
+}
+
+// RunStackParallel runs fn for each service in the stack and returns the errors by service name.
+func RunStackParallel(ctx context.Context, st *Stack, maxParallel int, fn func(name string) error) map[string]error {
+	apps := make(map[string]*App, len(st.Services))
+	names := make(map[*App]string, len(st.Services))
+	for name := range st.Services {
+		app := &App{Service: name}
+		apps[name] = app
+		names[app] = name
+	}
+	results := st.runParallel(ctx, apps, maxParallel, func(ctx context.Context, app *App) error {
+		return fn(names[app])
+	})
+	errs := make(map[string]error, len(results))
+	for name, r := range results {
+		errs[name] = r.err
+	}
+	return errs
+}
+
+// CanarySteps returns the desired counts and pauses of canary steps.
+func CanarySteps(c *ConfigCanary, desired int32) ([]int32, []time.Duration) {
+	var counts []int32
+	var pauses []time.Duration
+	for _, s := range canarySteps(c, desired) {
+		counts = append(counts, s.count)
+		pauses = append(pauses, s.pause)
+	}
+	return counts, pauses
+}
+
+var (
+	LoadDeployPlan      = loadDeployPlan
+	ServiceFingerprints = serviceFingerprints
+)
+
+func (p *DeployPlan) CheckDrift(sv *Service) error {
+	return p.checkDrift(sv)
+}
+
+func (p *DeployPlan) TaskDefinitionInput() (*TaskDefinitionInput, error) {
+	return p.taskDefinition()
+}
+
+func (p *DeployPlan) ServiceDefinitionInput() (*Service, error) {
+	return p.serviceDefinition()
+}
+
+func (h *ConfigHook) TaskOverride() *types.TaskOverride {
+	return h.taskOverride()
+}
+
+func (d *App) WatchAlarms(ctx context.Context, duration time.Duration) error {
+	return d.watchAlarms(ctx, duration)
+}
+
+func SetAlarmCheckInterval(d time.Duration) {
+	alarmCheckInterval = d
+}
+
+func (d *App) AcquireLock(ctx context.Context, operation string) (func(), error) {
+	return d.lock(ctx, operation)
+}
+
+var DiffSummary = diffSummary
+
+func (d *App) PutHistoryRecord(ctx context.Context, rec *HistoryRecord) error {
+	sink, err := d.newHistorySink()
+	if err != nil {
+		return err
+	}
+	return sink.put(ctx, rec)
+}
+
+func (d *App) ListHistoryRecords(ctx context.Context, limit int) ([]*HistoryRecord, error) {
+	sink, err := d.newHistorySink()
+	if err != nil {
+		return nil, err
+	}
+	return sink.list(ctx, limit)
+}
+
+func (d *App) GetHistoryRecord(ctx context.Context, id string) (*HistoryRecord, error) {
+	sink, err := d.newHistorySink()
+	if err != nil {
+		return nil, err
+	}
+	return sink.get(ctx, id)
+}
+
+func (d *App) Notify(ctx context.Context, operation, tdArn, event string, cause error) {
+	ctx = d.withNotification(ctx, operation)
+	setNotificationTaskDefinition(ctx, tdArn)
+	d.notify(ctx, event, cause)
+}
+
+func (n *Notification) SNSSubject() string {
+	return n.snsSubject()
+}
+
+func (d *App) SetEventsOutput(w io.Writer) {
+	d.events = newEventEmitter(w)
+}
+
+func (d *App) EmitDeploymentEvent(dp types.Deployment) {
+	d.emitEvent(deploymentEvent(dp))
+}
+
+func (d *App) EmitTaskStateChanges(t *TaskStateTracker, tasks []types.Task) {
+	for _, ev := range t.changes(tasks) {
+		d.emitEvent(ev)
+	}
+}
+
+type TaskStateTracker = taskStateTracker
+
+var NewTaskStateTracker = newTaskStateTracker
+
+func (d *App) SetSummary(path, outputPath string) {
+	d.summary = newStepSummary(path, outputPath)
+}
+
+func (d *App) SummarizeDiff(serviceDiff, taskDefinitionDiff string) {
+	d.summarizeDiff(serviceDiff, taskDefinitionDiff)
+}
+
+func (d *App) SummarizeVerify(tree []string, err error) {
+	d.summarizeVerify(tree, err)
+}
+
+func (d *App) SetOutputs(outputs map[string]string) {
+	d.setOutputs(outputs)
+}
+
+type ImageChange = imageChange
+
+var ImageChanges = imageChanges
+
+var SetupTracing = setupTracing
+
+func SetTaskSetCheckInterval(d time.Duration) {
+	taskSetCheckInterval = d
+}
+
+func (d *App) RollbackTarget(ctx context.Context, sv *Service, currentArn string, opt RollbackOption) (string, error) {
+	return d.rollbackTarget(ctx, sv, currentArn, opt)
+}
+
+func SetStdinTerminal(b bool) {
+	isStdinTerminal = func() bool { return b }
+}
+
+func (d *App) DiagnoseFailedDeployment(ctx context.Context, sv *Service, tdArn string, cause error, path string) {
+	d.diagnoseFailedDeployment(ctx, sv, tdArn, cause, path)
+}
+
+type StatusDashboard = statusDashboard
+
+func (d *App) StatusDashboard(ctx context.Context) (*StatusDashboard, error) {
+	return d.statusDashboard(ctx)
+}
+
+func (db *StatusDashboard) RenderChanges(w io.Writer, prev *StatusDashboard) {
+	db.renderChanges(w, prev)
+}
+
+func (d *App) ShowTargetHealth(ctx context.Context, sv *Service, states map[string]string) error {
+	return d.showTargetHealth(ctx, sv, states)
+}
+
+func SetRunTasksIntervals(poll, retry time.Duration) {
+	runTasksPollInterval = poll
+	runTaskRetryInterval = retry
+}
+
+func (d *App) RunTasks(ctx context.Context, tdArn string, opt RunOption) error {
+	return d.runTasks(ctx, tdArn, &types.TaskOverride{}, opt, &types.ContainerDefinition{Name: aws.String("app")})
+}
+
+func (d *App) DeploySchedules(ctx context.Context, tdArn string, dryRun bool) error {
+	return d.deploySchedules(ctx, tdArn, dryRun)
+}
+
+var (
+	KeepAliveOverride = keepAliveOverride
+	ValidateKeepAlive = validateKeepAlive
+)
+
+func SetExecAgentPollInterval(d time.Duration) {
+	execAgentPollInterval = d
+}
+
+func (d *App) WaitExecuteCommandAgent(ctx context.Context, task *types.Task, container string) error {
+	return d.waitExecuteCommandAgent(ctx, task, container)
+}
+
+func (d *App) RenderComposeYAML(ctx context.Context, td *TaskDefinitionInput, opt RenderOption) (string, error) {
+	p, err := d.composeProject(ctx, td, opt)
+	if err != nil {
+		return "", err
+	}
+	b, err := yaml.Marshal(p)
+	return string(b), err
+}
+
+func (d *App) AbortCanary(name, prevTdArn string, sv *Service) {
+	d.abortCanary(name, prevTdArn, sv)
+}
+
+func SetDelayForServiceChanged(d time.Duration) {
+	delayForServiceChanged = d
+}
+
+func VerifyResource(ctx context.Context, name string, verifyFunc func(context.Context) error) error {
+	d := &App{verifier: &verifier{}}
+	return d.verifyResource(ctx, name, verifyFunc)
+}
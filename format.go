@@ -67,3 +67,11 @@ func formatScalableTarget(t aasTypes.ScalableTarget) string {
 func formatScalingPolicy(p aasTypes.ScalingPolicy) string {
 	return fmt.Sprintf("  Policy name:%s type:%s", *p.PolicyName, p.PolicyType)
 }
+
+func formatScalingActivity(a aasTypes.ScalingActivity) string {
+	return fmt.Sprintf("%s %s %s",
+		aws.ToTime(a.StartTime).In(time.Local).Format(EventTimeFormat),
+		a.StatusCode,
+		aws.ToString(a.Description),
+	)
+}
@@ -0,0 +1,652 @@
+package ecspresso
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	cwlTypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/olekukonko/tablewriter"
+	"github.com/samber/lo"
+)
+
+const (
+	historySinkFile           = "file"
+	historySinkS3             = "s3"
+	historySinkCloudWatchLogs = "cloudwatch_logs"
+
+	historyOperationDeploy   = "deploy"
+	historyOperationRollback = "rollback"
+
+	HistoryOutcomeSucceeded  = "succeeded"
+	HistoryOutcomeFailed     = "failed"
+	HistoryOutcomeRolledBack = "rolled_back"
+)
+
+type HistoryOption struct {
+	ID     string `help:"show the record of the ID" default:""`
+	Limit  int    `help:"max number of records to list" default:"20"`
+	Output string `help:"output format (json, table, tsv)" default:"table" enum:"json,table,tsv"`
+}
+
+// ConfigHistory represents a sink of deployment history records.
+type ConfigHistory struct {
+	Sink      string `yaml:"sink" json:"sink"`
+	Path      string `yaml:"path,omitempty" json:"path,omitempty"`
+	Bucket    string `yaml:"bucket,omitempty" json:"bucket,omitempty"`
+	KeyPrefix string `yaml:"key_prefix,omitempty" json:"key_prefix,omitempty"`
+	LogGroup  string `yaml:"log_group,omitempty" json:"log_group,omitempty"`
+	LogStream string `yaml:"log_stream,omitempty" json:"log_stream,omitempty"`
+}
+
+func (c *ConfigHistory) validate() error {
+	switch c.Sink {
+	case historySinkFile:
+		if c.Path == "" {
+			return errors.New("history.path is required for file sink")
+		}
+	case historySinkS3:
+		if c.Bucket == "" {
+			return errors.New("history.bucket is required for s3 sink")
+		}
+	case historySinkCloudWatchLogs:
+		if c.LogGroup == "" {
+			return errors.New("history.log_group is required for cloudwatch_logs sink")
+		}
+	default:
+		return fmt.Errorf("unsupported history.sink: %s (file, s3 or cloudwatch_logs)", c.Sink)
+	}
+	return nil
+}
+
+// HistoryRecord represents a record of a deployment or a rollback.
+type HistoryRecord struct {
+	ID                        string         `json:"id"`
+	Operation                 string         `json:"operation"`
+	Region                    string         `json:"region"`
+	Cluster                   string         `json:"cluster"`
+	Service                   string         `json:"service"`
+	Identity                  string         `json:"identity,omitempty"`
+	TaskDefinitionArn         string         `json:"task_definition_arn,omitempty"`
+	PreviousTaskDefinitionArn string         `json:"previous_task_definition_arn,omitempty"`
+	Images                    []HistoryImage `json:"images,omitempty"`
+	DiffSummary               string         `json:"diff_summary,omitempty"`
+	Outcome                   string         `json:"outcome"`
+	Error                     string         `json:"error,omitempty"`
+	StartedAt                 time.Time      `json:"started_at"`
+	FinishedAt                time.Time      `json:"finished_at"`
+	Duration                  string         `json:"duration"`
+}
+
+// HistoryImage represents a container image deployed.
+type HistoryImage struct {
+	Container string `json:"container"`
+	Image     string `json:"image"`
+	Digest    string `json:"digest,omitempty"`
+}
+
+func (r *HistoryRecord) Cols() []string {
+	return []string{
+		r.ID,
+		r.StartedAt.In(time.Local).Format(time.RFC3339),
+		r.Operation,
+		r.Outcome,
+		arnToName(r.TaskDefinitionArn),
+		identityName(r.Identity),
+		r.Duration,
+	}
+}
+
+// identityName returns the resource part of the identity ARN (e.g. assumed-role/role-name/session-name).
+func identityName(s string) string {
+	if a, err := arn.Parse(s); err == nil {
+		return a.Resource
+	}
+	return s
+}
+
+// addDiffSummary adds a summary of the diff to the record.
+func (r *HistoryRecord) addDiffSummary(s string) {
+	if s == "" {
+		return
+	}
+	if r.DiffSummary != "" {
+		r.DiffSummary += ", "
+	}
+	r.DiffSummary += s
+}
+
+// diffSummary returns a summary of the unified diff as "+N -M lines".
+func diffSummary(ds string) string {
+	var added, deleted int
+	for _, line := range strings.Split(ds, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+		case strings.HasPrefix(line, "+"):
+			added++
+		case strings.HasPrefix(line, "-"):
+			deleted++
+		}
+	}
+	return fmt.Sprintf("+%d -%d lines", added, deleted)
+}
+
+type historyRecords []*HistoryRecord
+
+func (recs historyRecords) Header() []string {
+	return []string{"ID", "Started At", "Operation", "Outcome", "Task Definition", "Identity", "Duration"}
+}
+
+func (recs historyRecords) OutputJSON(w io.Writer) error {
+	for _, r := range recs {
+		b, err := MarshalJSONForAPI(r)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (recs historyRecords) OutputTSV(w io.Writer) error {
+	for _, r := range recs {
+		if _, err := fmt.Fprintln(w, strings.Join(r.Cols(), "\t")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (recs historyRecords) OutputTable(w io.Writer) error {
+	t := tablewriter.NewWriter(w)
+	t.SetHeader(recs.Header())
+	t.SetBorders(tablewriter.Border{Left: true, Top: false, Right: true, Bottom: false})
+	for _, r := range recs {
+		t.Append(r.Cols())
+	}
+	t.Render()
+	return nil
+}
+
+type historySink interface {
+	put(ctx context.Context, rec *HistoryRecord) error
+	// list returns the records newest first. limit 0 means all records.
+	list(ctx context.Context, limit int) ([]*HistoryRecord, error)
+	get(ctx context.Context, id string) (*HistoryRecord, error)
+}
+
+func (d *App) newHistorySink() (historySink, error) {
+	c := d.config.History
+	switch c.Sink {
+	case historySinkFile:
+		return &fileHistorySink{path: c.Path, cluster: d.Cluster, service: d.Service}, nil
+	case historySinkS3:
+		return &s3HistorySink{
+			client: s3.NewFromConfig(d.config.awsv2Config),
+			bucket: c.Bucket,
+			prefix: c.KeyPrefix + d.Cluster + "/" + d.Service + "/",
+		}, nil
+	case historySinkCloudWatchLogs:
+		stream := c.LogStream
+		if stream == "" {
+			stream = d.Cluster + "/" + d.Service
+		}
+		return &cloudWatchLogsHistorySink{client: d.cwl, group: c.LogGroup, stream: stream}, nil
+	}
+	return nil, fmt.Errorf("unsupported history sink: %s", c.Sink)
+}
+
+// newHistoryRecord returns a new record of the operation. It returns nil when the history is not configured.
+func (d *App) newHistoryRecord(operation string) *HistoryRecord {
+	if d.config.History == nil {
+		return nil
+	}
+	return &HistoryRecord{
+		ID:        newRandomID(),
+		Operation: operation,
+		Region:    d.config.Region,
+		Cluster:   d.Cluster,
+		Service:   d.Service,
+		StartedAt: time.Now(),
+	}
+}
+
+// recordHistory completes the record by the result of the operation and writes it to the sink.
+// Failures of recording are logged as warnings and do not affect the operation.
+func (d *App) recordHistory(rec *HistoryRecord, err error) {
+	if rec == nil {
+		return
+	}
+	rec.FinishedAt = time.Now()
+	rec.Duration = rec.FinishedAt.Sub(rec.StartedAt).Round(time.Second).String()
+	var e ErrRolledBack
+	switch {
+	case err == nil:
+		rec.Outcome = HistoryOutcomeSucceeded
+	case errors.As(err, &e):
+		rec.Outcome = HistoryOutcomeRolledBack
+		rec.Error = err.Error()
+	default:
+		rec.Outcome = HistoryOutcomeFailed
+		rec.Error = err.Error()
+	}
+
+	// the context of the operation may be canceled already
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if out, err := sts.NewFromConfig(d.config.awsv2Config).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{}); err != nil {
+		d.Log("[WARNING] failed to get caller identity for the history: %s", err)
+	} else {
+		rec.Identity = aws.ToString(out.Arn)
+	}
+	if rec.TaskDefinitionArn == "" && err == nil {
+		// rollback and creating a service do not know the task definition deployed
+		if sv, err := d.DescribeService(ctx); err == nil {
+			rec.TaskDefinitionArn = aws.ToString(sv.TaskDefinition)
+		}
+	}
+	if rec.TaskDefinitionArn != "" {
+		if images, err := d.historyImages(ctx, rec.TaskDefinitionArn); err != nil {
+			d.Log("[WARNING] failed to collect images for the history: %s", err)
+		} else {
+			rec.Images = images
+		}
+	}
+
+	sink, err := d.newHistorySink()
+	if err == nil {
+		err = sink.put(ctx, rec)
+	}
+	if err != nil {
+		d.Log("[WARNING] failed to record the history: %s", err)
+		return
+	}
+	d.Log("[DEBUG] recorded the history %s", rec.ID)
+}
+
+// historyImages returns the images of the task definition with the digests resolved by the running tasks.
+func (d *App) historyImages(ctx context.Context, tdArn string) ([]HistoryImage, error) {
+	td, err := d.DescribeTaskDefinition(ctx, tdArn)
+	if err != nil {
+		return nil, err
+	}
+	digests := map[string]string{}
+	tasks, err := d.ecs.ListTasks(ctx, &ecs.ListTasksInput{
+		Cluster:     aws.String(d.Cluster),
+		ServiceName: aws.String(d.Service),
+		MaxResults:  aws.Int32(100),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tasks: %w", err)
+	}
+	if len(tasks.TaskArns) > 0 {
+		out, err := d.ecs.DescribeTasks(ctx, &ecs.DescribeTasksInput{
+			Cluster: aws.String(d.Cluster),
+			Tasks:   tasks.TaskArns,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe tasks: %w", err)
+		}
+		for _, task := range out.Tasks {
+			if aws.ToString(task.TaskDefinitionArn) != tdArn {
+				continue
+			}
+			for _, c := range task.Containers {
+				if c.ImageDigest != nil {
+					digests[aws.ToString(c.Name)] = aws.ToString(c.ImageDigest)
+				}
+			}
+		}
+	}
+	images := make([]HistoryImage, 0, len(td.ContainerDefinitions))
+	for _, c := range td.ContainerDefinitions {
+		name := aws.ToString(c.Name)
+		images = append(images, HistoryImage{
+			Container: name,
+			Image:     aws.ToString(c.Image),
+			Digest:    digests[name],
+		})
+	}
+	return images, nil
+}
+
+func (d *App) History(ctx context.Context, opt HistoryOption) error {
+	ctx, cancel := d.Start(ctx)
+	defer cancel()
+
+	if d.config.History == nil {
+		return errors.New("history is not configured")
+	}
+	sink, err := d.newHistorySink()
+	if err != nil {
+		return err
+	}
+	if opt.ID != "" {
+		rec, err := sink.get(ctx, opt.ID)
+		if err != nil {
+			return err
+		}
+		if rec == nil {
+			return ErrNotFound(fmt.Sprintf("history record %s is not found", opt.ID))
+		}
+		return d.OutputJSONForAPI(os.Stdout, rec)
+	}
+
+	recs, err := sink.list(ctx, opt.Limit)
+	if err != nil {
+		return err
+	}
+	switch opt.Output {
+	case "json":
+		return historyRecords(recs).OutputJSON(os.Stdout)
+	case "table":
+		return historyRecords(recs).OutputTable(os.Stdout)
+	case "tsv":
+		return historyRecords(recs).OutputTSV(os.Stdout)
+	}
+	return nil
+}
+
+func findHistoryRecord(recs []*HistoryRecord, id string) *HistoryRecord {
+	rec, _ := lo.Find(recs, func(r *HistoryRecord) bool { return r.ID == id })
+	return rec
+}
+
+// newestHistoryRecords returns the records newest first up to limit.
+func newestHistoryRecords(recs []*HistoryRecord, limit int) []*HistoryRecord {
+	sort.SliceStable(recs, func(i, j int) bool {
+		return recs[i].StartedAt.After(recs[j].StartedAt)
+	})
+	if limit > 0 && len(recs) > limit {
+		recs = recs[:limit]
+	}
+	return recs
+}
+
+// fileHistorySink writes the records to a local JSON Lines file.
+// The file may be shared by services, so it reads the records of the cluster and the service only.
+type fileHistorySink struct {
+	path    string
+	cluster string
+	service string
+}
+
+func (s *fileHistorySink) put(_ context.Context, rec *HistoryRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal history record: %w", err)
+	}
+	if dir := filepath.Dir(s.path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", dir, err)
+		}
+	}
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, CreateFileMode)
+	if err != nil {
+		return fmt.Errorf("failed to open history file %s: %w", s.path, err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("failed to write history file %s: %w", s.path, err)
+	}
+	return nil
+}
+
+func (s *fileHistorySink) list(_ context.Context, limit int) ([]*HistoryRecord, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open history file %s: %w", s.path, err)
+	}
+	defer f.Close()
+	var recs []*HistoryRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var rec HistoryRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return nil, fmt.Errorf("failed to parse history file %s: %w", s.path, err)
+		}
+		if rec.Cluster != s.cluster || rec.Service != s.service {
+			continue
+		}
+		recs = append(recs, &rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history file %s: %w", s.path, err)
+	}
+	return newestHistoryRecords(recs, limit), nil
+}
+
+func (s *fileHistorySink) get(ctx context.Context, id string) (*HistoryRecord, error) {
+	recs, err := s.list(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	return findHistoryRecord(recs, id), nil
+}
+
+// s3HistorySink writes the records to S3 objects under the prefix.
+// The object keys are sortable by the time of the operation.
+type s3HistorySink struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+func (s *s3HistorySink) key(rec *HistoryRecord) string {
+	return s.prefix + rec.StartedAt.UTC().Format("20060102T150405Z") + "-" + rec.ID + ".json"
+}
+
+func (s *s3HistorySink) put(ctx context.Context, rec *HistoryRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal history record: %w", err)
+	}
+	key := s.key(rec)
+	if _, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(b),
+		ContentType: aws.String("application/json"),
+	}); err != nil {
+		return fmt.Errorf("failed to put history record to s3://%s/%s: %w", s.bucket, key, err)
+	}
+	return nil
+}
+
+func (s *s3HistorySink) keys(ctx context.Context) ([]string, error) {
+	var keys []string
+	pager := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.prefix),
+	})
+	for pager.HasMorePages() {
+		out, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list history records in s3://%s/%s: %w", s.bucket, s.prefix, err)
+		}
+		for _, obj := range out.Contents {
+			keys = append(keys, aws.ToString(obj.Key))
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+	return keys, nil
+}
+
+func (s *s3HistorySink) read(ctx context.Context, key string) (*HistoryRecord, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get history record s3://%s/%s: %w", s.bucket, key, err)
+	}
+	defer out.Body.Close()
+	var rec HistoryRecord
+	if err := json.NewDecoder(out.Body).Decode(&rec); err != nil {
+		return nil, fmt.Errorf("failed to parse history record s3://%s/%s: %w", s.bucket, key, err)
+	}
+	return &rec, nil
+}
+
+func (s *s3HistorySink) list(ctx context.Context, limit int) ([]*HistoryRecord, error) {
+	keys, err := s.keys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
+	recs := make([]*HistoryRecord, 0, len(keys))
+	for _, key := range keys {
+		rec, err := s.read(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		recs = append(recs, rec)
+	}
+	return recs, nil
+}
+
+func (s *s3HistorySink) get(ctx context.Context, id string) (*HistoryRecord, error) {
+	keys, err := s.keys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if strings.HasSuffix(key, "-"+id+".json") {
+			return s.read(ctx, key)
+		}
+	}
+	return nil, nil
+}
+
+// cloudWatchLogsHistorySink writes the records to a CloudWatch Logs stream.
+type cloudWatchLogsHistorySink struct {
+	client *cloudwatchlogs.Client
+	group  string
+	stream string
+}
+
+func (s *cloudWatchLogsHistorySink) put(ctx context.Context, rec *HistoryRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal history record: %w", err)
+	}
+	if _, err := s.client.CreateLogStream(ctx, &cloudwatchlogs.CreateLogStreamInput{
+		LogGroupName:  aws.String(s.group),
+		LogStreamName: aws.String(s.stream),
+	}); err != nil {
+		var exists *cwlTypes.ResourceAlreadyExistsException
+		if !errors.As(err, &exists) {
+			return fmt.Errorf("failed to create log stream %s in %s: %w", s.stream, s.group, err)
+		}
+	}
+	if _, err := s.client.PutLogEvents(ctx, &cloudwatchlogs.PutLogEventsInput{
+		LogGroupName:  aws.String(s.group),
+		LogStreamName: aws.String(s.stream),
+		LogEvents: []cwlTypes.InputLogEvent{
+			{
+				Message:   aws.String(string(b)),
+				Timestamp: aws.Int64(rec.FinishedAt.UnixMilli()),
+			},
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to put history record to %s/%s: %w", s.group, s.stream, err)
+	}
+	return nil
+}
+
+func parseHistoryEvents(events []cwlTypes.OutputLogEvent) []*HistoryRecord {
+	recs := make([]*HistoryRecord, 0, len(events))
+	for _, ev := range events {
+		var rec HistoryRecord
+		if err := json.Unmarshal([]byte(aws.ToString(ev.Message)), &rec); err != nil {
+			continue
+		}
+		recs = append(recs, &rec)
+	}
+	return recs
+}
+
+func (s *cloudWatchLogsHistorySink) list(ctx context.Context, limit int) ([]*HistoryRecord, error) {
+	var recs []*HistoryRecord
+	var nextToken *string
+	for {
+		in := &cloudwatchlogs.GetLogEventsInput{
+			LogGroupName:  aws.String(s.group),
+			LogStreamName: aws.String(s.stream),
+			StartFromHead: aws.Bool(false),
+			NextToken:     nextToken,
+		}
+		if limit > 0 {
+			in.Limit = aws.Int32(int32(limit))
+		}
+		out, err := s.client.GetLogEvents(ctx, in)
+		if err != nil {
+			var notFound *cwlTypes.ResourceNotFoundException
+			if errors.As(err, &notFound) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("failed to get history records from %s/%s: %w", s.group, s.stream, err)
+		}
+		recs = append(recs, parseHistoryEvents(out.Events)...)
+		if len(out.Events) == 0 || (limit > 0 && len(recs) >= limit) {
+			break
+		}
+		// GetLogEvents returns the same token at the end of the stream
+		if aws.ToString(out.NextBackwardToken) == aws.ToString(nextToken) {
+			break
+		}
+		nextToken = out.NextBackwardToken
+	}
+	return newestHistoryRecords(recs, limit), nil
+}
+
+func (s *cloudWatchLogsHistorySink) get(ctx context.Context, id string) (*HistoryRecord, error) {
+	pager := cloudwatchlogs.NewFilterLogEventsPaginator(s.client, &cloudwatchlogs.FilterLogEventsInput{
+		LogGroupName:   aws.String(s.group),
+		LogStreamNames: []string{s.stream},
+		FilterPattern:  aws.String(fmt.Sprintf(`{ $.id = "%s" }`, id)),
+	})
+	for pager.HasMorePages() {
+		out, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find history record %s in %s/%s: %w", id, s.group, s.stream, err)
+		}
+		for _, ev := range out.Events {
+			var rec HistoryRecord
+			if err := json.Unmarshal([]byte(aws.ToString(ev.Message)), &rec); err != nil {
+				continue
+			}
+			if rec.ID == id {
+				return &rec, nil
+			}
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,100 @@
+package ecspresso_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kayac/ecspresso/v2"
+)
+
+func TestFileHistorySink(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("HISTORY_PATH", filepath.Join(t.TempDir(), "history", "ecspresso.jsonl"))
+	app, err := ecspresso.New(ctx, &ecspresso.CLIOptions{ConfigFilePath: "tests/history.yml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recs, err := app.ListHistoryRecords(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 0 {
+		t.Errorf("unexpected records: %d", len(recs))
+	}
+
+	startedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		rec := &ecspresso.HistoryRecord{
+			ID:                fmt.Sprintf("id-%d", i),
+			Operation:         "deploy",
+			Cluster:           "default",
+			Service:           "test",
+			TaskDefinitionArn: fmt.Sprintf("arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:%d", i+1),
+			Images: []ecspresso.HistoryImage{
+				{Container: "app", Image: "nginx:latest", Digest: "sha256:0123"},
+			},
+			Outcome:    ecspresso.HistoryOutcomeSucceeded,
+			StartedAt:  startedAt.Add(time.Duration(i) * time.Hour),
+			FinishedAt: startedAt.Add(time.Duration(i)*time.Hour + time.Minute),
+			Duration:   "1m0s",
+		}
+		if err := app.PutHistoryRecord(ctx, rec); err != nil {
+			t.Fatal(err)
+		}
+		// a record of another service in the same file
+		other := *rec
+		other.ID = fmt.Sprintf("other-%d", i)
+		other.Service = "other"
+		other.StartedAt = other.StartedAt.Add(time.Minute)
+		if err := app.PutHistoryRecord(ctx, &other); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	recs, err = app.ListHistoryRecords(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, r := range recs {
+		ids = append(ids, r.ID)
+	}
+	if diff := cmp.Diff([]string{"id-2", "id-1"}, ids); diff != "" {
+		t.Errorf("unexpected records (newest first): %s", diff)
+	}
+
+	rec, err := app.GetHistoryRecord(ctx, "id-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec == nil || rec.Images[0].Digest != "sha256:0123" || !rec.StartedAt.Equal(startedAt) {
+		t.Errorf("unexpected record: %#v", rec)
+	}
+	if rec, err := app.GetHistoryRecord(ctx, "other-0"); err != nil || rec != nil {
+		t.Errorf("records of other services must not be found: %v %v", rec, err)
+	}
+	if rec, err := app.GetHistoryRecord(ctx, "not-found"); err != nil || rec != nil {
+		t.Errorf("unexpected result: %v %v", rec, err)
+	}
+}
+
+func TestDiffSummary(t *testing.T) {
+	ds := `--- arn:aws:ecs:ap-northeast-1:123456789012:service/default/test
++++ ecs-service-def.json
+@@ -1,4 +1,5 @@
+ {
+-  "desiredCount": 1,
++  "desiredCount": 2,
++  "enableExecuteCommand": true,
+   "launchType": "FARGATE"
+ }
+`
+	if s := ecspresso.DiffSummary(ds); s != "+2 -1 lines" {
+		t.Errorf("unexpected summary: %s", s)
+	}
+}
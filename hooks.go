@@ -0,0 +1,122 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+const (
+	hookPhasePreDeploy  = "pre_deploy"
+	hookPhasePostDeploy = "post_deploy"
+)
+
+// ConfigHooks represents one-off tasks run before and after deployments.
+type ConfigHooks struct {
+	PreDeploy         []*ConfigHook `yaml:"pre_deploy,omitempty" json:"pre_deploy,omitempty"`
+	PostDeploy        []*ConfigHook `yaml:"post_deploy,omitempty" json:"post_deploy,omitempty"`
+	RollbackOnFailure bool          `yaml:"rollback_on_failure,omitempty" json:"rollback_on_failure,omitempty"`
+}
+
+// ConfigHook represents a one-off task run as a hook.
+type ConfigHook struct {
+	Container string   `yaml:"container" json:"container"`
+	Command   []string `yaml:"command,omitempty" json:"command,omitempty"`
+}
+
+func (h *ConfigHooks) validate() error {
+	for _, phase := range []string{hookPhasePreDeploy, hookPhasePostDeploy} {
+		for i, hook := range h.of(phase) {
+			if hook == nil || hook.Container == "" {
+				return fmt.Errorf("hooks.%s[%d].container is required", phase, i)
+			}
+		}
+	}
+	return nil
+}
+
+func (h *ConfigHook) String() string {
+	if len(h.Command) == 0 {
+		return fmt.Sprintf("container %s", h.Container)
+	}
+	return fmt.Sprintf("container %s command %s", h.Container, strings.Join(h.Command, " "))
+}
+
+func (h *ConfigHook) taskOverride() *types.TaskOverride {
+	return &types.TaskOverride{
+		ContainerOverrides: []types.ContainerOverride{
+			{
+				Name:    aws.String(h.Container),
+				Command: h.Command,
+			},
+		},
+	}
+}
+
+func (h *ConfigHooks) of(phase string) []*ConfigHook {
+	if h == nil {
+		return nil
+	}
+	switch phase {
+	case hookPhasePreDeploy:
+		return h.PreDeploy
+	case hookPhasePostDeploy:
+		return h.PostDeploy
+	}
+	return nil
+}
+
+// runHooks runs the hook tasks of the phase with the task definition one by one.
+// It returns an error when any hook task failed to run or the watched container exited with non-zero code.
+func (d *App) runHooks(ctx context.Context, phase string, taskDefinitionArn string, dryRun bool) error {
+	hooks := d.config.Hooks.of(phase)
+	if len(hooks) == 0 {
+		return nil
+	}
+	if dryRun {
+		for i, h := range hooks {
+			d.Log("hook %s[%d] will run: %s", phase, i, h)
+		}
+		return nil
+	}
+
+	td, err := d.DescribeTaskDefinition(ctx, taskDefinitionArn)
+	if err != nil {
+		return err
+	}
+	for i, h := range hooks {
+		name := fmt.Sprintf("%s[%d]", phase, i)
+		watchContainer := containerOf(td, &h.Container)
+		if watchContainer == nil {
+			return fmt.Errorf("hook %s failed: container %s is not found in %s", name, h.Container, arnToName(taskDefinitionArn))
+		}
+		d.Log("Running hook %s: %s", name, h)
+		d.emitEvent(&OutputEvent{Type: OutputEventTypePhase, Phase: "hook", Status: phaseStatusStarted, Message: name})
+		if err := d.runHookTask(ctx, taskDefinitionArn, h, watchContainer); err != nil {
+			err = fmt.Errorf("hook %s failed: %w", name, err)
+			d.emitEvent(&OutputEvent{Type: OutputEventTypePhase, Phase: "hook", Status: phaseStatusFailed, Message: name, Error: err.Error()})
+			return err
+		}
+		d.Log("Hook %s completed", name)
+		d.emitEvent(&OutputEvent{Type: OutputEventTypePhase, Phase: "hook", Status: phaseStatusCompleted, Message: name})
+	}
+	return nil
+}
+
+func (d *App) runHookTask(ctx context.Context, taskDefinitionArn string, h *ConfigHook, watchContainer *types.ContainerDefinition) error {
+	task, err := d.RunTask(ctx, taskDefinitionArn, h.taskOverride(), &RunOption{
+		Count:                  1,
+		EBSDeleteOnTermination: aws.Bool(true),
+	})
+	if err != nil {
+		return err
+	}
+	if err := d.WaitRunTask(ctx, task, watchContainer, time.Now(), false); err != nil {
+		return err
+	}
+	return d.DescribeTaskStatus(ctx, task, watchContainer)
+}
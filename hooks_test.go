@@ -0,0 +1,57 @@
+package ecspresso_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/google/go-cmp/cmp"
+	"github.com/kayac/ecspresso/v2"
+)
+
+func TestLoadConfigHooks(t *testing.T) {
+	ctx := context.Background()
+	loader := ecspresso.NewConfigLoader(nil, nil)
+	conf, err := loader.Load(ctx, "tests/hooks.yml", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hooks := conf.Hooks
+	if !hooks.RollbackOnFailure {
+		t.Error("rollback_on_failure must be true")
+	}
+	if len(hooks.PreDeploy) != 1 || len(hooks.PostDeploy) != 2 {
+		t.Fatalf("unexpected hooks: %#v", hooks)
+	}
+
+	ov := hooks.PreDeploy[0].TaskOverride()
+	if len(ov.ContainerOverrides) != 1 {
+		t.Fatalf("unexpected container overrides: %#v", ov.ContainerOverrides)
+	}
+	co := ov.ContainerOverrides[0]
+	if aws.ToString(co.Name) != "app" {
+		t.Errorf("unexpected container name: %s", aws.ToString(co.Name))
+	}
+	if diff := cmp.Diff([]string{"bundle", "exec", "rake", "db:migrate"}, co.Command); diff != "" {
+		t.Errorf("unexpected command: %s", diff)
+	}
+
+	// command is not overridden
+	ov = hooks.PostDeploy[1].TaskOverride()
+	if co := ov.ContainerOverrides[0]; aws.ToString(co.Name) != "worker" || co.Command != nil {
+		t.Errorf("unexpected container override: %#v", co)
+	}
+
+	_, err = loader.Load(ctx, "tests/hooks_invalid.yml", "")
+	if err == nil || !strings.Contains(err.Error(), "hooks.post_deploy[0].container is required") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestConfigHookString(t *testing.T) {
+	h := &ecspresso.ConfigHook{Container: "app", Command: []string{"echo", "hello"}}
+	if s := h.String(); s != "container app command echo hello" {
+		t.Errorf("unexpected string: %s", s)
+	}
+}
@@ -30,15 +30,10 @@ func MarshalJSONForAPI(v interface{}, queries ...string) ([]byte, error) {
 	if v == nil {
 		return nil, nil
 	}
-	b, err := json.Marshal(v)
+	m, err := toMapForAPI(v)
 	if err != nil {
 		return nil, err
 	}
-	m := map[string]interface{}{}
-	if err := json.Unmarshal(b, &m); err != nil {
-		return nil, err
-	}
-	walkMap(m, jsonKeyForAPI)
 	if len(queries) > 0 {
 		for _, q := range queries {
 			if m, err = jqFilter(m, q); err != nil {
@@ -46,7 +41,25 @@ func MarshalJSONForAPI(v interface{}, queries ...string) ([]byte, error) {
 			}
 		}
 	}
-	bs, err := json.MarshalIndent(m, "", "  ")
+	return marshalJSONIndent(m)
+}
+
+// toMapForAPI converts v to a map with the keys same as AWS API.
+func toMapForAPI(v interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]interface{}{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	walkMap(m, jsonKeyForAPI)
+	return m, nil
+}
+
+func marshalJSONIndent(v interface{}) ([]byte, error) {
+	bs, err := json.MarshalIndent(v, "", "  ")
 	if err != nil {
 		return nil, err
 	}
@@ -142,3 +155,24 @@ func jqFilter(m map[string]interface{}, q string) (map[string]interface{}, error
 	}
 	return m, nil
 }
+
+// jqQuery returns all the results of the query.
+func jqQuery(v interface{}, q string) ([]interface{}, error) {
+	query, err := gojq.Parse(q)
+	if err != nil {
+		return nil, err
+	}
+	var results []interface{}
+	iter := query.Run(v)
+	for {
+		r, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := r.(error); ok {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
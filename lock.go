@@ -0,0 +1,674 @@
+package ecspresso
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+const (
+	DefaultLockTTL    = time.Hour
+	DefaultLockTagKey = "ecspresso:lock"
+
+	lockBackendS3       = "s3"
+	lockBackendDynamoDB = "dynamodb"
+	lockBackendTag      = "tag"
+)
+
+type LockOption struct {
+	Action string `arg:"" help:"action for the deployment lock (status, force-unlock)" enum:"status,force-unlock"`
+}
+
+// ConfigLock represents a configuration of deployment locks.
+type ConfigLock struct {
+	Backend   string    `yaml:"backend" json:"backend"`
+	Bucket    string    `yaml:"bucket,omitempty" json:"bucket,omitempty"`
+	KeyPrefix string    `yaml:"key_prefix,omitempty" json:"key_prefix,omitempty"`
+	Table     string    `yaml:"table,omitempty" json:"table,omitempty"`
+	TagKey    string    `yaml:"tag_key,omitempty" json:"tag_key,omitempty"`
+	TTL       *Duration `yaml:"ttl,omitempty" json:"ttl,omitempty"`
+	Endpoint  string    `yaml:"endpoint,omitempty" json:"endpoint,omitempty"`
+
+	holder string
+	reason string
+}
+
+func (c *ConfigLock) validate() error {
+	switch c.Backend {
+	case lockBackendS3:
+		if c.Bucket == "" {
+			return errors.New("lock.bucket is required for s3 backend")
+		}
+	case lockBackendDynamoDB:
+		if c.Table == "" {
+			return errors.New("lock.table is required for dynamodb backend")
+		}
+	case lockBackendTag:
+		if c.TagKey == "" {
+			c.TagKey = DefaultLockTagKey
+		}
+	default:
+		return fmt.Errorf("unsupported lock.backend: %s (s3, dynamodb or tag)", c.Backend)
+	}
+	if c.TTL == nil {
+		c.TTL = &Duration{DefaultLockTTL}
+	}
+	return nil
+}
+
+// Lock represents a deployment lock of the service.
+type Lock struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Holder    string    `json:"holder"`
+	Reason    string    `json:"reason,omitempty"`
+	Operation string    `json:"operation"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (l *Lock) expired(now time.Time) bool {
+	return !now.Before(l.ExpiresAt)
+}
+
+func (l *Lock) String() string {
+	s := fmt.Sprintf("held by %s for %s since %s (expires at %s)",
+		l.Holder,
+		l.Operation,
+		l.CreatedAt.In(time.Local).Format(EventTimeFormat),
+		l.ExpiresAt.In(time.Local).Format(EventTimeFormat),
+	)
+	if l.Reason != "" {
+		s += ": " + l.Reason
+	}
+	return s
+}
+
+func errLockedBy(l *Lock) error {
+	return ErrLocked(fmt.Sprintf("%s is locked. %s", l.Name, l))
+}
+
+type locker interface {
+	acquire(ctx context.Context, lock *Lock) error
+	release(ctx context.Context, lock *Lock) error
+	get(ctx context.Context) (*Lock, error)
+	forceRelease(ctx context.Context) error
+}
+
+func (d *App) lockName() string {
+	return d.Cluster + "/" + d.Service
+}
+
+func (d *App) newLocker() (locker, error) {
+	c := d.config.Lock
+	name := d.lockName()
+	switch c.Backend {
+	case lockBackendS3:
+		client := s3.NewFromConfig(d.config.awsv2Config, func(o *s3.Options) {
+			if c.Endpoint != "" {
+				o.BaseEndpoint = aws.String(c.Endpoint)
+				o.UsePathStyle = true
+			}
+		})
+		return &s3Locker{client: client, bucket: c.Bucket, key: c.KeyPrefix + name + ".lock.json"}, nil
+	case lockBackendDynamoDB:
+		client := dynamodb.NewFromConfig(d.config.awsv2Config, func(o *dynamodb.Options) {
+			if c.Endpoint != "" {
+				o.BaseEndpoint = aws.String(c.Endpoint)
+			}
+		})
+		return &dynamodbLocker{client: client, table: c.Table, name: name}, nil
+	case lockBackendTag:
+		return &tagLocker{app: d, key: c.TagKey}, nil
+	}
+	return nil, fmt.Errorf("unsupported lock backend: %s", c.Backend)
+}
+
+func lockHolder() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		name += "@" + host
+	}
+	return name
+}
+
+func newRandomID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
+
+func (d *App) newLock(operation string) *Lock {
+	c := d.config.Lock
+	holder := c.holder
+	if holder == "" {
+		holder = lockHolder()
+	}
+	now := time.Now()
+	return &Lock{
+		ID:        newRandomID(),
+		Name:      d.lockName(),
+		Holder:    holder,
+		Reason:    c.reason,
+		Operation: operation,
+		CreatedAt: now,
+		ExpiresAt: now.Add(c.TTL.Duration),
+	}
+}
+
+// lock acquires the deployment lock of the service if configured.
+// It returns a function to release the lock.
+func (d *App) lock(ctx context.Context, operation string) (func(), error) {
+	if d.config.Lock == nil {
+		return func() {}, nil
+	}
+	l, err := d.newLocker()
+	if err != nil {
+		return nil, err
+	}
+	lock := d.newLock(operation)
+	d.Log("[DEBUG] acquiring the deployment lock of %s by %s backend", lock.Name, d.config.Lock.Backend)
+	if err := l.acquire(ctx, lock); err != nil {
+		return nil, err
+	}
+	d.Log("[INFO] acquired the deployment lock of %s (expires at %s)", lock.Name, lock.ExpiresAt.In(time.Local).Format(EventTimeFormat))
+	return func() {
+		// release the lock even if ctx is canceled
+		rctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := l.release(rctx, lock); err != nil {
+			d.Log("[WARNING] failed to release the deployment lock of %s: %s", lock.Name, err)
+			return
+		}
+		d.Log("[INFO] released the deployment lock of %s", lock.Name)
+	}, nil
+}
+
+func (d *App) Lock(ctx context.Context, opt LockOption) error {
+	if d.config.Lock == nil {
+		return errors.New("lock is not configured")
+	}
+	l, err := d.newLocker()
+	if err != nil {
+		return err
+	}
+	lock, err := l.get(ctx)
+	if err != nil {
+		return err
+	}
+	switch opt.Action {
+	case "status":
+		if lock == nil {
+			fmt.Printf("%s is not locked\n", d.lockName())
+			return nil
+		}
+		b, err := json.MarshalIndent(lock, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal lock: %w", err)
+		}
+		fmt.Println(string(b))
+		if lock.expired(time.Now()) {
+			d.Log("[INFO] the lock is expired")
+		}
+		return nil
+	case "force-unlock":
+		if lock == nil {
+			d.Log("%s is not locked", d.lockName())
+			return nil
+		}
+		d.Log("Force unlocking %s. the lock was %s", d.lockName(), lock)
+		if err := l.forceRelease(ctx); err != nil {
+			return err
+		}
+		d.Log("%s is unlocked", d.lockName())
+		return nil
+	}
+	return fmt.Errorf("unknown lock action: %s", opt.Action)
+}
+
+func httpStatusCode(err error) int {
+	var re interface{ HTTPStatusCode() int }
+	if errors.As(err, &re) {
+		return re.HTTPStatusCode()
+	}
+	return 0
+}
+
+// s3Locker is a locker using an S3 object with conditional writes.
+type s3Locker struct {
+	client *s3.Client
+	bucket string
+	key    string
+}
+
+func (l *s3Locker) getWithETag(ctx context.Context) (*Lock, string, error) {
+	out, err := l.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(l.bucket),
+		Key:    aws.String(l.key),
+	})
+	if err != nil {
+		if httpStatusCode(err) == 404 {
+			return nil, "", nil
+		}
+		return nil, "", fmt.Errorf("failed to get lock object s3://%s/%s: %w", l.bucket, l.key, err)
+	}
+	defer out.Body.Close()
+	var lock Lock
+	if err := json.NewDecoder(out.Body).Decode(&lock); err != nil {
+		return nil, "", fmt.Errorf("failed to decode lock object s3://%s/%s: %w", l.bucket, l.key, err)
+	}
+	return &lock, aws.ToString(out.ETag), nil
+}
+
+func (l *s3Locker) get(ctx context.Context) (*Lock, error) {
+	lock, _, err := l.getWithETag(ctx)
+	return lock, err
+}
+
+// put puts the lock object with the conditional header.
+// It returns true when the precondition failed.
+func (l *s3Locker) put(ctx context.Context, lock *Lock, header, value string) (bool, error) {
+	b, err := json.Marshal(lock)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal lock: %w", err)
+	}
+	_, err = l.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(l.bucket),
+		Key:         aws.String(l.key),
+		Body:        bytes.NewReader(b),
+		ContentType: aws.String("application/json"),
+	}, func(o *s3.Options) {
+		o.APIOptions = append(o.APIOptions, smithyhttp.AddHeaderValue(header, value))
+	})
+	if err != nil {
+		switch httpStatusCode(err) {
+		case 412, 409: // PreconditionFailed, ConditionalRequestConflict
+			return true, nil
+		}
+		return false, fmt.Errorf("failed to put lock object s3://%s/%s: %w", l.bucket, l.key, err)
+	}
+	return false, nil
+}
+
+func (l *s3Locker) acquire(ctx context.Context, lock *Lock) error {
+	conflicted, err := l.put(ctx, lock, "If-None-Match", "*")
+	if err != nil || !conflicted {
+		return err
+	}
+	current, etag, err := l.getWithETag(ctx)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		// released in the meantime
+		if conflicted, err := l.put(ctx, lock, "If-None-Match", "*"); err != nil {
+			return err
+		} else if conflicted {
+			return ErrLocked(fmt.Sprintf("%s is locked by another process", lock.Name))
+		}
+		return nil
+	}
+	if !current.expired(time.Now()) {
+		return errLockedBy(current)
+	}
+	// take over the expired lock only if nobody else has taken it over
+	if conflicted, err := l.put(ctx, lock, "If-Match", etag); err != nil {
+		return err
+	} else if conflicted {
+		return ErrLocked(fmt.Sprintf("%s is locked by another process", lock.Name))
+	}
+	return nil
+}
+
+func (l *s3Locker) release(ctx context.Context, lock *Lock) error {
+	current, etag, err := l.getWithETag(ctx)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return nil
+	}
+	if current.ID != lock.ID {
+		return fmt.Errorf("the lock is %s", current)
+	}
+	// delete the lock only if nobody else has taken it over after the get
+	if conflicted, err := l.delete(ctx, func(o *s3.Options) {
+		o.APIOptions = append(o.APIOptions, smithyhttp.AddHeaderValue("If-Match", etag))
+	}); err != nil {
+		return err
+	} else if conflicted {
+		return ErrLocked(fmt.Sprintf("%s is taken over by another process", lock.Name))
+	}
+	return nil
+}
+
+func (l *s3Locker) forceRelease(ctx context.Context) error {
+	_, err := l.delete(ctx)
+	return err
+}
+
+// delete deletes the lock object.
+// It returns true when the precondition failed.
+func (l *s3Locker) delete(ctx context.Context, optFns ...func(*s3.Options)) (bool, error) {
+	if _, err := l.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(l.bucket),
+		Key:    aws.String(l.key),
+	}, optFns...); err != nil {
+		switch httpStatusCode(err) {
+		case 412, 409: // PreconditionFailed, ConditionalRequestConflict
+			return true, nil
+		}
+		return false, fmt.Errorf("failed to delete lock object s3://%s/%s: %w", l.bucket, l.key, err)
+	}
+	return false, nil
+}
+
+// dynamodbLocker is a locker using a DynamoDB item with conditional writes.
+// The table must have a partition key named "id" (String).
+type dynamodbLocker struct {
+	client *dynamodb.Client
+	table  string
+	name   string
+}
+
+func (l *dynamodbLocker) key() map[string]ddbTypes.AttributeValue {
+	return map[string]ddbTypes.AttributeValue{
+		"id": &ddbTypes.AttributeValueMemberS{Value: l.name},
+	}
+}
+
+func (l *dynamodbLocker) acquire(ctx context.Context, lock *Lock) error {
+	_, err := l.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(l.table),
+		Item: map[string]ddbTypes.AttributeValue{
+			"id":         &ddbTypes.AttributeValueMemberS{Value: l.name},
+			"lock_id":    &ddbTypes.AttributeValueMemberS{Value: lock.ID},
+			"holder":     &ddbTypes.AttributeValueMemberS{Value: lock.Holder},
+			"reason":     &ddbTypes.AttributeValueMemberS{Value: lock.Reason},
+			"operation":  &ddbTypes.AttributeValueMemberS{Value: lock.Operation},
+			"created_at": &ddbTypes.AttributeValueMemberN{Value: strconv.FormatInt(lock.CreatedAt.Unix(), 10)},
+			"expires_at": &ddbTypes.AttributeValueMemberN{Value: strconv.FormatInt(lock.ExpiresAt.Unix(), 10)},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(id) OR expires_at < :now"),
+		ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+			":now": &ddbTypes.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
+		},
+	})
+	if err == nil {
+		return nil
+	}
+	var ccf *ddbTypes.ConditionalCheckFailedException
+	if !errors.As(err, &ccf) {
+		return fmt.Errorf("failed to put lock item to %s: %w", l.table, err)
+	}
+	current, err := l.get(ctx)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return ErrLocked(fmt.Sprintf("%s is locked by another process", lock.Name))
+	}
+	return errLockedBy(current)
+}
+
+func (l *dynamodbLocker) get(ctx context.Context) (*Lock, error) {
+	out, err := l.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(l.table),
+		Key:            l.key(),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lock item from %s: %w", l.table, err)
+	}
+	if len(out.Item) == 0 {
+		return nil, nil
+	}
+	str := func(name string) string {
+		if v, ok := out.Item[name].(*ddbTypes.AttributeValueMemberS); ok {
+			return v.Value
+		}
+		return ""
+	}
+	unix := func(name string) time.Time {
+		if v, ok := out.Item[name].(*ddbTypes.AttributeValueMemberN); ok {
+			if n, err := strconv.ParseInt(v.Value, 10, 64); err == nil {
+				return time.Unix(n, 0)
+			}
+		}
+		return time.Time{}
+	}
+	return &Lock{
+		ID:        str("lock_id"),
+		Name:      l.name,
+		Holder:    str("holder"),
+		Reason:    str("reason"),
+		Operation: str("operation"),
+		CreatedAt: unix("created_at"),
+		ExpiresAt: unix("expires_at"),
+	}, nil
+}
+
+func (l *dynamodbLocker) release(ctx context.Context, lock *Lock) error {
+	_, err := l.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:           aws.String(l.table),
+		Key:                 l.key(),
+		ConditionExpression: aws.String("lock_id = :lock_id"),
+		ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+			":lock_id": &ddbTypes.AttributeValueMemberS{Value: lock.ID},
+		},
+	})
+	if err != nil {
+		var ccf *ddbTypes.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			current, gerr := l.get(ctx)
+			if gerr != nil || current == nil {
+				return nil // already released
+			}
+			return fmt.Errorf("the lock is %s", current)
+		}
+		return fmt.Errorf("failed to delete lock item from %s: %w", l.table, err)
+	}
+	return nil
+}
+
+func (l *dynamodbLocker) forceRelease(ctx context.Context) error {
+	if _, err := l.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(l.table),
+		Key:       l.key(),
+	}); err != nil {
+		return fmt.Errorf("failed to delete lock item from %s: %w", l.table, err)
+	}
+	return nil
+}
+
+// tagLocker is a locker using tags of the ECS service.
+// Tagging is not atomic, so it verifies the lock after tagging on a best-effort basis.
+type tagLocker struct {
+	app *App
+	key string
+}
+
+var invalidTagValueChars = regexp.MustCompile(`[^\p{L}\p{Z}\p{N}_.:/=+\-@]`)
+
+func tagValue(s string) string {
+	s = invalidTagValueChars.ReplaceAllString(s, "_")
+	if len(s) > 256 {
+		s = s[:256]
+	}
+	return s
+}
+
+// excludeLockTags excludes the tags used by the tag backend of deployment locks
+// to avoid treating them as the service tags.
+func (d *App) excludeLockTags(tags []types.Tag) []types.Tag {
+	c := d.config.Lock
+	if c == nil || c.Backend != lockBackendTag || len(tags) == 0 {
+		return tags
+	}
+	var filtered []types.Tag
+	for _, t := range tags {
+		if !strings.HasPrefix(aws.ToString(t.Key), c.TagKey+":") {
+			filtered = append(filtered, t)
+		}
+	}
+	return filtered
+}
+
+func (l *tagLocker) tagKeys() []string {
+	var keys []string
+	for _, k := range []string{"id", "holder", "reason", "operation", "created_at", "expires_at"} {
+		keys = append(keys, l.key+":"+k)
+	}
+	return keys
+}
+
+func (l *tagLocker) serviceArn(ctx context.Context) (string, error) {
+	sv, err := l.app.DescribeService(ctx)
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(sv.ServiceArn), nil
+}
+
+func (l *tagLocker) getByArn(ctx context.Context, arn string) (*Lock, error) {
+	out, err := l.app.ecs.ListTagsForResource(ctx, &ecs.ListTagsForResourceInput{
+		ResourceArn: aws.String(arn),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags of the service: %w", err)
+	}
+	tags := make(map[string]string, len(out.Tags))
+	for _, t := range out.Tags {
+		if k := aws.ToString(t.Key); strings.HasPrefix(k, l.key+":") {
+			tags[strings.TrimPrefix(k, l.key+":")] = aws.ToString(t.Value)
+		}
+	}
+	if tags["id"] == "" {
+		return nil, nil
+	}
+	lock := &Lock{
+		ID:        tags["id"],
+		Name:      l.app.lockName(),
+		Holder:    tags["holder"],
+		Reason:    tags["reason"],
+		Operation: tags["operation"],
+	}
+	lock.CreatedAt, _ = time.Parse(time.RFC3339, tags["created_at"])
+	lock.ExpiresAt, _ = time.Parse(time.RFC3339, tags["expires_at"])
+	return lock, nil
+}
+
+func (l *tagLocker) get(ctx context.Context) (*Lock, error) {
+	arn, err := l.serviceArn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return l.getByArn(ctx, arn)
+}
+
+func (l *tagLocker) acquire(ctx context.Context, lock *Lock) error {
+	arn, err := l.serviceArn(ctx)
+	if err != nil {
+		if errors.As(err, &errNotFound) {
+			l.app.Log("[WARNING] %s. the deployment lock by tag is not available", err)
+			return nil
+		}
+		return err
+	}
+	current, err := l.getByArn(ctx, arn)
+	if err != nil {
+		return err
+	}
+	if current != nil && !current.expired(time.Now()) {
+		return errLockedBy(current)
+	}
+	values := []string{
+		lock.ID,
+		lock.Holder,
+		lock.Reason,
+		lock.Operation,
+		lock.CreatedAt.UTC().Format(time.RFC3339),
+		lock.ExpiresAt.UTC().Format(time.RFC3339),
+	}
+	var tags []types.Tag
+	for i, k := range l.tagKeys() {
+		tags = append(tags, types.Tag{Key: aws.String(k), Value: aws.String(tagValue(values[i]))})
+	}
+	if _, err := l.app.ecs.TagResource(ctx, &ecs.TagResourceInput{
+		ResourceArn: aws.String(arn),
+		Tags:        tags,
+	}); err != nil {
+		return fmt.Errorf("failed to tag the service: %w", err)
+	}
+	// verify the lock is not overwritten by another process
+	current, err = l.getByArn(ctx, arn)
+	if err != nil {
+		return err
+	}
+	if current == nil || current.ID != lock.ID {
+		return ErrLocked(fmt.Sprintf("%s is locked by another process", lock.Name))
+	}
+	return nil
+}
+
+func (l *tagLocker) release(ctx context.Context, lock *Lock) error {
+	arn, err := l.serviceArn(ctx)
+	if err != nil {
+		if errors.As(err, &errNotFound) {
+			return nil
+		}
+		return err
+	}
+	current, err := l.getByArn(ctx, arn)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return nil
+	}
+	if current.ID != lock.ID {
+		return fmt.Errorf("the lock is %s", current)
+	}
+	return l.untag(ctx, arn)
+}
+
+func (l *tagLocker) forceRelease(ctx context.Context) error {
+	arn, err := l.serviceArn(ctx)
+	if err != nil {
+		return err
+	}
+	return l.untag(ctx, arn)
+}
+
+func (l *tagLocker) untag(ctx context.Context, arn string) error {
+	if _, err := l.app.ecs.UntagResource(ctx, &ecs.UntagResourceInput{
+		ResourceArn: aws.String(arn),
+		TagKeys:     l.tagKeys(),
+	}); err != nil {
+		return fmt.Errorf("failed to untag the service: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,279 @@
+package ecspresso_test
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kayac/ecspresso/v2"
+)
+
+// lockStandIn is a stand-in of S3 (path style) and DynamoDB for the deployment lock.
+// It implements only the conditional writes used by the lockers.
+type lockStandIn struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	items   map[string]map[string]map[string]string
+
+	beforeDelete func() // called before deleting an object, to race with the locker
+}
+
+func newLockStandIn() *lockStandIn {
+	return &lockStandIn{
+		objects: map[string][]byte{},
+		items:   map[string]map[string]map[string]string{},
+	}
+}
+
+func etagOf(b []byte) string {
+	sum := md5.Sum(b)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func (s *lockStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if target := r.Header.Get("X-Amz-Target"); target != "" {
+		s.serveDynamoDB(w, r, strings.TrimPrefix(target, "DynamoDB_20120810."))
+		return
+	}
+	s.serveS3(w, r)
+}
+
+func s3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func (s *lockStandIn) serveS3(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Path
+	current, exists := s.objects[key]
+	switch r.Method {
+	case http.MethodGet:
+		if !exists {
+			s3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("ETag", etagOf(current))
+		w.Write(current)
+	case http.MethodPut:
+		if r.Header.Get("If-None-Match") == "*" && exists {
+			s3Error(w, http.StatusPreconditionFailed, "PreconditionFailed")
+			return
+		}
+		if m := r.Header.Get("If-Match"); m != "" && (!exists || m != etagOf(current)) {
+			s3Error(w, http.StatusPreconditionFailed, "PreconditionFailed")
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		s.objects[key] = b
+		w.Header().Set("ETag", etagOf(b))
+	case http.MethodDelete:
+		if s.beforeDelete != nil {
+			s.beforeDelete()
+			current, exists = s.objects[key]
+		}
+		if m := r.Header.Get("If-Match"); m != "" && (!exists || m != etagOf(current)) {
+			s3Error(w, http.StatusPreconditionFailed, "PreconditionFailed")
+			return
+		}
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+type ddbRequest struct {
+	TableName                 string
+	Item                      map[string]map[string]string
+	Key                       map[string]map[string]string
+	ConditionExpression       string
+	ExpressionAttributeValues map[string]map[string]string
+}
+
+func ddbValue(v map[string]string) string {
+	if s, ok := v["S"]; ok {
+		return s
+	}
+	return v["N"]
+}
+
+func (s *lockStandIn) serveDynamoDB(w http.ResponseWriter, r *http.Request, op string) {
+	var req ddbRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	key := req.TableName + "/" + ddbValue(req.Key["id"])
+	if req.Item != nil {
+		key = req.TableName + "/" + ddbValue(req.Item["id"])
+	}
+	current, exists := s.items[key]
+
+	// conditions used by the dynamodb locker
+	satisfied := true
+	switch req.ConditionExpression {
+	case "":
+	case "attribute_not_exists(id) OR expires_at < :now":
+		if exists {
+			expiresAt, _ := strconv.ParseInt(ddbValue(current["expires_at"]), 10, 64)
+			now, _ := strconv.ParseInt(ddbValue(req.ExpressionAttributeValues[":now"]), 10, 64)
+			satisfied = expiresAt < now
+		}
+	case "lock_id = :lock_id":
+		satisfied = exists && ddbValue(current["lock_id"]) == ddbValue(req.ExpressionAttributeValues[":lock_id"])
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if !satisfied {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"__type":"com.amazonaws.dynamodb.v20120810#ConditionalCheckFailedException","message":"The conditional request failed"}`)
+		return
+	}
+
+	switch op {
+	case "PutItem":
+		s.items[key] = req.Item
+		fmt.Fprint(w, `{}`)
+	case "GetItem":
+		if !exists {
+			fmt.Fprint(w, `{}`)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"Item": current})
+	case "DeleteItem":
+		delete(s.items, key)
+		fmt.Fprint(w, `{}`)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (s *lockStandIn) expireAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	past := time.Now().Add(-time.Minute)
+	for k, b := range s.objects {
+		var lock ecspresso.Lock
+		json.Unmarshal(b, &lock)
+		lock.ExpiresAt = past
+		s.objects[k], _ = json.Marshal(lock)
+	}
+	for _, item := range s.items {
+		item["expires_at"] = map[string]string{"N": strconv.FormatInt(past.Unix(), 10)}
+	}
+}
+
+func TestDeploymentLock(t *testing.T) {
+	ctx := context.Background()
+	for _, backend := range []string{"s3", "dynamodb"} {
+		t.Run(backend, func(t *testing.T) {
+			standIn := newLockStandIn()
+			srv := httptest.NewServer(standIn)
+			defer srv.Close()
+			t.Setenv("LOCK_ENDPOINT", srv.URL)
+			t.Setenv("AWS_ACCESS_KEY_ID", "AKIAEXAMPLE")
+			t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+			newApp := func(holder string) *ecspresso.App {
+				app, err := ecspresso.New(ctx, &ecspresso.CLIOptions{
+					ConfigFilePath: "tests/lock_" + backend + ".yml",
+					LockHolder:     holder,
+					LockReason:     "testing",
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				return app
+			}
+			alice, bob := newApp("alice"), newApp("bob")
+
+			unlock, err := alice.AcquireLock(ctx, "deploy")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = bob.AcquireLock(ctx, "deploy")
+			var lockedErr ecspresso.ErrLocked
+			if !errors.As(err, &lockedErr) {
+				t.Fatalf("expected ErrLocked, got %v", err)
+			}
+			if !strings.Contains(err.Error(), "held by alice for deploy") || !strings.Contains(err.Error(), ": testing") {
+				t.Errorf("unexpected error: %s", err)
+			}
+
+			// released lock can be acquired by others
+			unlock()
+			unlockBob, err := bob.AcquireLock(ctx, "rollback")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// expired lock can be taken over
+			standIn.expireAll()
+			unlockAlice, err := alice.AcquireLock(ctx, "deploy")
+			if err != nil {
+				t.Fatalf("failed to take over the expired lock: %s", err)
+			}
+			// releasing the lock taken over must not remove the new one
+			unlockBob()
+			if _, err := bob.AcquireLock(ctx, "deploy"); !errors.As(err, &lockedErr) {
+				t.Fatalf("expected ErrLocked, got %v", err)
+			}
+
+			// force unlock
+			if err := bob.Lock(ctx, ecspresso.LockOption{Action: "force-unlock"}); err != nil {
+				t.Fatal(err)
+			}
+			unlockBob, err = bob.AcquireLock(ctx, "deploy")
+			if err != nil {
+				t.Fatal(err)
+			}
+			unlockBob()
+			unlockAlice() // no-op
+
+			if backend == "s3" {
+				// the lock taken over between the get and the delete of releasing must not be removed
+				unlock, err := alice.AcquireLock(ctx, "deploy")
+				if err != nil {
+					t.Fatal(err)
+				}
+				standIn.beforeDelete = func() {
+					for k, b := range standIn.objects {
+						var lock ecspresso.Lock
+						json.Unmarshal(b, &lock)
+						lock.ID, lock.Holder = "taken-over", "bob"
+						standIn.objects[k], _ = json.Marshal(lock)
+					}
+				}
+				unlock()
+				standIn.beforeDelete = nil
+				if _, err := alice.AcquireLock(ctx, "deploy"); !errors.As(err, &lockedErr) {
+					t.Fatalf("expected ErrLocked, got %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadConfigLockInvalid(t *testing.T) {
+	loader := ecspresso.NewConfigLoader(nil, nil)
+	_, err := loader.Load(context.Background(), "tests/lock_invalid.yml", "")
+	if err == nil || !strings.Contains(err.Error(), "lock.bucket is required for s3 backend") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,394 @@
+package ecspresso
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	logsTypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+var logsPollInterval = 5 * time.Second
+
+type LogsOption struct {
+	ID            string        `help:"task ID. all running tasks of the service (or the task definition family) by default" default:""`
+	Container     []string      `help:"container names to show logs (all containers by default)"`
+	Since         time.Duration `help:"show logs since the duration ago" default:"5m"`
+	FilterPattern string        `help:"filter pattern of CloudWatch Logs" default:""`
+	Follow        bool          `help:"follow new log events" default:"true" negatable:""`
+}
+
+func (o LogsOption) hasContainer(name string) bool {
+	if len(o.Container) == 0 {
+		return true
+	}
+	for _, c := range o.Container {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// logTarget is a log stream of a container in a task.
+type logTarget struct {
+	Group     string
+	Stream    string
+	TaskID    string
+	TaskArn   string
+	Container string
+}
+
+func (t logTarget) prefix() string {
+	return fmt.Sprintf("[%s/%s]", t.TaskID, t.Container)
+}
+
+// logGroupCursor holds the positions of the log streams in the log group already shown.
+// A log stream has its own position, because the events of a stream may be delivered later than the other streams.
+type logGroupCursor struct {
+	startTime int64            // position of the streams not fetched yet
+	streams   map[string]int64 // stream name => timestamp of the latest event shown
+	seen      map[string]int64 // event ID => timestamp
+}
+
+func newLogGroupCursor(startTime int64) *logGroupCursor {
+	return &logGroupCursor{
+		startTime: startTime,
+		streams:   map[string]int64{},
+		seen:      map[string]int64{},
+	}
+}
+
+func (c *logGroupCursor) position(stream string) int64 {
+	if ts, ok := c.streams[stream]; ok {
+		return ts
+	}
+	return c.startTime
+}
+
+func (d *App) Logs(ctx context.Context, opt LogsOption) error {
+	if !opt.Follow {
+		// Do not call d.Start() when following because it runs until interrupted.
+		var cancel context.CancelFunc
+		ctx, cancel = d.Start(ctx)
+		defer cancel()
+	}
+
+	startTime := time.Now().Add(-opt.Since).UnixMilli()
+	cursors := map[string]*logGroupCursor{}
+	tds := map[string]*TaskDefinitionInput{}
+	var notified bool
+	for {
+		targets, err := d.logTargets(ctx, opt, tds)
+		if err != nil {
+			return err
+		}
+		if len(targets) == 0 && !notified {
+			d.Log("[INFO] no log streams of the containers are found")
+			notified = true
+		}
+		for _, t := range targets {
+			if _, ok := cursors[t.Group]; !ok {
+				cursors[t.Group] = newLogGroupCursor(startTime)
+			}
+		}
+		if err := d.showLogEvents(ctx, targets, cursors, opt.FilterPattern); err != nil {
+			return err
+		}
+		if !opt.Follow {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(logsPollInterval):
+		}
+	}
+}
+
+// logTargets resolves the log streams of the containers in the tasks.
+// The task definitions are cached in tds.
+func (d *App) logTargets(ctx context.Context, opt LogsOption, tds map[string]*TaskDefinitionInput) ([]logTarget, error) {
+	tasks, err := d.logsTasks(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+	var targets []logTarget
+	for _, task := range tasks {
+		tdArn := aws.ToString(task.TaskDefinitionArn)
+		td, ok := tds[tdArn]
+		if !ok {
+			if td, err = d.DescribeTaskDefinition(ctx, tdArn); err != nil {
+				return nil, err
+			}
+			for _, name := range opt.Container {
+				if containerOf(td, aws.String(name)) == nil {
+					return nil, ErrNotFound(fmt.Sprintf("container %s is not found in %s", name, arnToName(tdArn)))
+				}
+			}
+			tds[tdArn] = td
+		}
+		for _, c := range td.ContainerDefinitions {
+			if !opt.hasContainer(aws.ToString(c.Name)) {
+				continue
+			}
+			t, err := containerLogTarget(&task, &c)
+			if err != nil {
+				d.Log("[WARNING] %s", err)
+				continue
+			}
+			targets = append(targets, t)
+		}
+	}
+	return targets, nil
+}
+
+// containerLogTarget resolves the CloudWatch Logs log stream of the container in the task.
+// It supports the awslogs log driver, and FireLens (awsfirelens) routing to CloudWatch Logs by the cloudwatch or cloudwatch_logs output plugin.
+func containerLogTarget(task *types.Task, c *types.ContainerDefinition) (logTarget, error) {
+	name := aws.ToString(c.Name)
+	taskArn := aws.ToString(task.TaskArn)
+	taskID := arnToName(taskArn)
+	t := logTarget{TaskID: taskID, TaskArn: taskArn, Container: name}
+	lc := c.LogConfiguration
+	if lc == nil {
+		return t, fmt.Errorf("logs of the container %s can't be located: no log configuration", name)
+	}
+	switch lc.LogDriver {
+	case types.LogDriverAwslogs:
+		t.Group = lc.Options["awslogs-group"]
+		prefix := lc.Options["awslogs-stream-prefix"]
+		if t.Group == "" || prefix == "" {
+			return t, fmt.Errorf("logs of the container %s can't be located: awslogs-group and awslogs-stream-prefix are required", name)
+		}
+		t.Stream = prefix + "/" + name + "/" + taskID
+	case types.LogDriverAwsfirelens:
+		switch plugin := lc.Options["Name"]; plugin {
+		case "cloudwatch", "cloudwatch_logs":
+		default:
+			return t, fmt.Errorf("logs of the container %s can't be located: FireLens output %q is not CloudWatch Logs", name, plugin)
+		}
+		t.Group = lc.Options["log_group_name"]
+		if t.Group == "" {
+			return t, fmt.Errorf("logs of the container %s can't be located: log_group_name of FireLens is not set", name)
+		}
+		// the tag of FireLens is "{container name}-firelens-{task ID}"
+		tag := name + "-firelens-" + taskID
+		if s := lc.Options["log_stream_name"]; s != "" {
+			t.Stream = strings.NewReplacer(
+				"$(tag)", tag,
+				"$(ecs_task_id)", taskID,
+				"$(ecs_task_arn)", taskArn,
+				"$(ecs_cluster)", arnToName(aws.ToString(task.ClusterArn)),
+			).Replace(s)
+			if strings.Contains(t.Stream, "$(") {
+				return t, fmt.Errorf("logs of the container %s can't be located: log_stream_name %s of FireLens is not supported", name, s)
+			}
+		} else if prefix := lc.Options["log_stream_prefix"]; prefix != "" {
+			t.Stream = prefix + tag
+		} else {
+			return t, fmt.Errorf("logs of the container %s can't be located: log_stream_name or log_stream_prefix of FireLens is not set", name)
+		}
+	default:
+		return t, fmt.Errorf("logs of the container %s can't be located: log driver %s is not supported", name, lc.LogDriver)
+	}
+	return t, nil
+}
+
+// logsTasks returns the task of the ID, or the running tasks of the service (or the task definition family).
+func (d *App) logsTasks(ctx context.Context, opt LogsOption) ([]types.Task, error) {
+	var arns []string
+	if opt.ID != "" {
+		arns = []string{opt.ID}
+	} else {
+		in := &ecs.ListTasksInput{
+			Cluster:       aws.String(d.Cluster),
+			DesiredStatus: types.DesiredStatusRunning,
+		}
+		if d.config.Service != "" {
+			in.ServiceName = aws.String(d.config.Service)
+		} else {
+			family, err := d.taskDefinitionFamily(ctx)
+			if err != nil {
+				return nil, err
+			}
+			in.Family = aws.String(family)
+		}
+		p := ecs.NewListTasksPaginator(d.ecs, in)
+		for p.HasMorePages() {
+			out, err := p.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list tasks: %w", err)
+			}
+			arns = append(arns, out.TaskArns...)
+		}
+	}
+	var tasks []types.Task
+	for i := 0; i < len(arns); i += 100 { // DescribeTasks accepts up to 100 tasks
+		end := i + 100
+		if end > len(arns) {
+			end = len(arns)
+		}
+		out, err := d.ecs.DescribeTasks(ctx, &ecs.DescribeTasksInput{
+			Cluster: aws.String(d.Cluster),
+			Tasks:   arns[i:end],
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe tasks: %w", err)
+		}
+		tasks = append(tasks, out.Tasks...)
+	}
+	if opt.ID != "" && len(tasks) == 0 {
+		return nil, ErrNotFound(fmt.Sprintf("task %s is not found", opt.ID))
+	}
+	return tasks, nil
+}
+
+type logTargetEvent struct {
+	target logTarget
+	event  logsTypes.FilteredLogEvent
+}
+
+// showLogEvents shows the new log events of the targets interleaved in the order of the timestamps.
+func (d *App) showLogEvents(ctx context.Context, targets []logTarget, cursors map[string]*logGroupCursor, filterPattern string) error {
+	groups := map[string]map[string]logTarget{} // group => stream => target
+	for _, t := range targets {
+		if groups[t.Group] == nil {
+			groups[t.Group] = map[string]logTarget{}
+		}
+		groups[t.Group][t.Stream] = t
+	}
+
+	var events []logTargetEvent
+	for group, streams := range groups {
+		evs, err := d.filterLogEvents(ctx, group, streams, cursors[group], filterPattern)
+		if err != nil {
+			return err
+		}
+		events = append(events, evs...)
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return aws.ToInt64(events[i].event.Timestamp) < aws.ToInt64(events[j].event.Timestamp)
+	})
+	for _, ev := range events {
+		e := logsTypes.OutputLogEvent{
+			Timestamp:     ev.event.Timestamp,
+			Message:       ev.event.Message,
+			IngestionTime: ev.event.IngestionTime,
+		}
+		fmt.Fprintln(d.humanOutput(), ev.target.prefix(), formatLogEvent(e))
+		oe := logEvent(ev.target.Group, ev.target.Stream, e)
+		oe.TaskArn = ev.target.TaskArn
+		d.emitEvent(oe)
+	}
+	return nil
+}
+
+// filterLogEvents returns the log events of the streams in the group after the cursor, and advances the cursor.
+func (d *App) filterLogEvents(ctx context.Context, group string, streams map[string]logTarget, cursor *logGroupCursor, filterPattern string) ([]logTargetEvent, error) {
+	names := make([]string, 0, len(streams))
+	for name := range streams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var events []logTargetEvent
+	for i := 0; i < len(names); i += 100 { // FilterLogEvents accepts up to 100 log streams
+		end := i + 100
+		if end > len(names) {
+			end = len(names)
+		}
+		batch := names[i:end]
+		startTime := cursor.position(batch[0])
+		fresh := false
+		for _, name := range batch {
+			if _, ok := cursor.streams[name]; !ok {
+				fresh = true
+			}
+			if pos := cursor.position(name); pos < startTime {
+				startTime = pos
+			}
+		}
+		in := &cloudwatchlogs.FilterLogEventsInput{
+			LogGroupName:   aws.String(group),
+			LogStreamNames: batch,
+			StartTime:      aws.Int64(startTime),
+		}
+		if filterPattern != "" {
+			in.FilterPattern = aws.String(filterPattern)
+		}
+		evs, err := d.filterLogEventsPages(ctx, in, streams, cursor)
+		events = append(events, evs...)
+		if err != nil {
+			var nf *logsTypes.ResourceNotFoundException
+			if !errors.As(err, &nf) {
+				return events, fmt.Errorf("failed to filter log events of %s: %w", group, err)
+			}
+			if fresh {
+				// the log streams of the tasks just started may not exist yet.
+				d.Log("[DEBUG] failed to filter log events of %s: %s", group, err)
+			} else {
+				d.Log("[WARNING] failed to filter log events of %s: %s", group, err)
+			}
+			continue
+		}
+		for _, name := range batch {
+			if _, ok := cursor.streams[name]; !ok {
+				cursor.streams[name] = cursor.startTime
+			}
+		}
+	}
+
+	// forget the streams not targeted anymore, and the events before the positions of all streams.
+	// the events at the latest timestamp of a stream may be fetched again at the next time.
+	for name := range cursor.streams {
+		if _, ok := streams[name]; !ok {
+			delete(cursor.streams, name)
+		}
+	}
+	oldest := cursor.startTime
+	for _, name := range names {
+		if pos := cursor.position(name); pos < oldest {
+			oldest = pos
+		}
+	}
+	for id, ts := range cursor.seen {
+		if ts < oldest {
+			delete(cursor.seen, id)
+		}
+	}
+	return events, nil
+}
+
+// filterLogEventsPages returns the log events not shown yet, and advances the positions of the streams.
+func (d *App) filterLogEventsPages(ctx context.Context, in *cloudwatchlogs.FilterLogEventsInput, streams map[string]logTarget, cursor *logGroupCursor) ([]logTargetEvent, error) {
+	var events []logTargetEvent
+	p := cloudwatchlogs.NewFilterLogEventsPaginator(d.cwl, in)
+	for p.HasMorePages() {
+		out, err := p.NextPage(ctx)
+		if err != nil {
+			return events, err
+		}
+		for _, e := range out.Events {
+			id := aws.ToString(e.EventId)
+			stream := aws.ToString(e.LogStreamName)
+			ts := aws.ToInt64(e.Timestamp)
+			if _, ok := cursor.seen[id]; ok || ts < cursor.position(stream) {
+				continue
+			}
+			cursor.seen[id] = ts
+			if pos, ok := cursor.streams[stream]; !ok || ts > pos {
+				cursor.streams[stream] = ts
+			}
+			events = append(events, logTargetEvent{target: streams[stream], event: e})
+		}
+	}
+	return events, nil
+}
@@ -0,0 +1,361 @@
+package ecspresso_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	logsTypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/google/go-cmp/cmp"
+	"github.com/kayac/ecspresso/v2"
+)
+
+const logsTaskArnPrefix = "arn:aws:ecs:ap-northeast-1:123456789012:task/default/"
+
+// logsMiddleware returns the tasks aaa and bbb running a task definition with the containers app (awslogs) and sidecar (no logs).
+// FilterLogEvents returns the events of the streams requested, in the order of the streams.
+func logsMiddleware(requested *[]string) func(*middleware.Stack) error {
+	now := time.Now().UnixMilli()
+	events := map[string][]logsTypes.FilteredLogEvent{
+		"ecs/app/aaa": {
+			{EventId: aws.String("1"), Timestamp: aws.Int64(now + 1), Message: aws.String("aaa first")},
+			{EventId: aws.String("3"), Timestamp: aws.Int64(now + 3), Message: aws.String("aaa second")},
+		},
+		"ecs/app/bbb": {
+			{EventId: aws.String("2"), Timestamp: aws.Int64(now + 2), Message: aws.String("bbb first")},
+		},
+	}
+	return func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(
+			middleware.InitializeMiddlewareFunc(
+				"test",
+				func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+					var out any
+					switch params := in.Parameters.(type) {
+					case *ecs.ListTasksInput:
+						out = &ecs.ListTasksOutput{TaskArns: []string{logsTaskArnPrefix + "aaa", logsTaskArnPrefix + "bbb"}}
+					case *ecs.DescribeTasksInput:
+						res := &ecs.DescribeTasksOutput{}
+						for _, id := range params.Tasks {
+							if id == "ccc" || id == logsTaskArnPrefix+"ccc" {
+								continue
+							}
+							res.Tasks = append(res.Tasks, types.Task{
+								TaskArn:           aws.String(logsTaskArnPrefix + id[len(id)-3:]),
+								TaskDefinitionArn: aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:1"),
+							})
+						}
+						out = res
+					case *ecs.DescribeTaskDefinitionInput:
+						out = &ecs.DescribeTaskDefinitionOutput{
+							TaskDefinition: &types.TaskDefinition{
+								TaskDefinitionArn: params.TaskDefinition,
+								ContainerDefinitions: []types.ContainerDefinition{
+									{
+										Name: aws.String("app"),
+										LogConfiguration: &types.LogConfiguration{
+											LogDriver: types.LogDriverAwslogs,
+											Options: map[string]string{
+												"awslogs-group":         "/ecs/test",
+												"awslogs-stream-prefix": "ecs",
+											},
+										},
+									},
+									{Name: aws.String("sidecar")},
+								},
+							},
+						}
+					case *cloudwatchlogs.FilterLogEventsInput:
+						*requested = append(*requested, params.LogStreamNames...)
+						res := &cloudwatchlogs.FilterLogEventsOutput{}
+						for _, name := range params.LogStreamNames {
+							for _, e := range events[name] {
+								e.LogStreamName = aws.String(name)
+								res.Events = append(res.Events, e)
+							}
+						}
+						out = res
+					default:
+						return next.HandleInitialize(ctx, in)
+					}
+					return middleware.InitializeOutput{Result: out}, middleware.Metadata{}, nil
+				},
+			),
+			middleware.Before,
+		)
+	}
+}
+
+func TestLogs(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("AWS_REGION", "ap-northeast-1")
+	tests := []struct {
+		name     string
+		opt      ecspresso.LogsOption
+		streams  []string
+		messages []string
+		notFound bool
+	}{
+		{
+			name:     "all tasks",
+			opt:      ecspresso.LogsOption{},
+			streams:  []string{"ecs/app/aaa", "ecs/app/bbb"},
+			messages: []string{"aaa first", "bbb first", "aaa second"},
+		},
+		{
+			name:     "task ID",
+			opt:      ecspresso.LogsOption{ID: "bbb"},
+			streams:  []string{"ecs/app/bbb"},
+			messages: []string{"bbb first"},
+		},
+		{
+			name:     "container without awslogs",
+			opt:      ecspresso.LogsOption{Container: []string{"sidecar"}},
+			streams:  nil,
+			messages: nil,
+		},
+		{
+			name:     "unknown container",
+			opt:      ecspresso.LogsOption{Container: []string{"nginx"}},
+			notFound: true,
+		},
+		{
+			name:     "unknown task",
+			opt:      ecspresso.LogsOption{ID: "ccc"},
+			notFound: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requested []string
+			ecspresso.SetAWSV2ConfigLoadOptionsFunc([]func(*config.LoadOptions) error{
+				config.WithRegion("ap-northeast-1"),
+				config.WithAPIOptions([]func(*middleware.Stack) error{
+					logsMiddleware(&requested),
+				}),
+			})
+			defer ecspresso.ResetAWSV2ConfigLoadOptionsFunc()
+			app, err := ecspresso.New(ctx, &ecspresso.CLIOptions{ConfigFilePath: "tests/ecspresso.yml"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			app.SetEventsOutput(&buf)
+
+			tt.opt.Since = time.Minute
+			err = app.Logs(ctx, tt.opt)
+			if tt.notFound {
+				var nf ecspresso.ErrNotFound
+				if !errors.As(err, &nf) {
+					t.Fatalf("expected not found error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.streams, requested); diff != "" {
+				t.Errorf("unexpected log streams: %s", diff)
+			}
+			var messages []string
+			for _, ev := range decodeEvents(t, &buf) {
+				if ev["type"] != ecspresso.OutputEventTypeLog {
+					continue
+				}
+				if ev["log_group"] != "/ecs/test" {
+					t.Errorf("unexpected log group: %v", ev["log_group"])
+				}
+				messages = append(messages, ev["message"].(string))
+			}
+			if diff := cmp.Diff(tt.messages, messages); diff != "" {
+				t.Errorf("unexpected log messages: %s", diff)
+			}
+		})
+	}
+}
+
+func TestContainerLogGroupStream(t *testing.T) {
+	task := &types.Task{
+		TaskArn:    aws.String(logsTaskArnPrefix + "aaa"),
+		ClusterArn: aws.String("arn:aws:ecs:ap-northeast-1:123456789012:cluster/default"),
+	}
+	cases := []struct {
+		name   string
+		lc     *types.LogConfiguration
+		group  string
+		stream string
+		err    bool
+	}{
+		{
+			name: "awslogs",
+			lc: &types.LogConfiguration{
+				LogDriver: types.LogDriverAwslogs,
+				Options:   map[string]string{"awslogs-group": "/ecs/app", "awslogs-stream-prefix": "ecs"},
+			},
+			group:  "/ecs/app",
+			stream: "ecs/app/aaa",
+		},
+		{
+			name: "awslogs without stream prefix",
+			lc: &types.LogConfiguration{
+				LogDriver: types.LogDriverAwslogs,
+				Options:   map[string]string{"awslogs-group": "/ecs/app"},
+			},
+			err: true,
+		},
+		{
+			name: "firelens log_stream_prefix",
+			lc: &types.LogConfiguration{
+				LogDriver: types.LogDriverAwsfirelens,
+				Options:   map[string]string{"Name": "cloudwatch_logs", "log_group_name": "/firelens/app", "log_stream_prefix": "from-fluent-bit-"},
+			},
+			group:  "/firelens/app",
+			stream: "from-fluent-bit-app-firelens-aaa",
+		},
+		{
+			name: "firelens log_stream_name",
+			lc: &types.LogConfiguration{
+				LogDriver: types.LogDriverAwsfirelens,
+				Options:   map[string]string{"Name": "cloudwatch", "log_group_name": "/firelens/app", "log_stream_name": "$(ecs_cluster)/$(ecs_task_id)"},
+			},
+			group:  "/firelens/app",
+			stream: "default/aaa",
+		},
+		{
+			name: "firelens to other than CloudWatch Logs",
+			lc: &types.LogConfiguration{
+				LogDriver: types.LogDriverAwsfirelens,
+				Options:   map[string]string{"Name": "kinesis_firehose", "delivery_stream": "app"},
+			},
+			err: true,
+		},
+		{
+			name: "unsupported driver",
+			lc:   &types.LogConfiguration{LogDriver: types.LogDriverFluentd},
+			err:  true,
+		},
+		{
+			name: "no log configuration",
+			err:  true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			group, stream, err := ecspresso.ContainerLogGroupStream(task, &types.ContainerDefinition{
+				Name:             aws.String("app"),
+				LogConfiguration: c.lc,
+			})
+			if c.err {
+				if err == nil {
+					t.Errorf("expected error, got %s %s", group, stream)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if group != c.group || stream != c.stream {
+				t.Errorf("unexpected log group and stream: %s %s", group, stream)
+			}
+		})
+	}
+}
+
+func TestFilterLogEvents(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("AWS_REGION", "ap-northeast-1")
+	var events []logsTypes.FilteredLogEvent
+	var filterErr error
+	ecspresso.SetAWSV2ConfigLoadOptionsFunc([]func(*config.LoadOptions) error{
+		config.WithRegion("ap-northeast-1"),
+		config.WithAPIOptions([]func(*middleware.Stack) error{
+			func(stack *middleware.Stack) error {
+				return stack.Initialize.Add(
+					middleware.InitializeMiddlewareFunc(
+						"test",
+						func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+							params, ok := in.Parameters.(*cloudwatchlogs.FilterLogEventsInput)
+							if !ok {
+								return next.HandleInitialize(ctx, in)
+							}
+							if filterErr != nil {
+								return middleware.InitializeOutput{}, middleware.Metadata{}, filterErr
+							}
+							res := &cloudwatchlogs.FilterLogEventsOutput{}
+							for _, e := range events {
+								if aws.ToInt64(e.Timestamp) >= aws.ToInt64(params.StartTime) {
+									res.Events = append(res.Events, e)
+								}
+							}
+							return middleware.InitializeOutput{Result: res}, middleware.Metadata{}, nil
+						},
+					),
+					middleware.Before,
+				)
+			},
+		}),
+	})
+	defer ecspresso.ResetAWSV2ConfigLoadOptionsFunc()
+	app, err := ecspresso.New(ctx, &ecspresso.CLIOptions{ConfigFilePath: "tests/ecspresso.yml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.SetLogger(log.New(io.Discard, "", 0))
+	streams := []string{"ecs/app/aaa", "ecs/app/bbb"}
+	cursor := ecspresso.NewLogGroupCursor(0)
+	event := func(id, stream string, ts int64) logsTypes.FilteredLogEvent {
+		return logsTypes.FilteredLogEvent{EventId: aws.String(id), LogStreamName: aws.String(stream), Timestamp: aws.Int64(ts), Message: aws.String(id)}
+	}
+
+	// the log stream of bbb is not created yet
+	filterErr = &logsTypes.ResourceNotFoundException{Message: aws.String("The specified log stream does not exist.")}
+	if _, err := app.FilterLogEventMessages(ctx, "/ecs/test", streams, cursor); err != nil {
+		t.Errorf("unexpected error for the streams not created yet: %s", err)
+	}
+	filterErr = nil
+
+	events = []logsTypes.FilteredLogEvent{
+		event("aaa-1", "ecs/app/aaa", 1000),
+		event("bbb-1", "ecs/app/bbb", 3000),
+	}
+	messages, err := app.FilterLogEventMessages(ctx, "/ecs/test", streams, cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"aaa-1", "bbb-1"}, messages); diff != "" {
+		t.Errorf("unexpected messages: %s", diff)
+	}
+
+	// the event of aaa delivered later than the event of bbb
+	events = append(events, event("aaa-2", "ecs/app/aaa", 2000))
+	messages, err = app.FilterLogEventMessages(ctx, "/ecs/test", streams, cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"aaa-2"}, messages); diff != "" {
+		t.Errorf("unexpected messages: %s", diff)
+	}
+
+	messages, err = app.FilterLogEventMessages(ctx, "/ecs/test", streams, cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 0 {
+		t.Errorf("events are shown twice: %v", messages)
+	}
+
+	filterErr = errors.New("AccessDeniedException")
+	if _, err := app.FilterLogEventMessages(ctx, "/ecs/test", streams, cursor); err == nil {
+		t.Error("expected error for the failure of FilterLogEvents")
+	}
+}
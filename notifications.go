@@ -0,0 +1,313 @@
+package ecspresso
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/samber/lo"
+)
+
+const (
+	NotificationEventStarted    = "started"
+	NotificationEventStable     = "stable"
+	NotificationEventCompleted  = "completed"
+	NotificationEventFailed     = "failed"
+	NotificationEventRolledBack = "rolled_back"
+
+	notificationTypeSlack   = "slack"
+	notificationTypeWebhook = "webhook"
+	notificationTypeSNS     = "sns"
+
+	snsSubjectMaxLength = 100 // the maximum length of Subject of SNS Publish API
+)
+
+var notificationEvents = []string{
+	NotificationEventStarted,
+	NotificationEventStable,
+	NotificationEventCompleted,
+	NotificationEventFailed,
+	NotificationEventRolledBack,
+}
+
+var notificationTimeout = 30 * time.Second
+
+// ConfigNotification represents a target of deployment lifecycle notifications.
+type ConfigNotification struct {
+	Type     string            `yaml:"type" json:"type"`
+	URL      string            `yaml:"url,omitempty" json:"url,omitempty"`
+	Headers  map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+	Body     string            `yaml:"body,omitempty" json:"body,omitempty"`
+	TopicArn string            `yaml:"topic_arn,omitempty" json:"topic_arn,omitempty"`
+	Events   []string          `yaml:"events,omitempty" json:"events,omitempty"`
+
+	bodyTmpl *template.Template
+}
+
+// The body of webhooks is a Go template with [[ ]] delimiters,
+// because the config file itself is rendered as a template with {{ }}.
+const (
+	notificationTemplateLeftDelim  = "[["
+	notificationTemplateRightDelim = "]]"
+)
+
+var notificationTemplateFuncs = template.FuncMap{
+	// json encodes the value as JSON. e.g. {"text": [[ json .Text ]]}
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+func (c *ConfigNotification) validate(i int) error {
+	switch c.Type {
+	case notificationTypeSlack:
+		if c.URL == "" {
+			return fmt.Errorf("notifications[%d].url is required for slack", i)
+		}
+	case notificationTypeWebhook:
+		if c.URL == "" {
+			return fmt.Errorf("notifications[%d].url is required for webhook", i)
+		}
+		if c.Body != "" {
+			tmpl, err := template.New(fmt.Sprintf("notifications[%d].body", i)).
+				Delims(notificationTemplateLeftDelim, notificationTemplateRightDelim).
+				Funcs(notificationTemplateFuncs).
+				Parse(c.Body)
+			if err != nil {
+				return fmt.Errorf("failed to parse notifications[%d].body: %w", i, err)
+			}
+			c.bodyTmpl = tmpl
+		}
+	case notificationTypeSNS:
+		if c.TopicArn == "" {
+			return fmt.Errorf("notifications[%d].topic_arn is required for sns", i)
+		}
+	default:
+		return fmt.Errorf("unsupported notifications[%d].type: %s (slack, webhook or sns)", i, c.Type)
+	}
+	for _, ev := range c.Events {
+		if !lo.Contains(notificationEvents, ev) {
+			return fmt.Errorf("unsupported notifications[%d].events: %s (%s)", i, ev, strings.Join(notificationEvents, ", "))
+		}
+	}
+	return nil
+}
+
+func (c *ConfigNotification) accepts(event string) bool {
+	return len(c.Events) == 0 || lo.Contains(c.Events, event)
+}
+
+// Notification represents a deployment lifecycle event.
+type Notification struct {
+	Event             string    `json:"event"`
+	Operation         string    `json:"operation,omitempty"`
+	Region            string    `json:"region"`
+	Cluster           string    `json:"cluster"`
+	Service           string    `json:"service"`
+	TaskDefinitionArn string    `json:"task_definition_arn,omitempty"`
+	CodeDeployURL     string    `json:"codedeploy_url,omitempty"`
+	DeploymentID      string    `json:"deployment_id,omitempty"`
+	Error             string    `json:"error,omitempty"`
+	Time              time.Time `json:"time"`
+
+	stableNotified bool
+}
+
+// Subject returns a one-line summary of the notification.
+func (n *Notification) Subject() string {
+	op := n.Operation
+	if op == "" {
+		op = "service"
+	}
+	return fmt.Sprintf("[ecspresso] %s %s: %s/%s", op, strings.ReplaceAll(n.Event, "_", " "), n.Cluster, n.Service)
+}
+
+// snsSubject returns the subject truncated to the maximum length of SNS.
+func (n *Notification) snsSubject() string {
+	s := []rune(n.Subject())
+	if len(s) <= snsSubjectMaxLength {
+		return string(s)
+	}
+	return string(s[:snsSubjectMaxLength-3]) + "..."
+}
+
+// Text returns a human readable message of the notification.
+func (n *Notification) Text() string {
+	lines := []string{n.Subject()}
+	if n.TaskDefinitionArn != "" {
+		lines = append(lines, "task definition: "+arnToName(n.TaskDefinitionArn))
+	}
+	if n.CodeDeployURL != "" {
+		lines = append(lines, "CodeDeploy: "+n.CodeDeployURL)
+	}
+	if n.Error != "" {
+		lines = append(lines, "error: "+n.Error)
+	}
+	return strings.Join(lines, "\n")
+}
+
+type notificationKey struct{}
+
+// withNotification returns a context carrying the notification of the operation.
+// The fields of the notification are filled while the operation is running.
+func (d *App) withNotification(ctx context.Context, operation string) context.Context {
+	return context.WithValue(ctx, notificationKey{}, &Notification{
+		Operation: operation,
+		Region:    d.config.Region,
+		Cluster:   d.Cluster,
+		Service:   d.Service,
+	})
+}
+
+// notificationOf returns the notification of the operation carried by the context.
+func notificationOf(ctx context.Context) *Notification {
+	if n, ok := ctx.Value(notificationKey{}).(*Notification); ok {
+		return n
+	}
+	return nil
+}
+
+func setNotificationTaskDefinition(ctx context.Context, tdArn string) {
+	if n := notificationOf(ctx); n != nil {
+		n.TaskDefinitionArn = tdArn
+	}
+}
+
+func setNotificationCodeDeployment(ctx context.Context, id, u string) {
+	if n := notificationOf(ctx); n != nil {
+		n.DeploymentID = id
+		n.CodeDeployURL = u
+	}
+}
+
+// notify sends the event to the notification targets.
+// Failures of sending are logged as warnings and do not affect the operation.
+func (d *App) notify(ctx context.Context, event string, cause error) {
+	n := Notification{Region: d.config.Region, Cluster: d.Cluster, Service: d.Service}
+	if base := notificationOf(ctx); base != nil {
+		if event == NotificationEventStable {
+			base.stableNotified = true
+		}
+		n = *base
+	}
+	phase := n.Operation
+	if phase == "" {
+		phase = "service"
+	}
+	d.emitPhase(phase, event, cause)
+	if len(d.config.Notifications) == 0 {
+		return
+	}
+	n.Event = event
+	n.Time = time.Now()
+	if cause != nil {
+		n.Error = cause.Error()
+	}
+
+	// the context of the operation may be canceled already
+	sctx, cancel := context.WithTimeout(context.Background(), notificationTimeout)
+	defer cancel()
+	for i, c := range d.config.Notifications {
+		if !c.accepts(event) {
+			continue
+		}
+		if err := d.sendNotification(sctx, c, &n); err != nil {
+			d.Log("[WARNING] failed to send notifications[%d] (%s): %s", i, c.Type, err)
+		}
+	}
+}
+
+// notifyResult notifies the result of the operation.
+// When the operation succeeded, it notifies completed unless the service has been notified as stable.
+func (d *App) notifyResult(ctx context.Context, err error) {
+	var e ErrRolledBack
+	switch {
+	case err == nil:
+		if n := notificationOf(ctx); n != nil && n.stableNotified {
+			return
+		}
+		d.notify(ctx, NotificationEventCompleted, nil)
+	case errors.As(err, &e):
+		d.notify(ctx, NotificationEventRolledBack, err)
+	default:
+		d.notify(ctx, NotificationEventFailed, err)
+	}
+}
+
+func (d *App) sendNotification(ctx context.Context, c *ConfigNotification, n *Notification) error {
+	switch c.Type {
+	case notificationTypeSlack:
+		b, err := json.Marshal(map[string]string{"text": n.Text()})
+		if err != nil {
+			return err
+		}
+		return postNotification(ctx, c.URL, nil, b)
+	case notificationTypeWebhook:
+		b, err := c.renderBody(n)
+		if err != nil {
+			return err
+		}
+		return postNotification(ctx, c.URL, c.Headers, b)
+	case notificationTypeSNS:
+		b, err := json.Marshal(n)
+		if err != nil {
+			return err
+		}
+		_, err = sns.NewFromConfig(d.config.awsv2Config).Publish(ctx, &sns.PublishInput{
+			TopicArn: aws.String(c.TopicArn),
+			Subject:  aws.String(n.snsSubject()),
+			Message:  aws.String(string(b)),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to publish to %s: %w", c.TopicArn, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported notification type: %s", c.Type)
+}
+
+// renderBody renders the body of the webhook. The default body is the notification in JSON.
+func (c *ConfigNotification) renderBody(n *Notification) ([]byte, error) {
+	if c.bodyTmpl == nil {
+		return json.Marshal(n)
+	}
+	var buf bytes.Buffer
+	if err := c.bodyTmpl.Execute(&buf, n); err != nil {
+		return nil, fmt.Errorf("failed to render body: %w", err)
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, fmt.Errorf("rendered body is not a valid JSON: %s", buf.String())
+	}
+	return buf.Bytes(), nil
+}
+
+func postNotification(ctx context.Context, u string, headers map[string]string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected response %s: %s", resp.Status, string(b))
+	}
+	return nil
+}
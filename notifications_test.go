@@ -0,0 +1,111 @@
+package ecspresso_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kayac/ecspresso/v2"
+)
+
+type receivedNotification struct {
+	Path          string
+	Authorization string
+	Body          map[string]string
+}
+
+func TestNotifications(t *testing.T) {
+	ctx := context.Background()
+	var mu sync.Mutex
+	var received []receivedNotification
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		b, _ := io.ReadAll(r.Body)
+		body := map[string]string{}
+		if err := json.Unmarshal(b, &body); err != nil {
+			t.Errorf("invalid JSON body: %s", string(b))
+		}
+		received = append(received, receivedNotification{
+			Path:          r.URL.Path,
+			Authorization: r.Header.Get("Authorization"),
+			Body:          body,
+		})
+	}))
+	defer srv.Close()
+	t.Setenv("NOTIFICATION_URL", srv.URL)
+
+	app, err := ecspresso.New(ctx, &ecspresso.CLIOptions{ConfigFilePath: "tests/notifications.yml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tdArn := "arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:2"
+	app.Notify(ctx, "deploy", tdArn, ecspresso.NotificationEventStarted, nil)
+	app.Notify(ctx, "deploy", tdArn, ecspresso.NotificationEventFailed, errors.New("something wrong"))
+
+	expected := []receivedNotification{
+		{
+			Path:          "/webhook",
+			Authorization: "Bearer xxx",
+			Body: map[string]string{
+				"service": "test",
+				"event":   "started",
+				"message": "[ecspresso] deploy started: default/test\ntask definition: test:2",
+			},
+		},
+		{
+			Path: "/slack",
+			Body: map[string]string{
+				"text": "[ecspresso] deploy failed: default/test\ntask definition: test:2\nerror: something wrong",
+			},
+		},
+		{
+			Path:          "/webhook",
+			Authorization: "Bearer xxx",
+			Body: map[string]string{
+				"service": "test",
+				"event":   "failed",
+				"message": "[ecspresso] deploy failed: default/test\ntask definition: test:2\nerror: something wrong",
+			},
+		},
+	}
+	if diff := cmp.Diff(expected, received); diff != "" {
+		t.Errorf("unexpected notifications: %s", diff)
+	}
+}
+
+func TestLoadConfigNotificationsInvalid(t *testing.T) {
+	loader := ecspresso.NewConfigLoader(nil, nil)
+	_, err := loader.Load(context.Background(), "tests/notifications_invalid.yml", "")
+	if err == nil || !strings.Contains(err.Error(), "unsupported notifications[0].events: unknown") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestNotificationSNSSubject(t *testing.T) {
+	n := &ecspresso.Notification{
+		Operation: "deploy",
+		Event:     ecspresso.NotificationEventRolledBack,
+		Cluster:   "default",
+		Service:   "test",
+	}
+	if s := n.SNSSubject(); s != "[ecspresso] deploy rolled back: default/test" {
+		t.Errorf("unexpected subject: %s", s)
+	}
+
+	n.Cluster = strings.Repeat("c", 100)
+	s := n.SNSSubject()
+	if l := len([]rune(s)); l != 100 {
+		t.Errorf("subject must be truncated to 100 characters, got %d: %s", l, s)
+	}
+	if !strings.HasPrefix(s, "[ecspresso] deploy rolled back: ccc") || !strings.HasSuffix(s, "...") {
+		t.Errorf("unexpected subject: %s", s)
+	}
+}
@@ -0,0 +1,65 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/Songmu/prompter"
+	isatty "github.com/mattn/go-isatty"
+)
+
+// isStdinTerminal reports whether STDIN is a terminal to choose items interactively.
+var isStdinTerminal = func() bool {
+	return isatty.IsTerminal(os.Stdin.Fd()) || isatty.IsCygwinTerminal(os.Stdin.Fd())
+}
+
+// pickItem lets the user choose one of the items and returns its index.
+// The filter command (e.g. peco, fzf) is the same as exec and tasks, resolved by ecsta from --filter-command or the config of ecsta.
+// Without the filter command, the user enters the number of the item.
+func (d *App) pickItem(ctx context.Context, message string, items []string, defaultIndex int) (int, error) {
+	if len(items) == 0 {
+		return -1, ErrNotFound("no items to choose")
+	}
+	ecstaApp, err := d.NewEcsta(ctx)
+	if err != nil {
+		return -1, err
+	}
+	if fc := ecstaApp.Config.Get("filter_command"); fc != "" {
+		return runFilterCommand(ctx, fc, items)
+	}
+	for i, item := range items {
+		fmt.Fprintf(os.Stderr, "%3d: %s\n", i+1, item)
+	}
+	for {
+		ans := prompter.Prompt(fmt.Sprintf("%s [1-%d]", message, len(items)), strconv.Itoa(defaultIndex+1))
+		if n, err := strconv.Atoi(ans); err == nil && n >= 1 && n <= len(items) {
+			return n - 1, nil
+		}
+		fmt.Fprintf(os.Stderr, "invalid number: %s\n", ans)
+	}
+}
+
+// runFilterCommand runs the filter command in the same manner as ecsta.
+func runFilterCommand(ctx context.Context, fc string, items []string) (int, error) {
+	cmd := exec.CommandContext(ctx, fc)
+	if strings.Contains(fc, " ") {
+		cmd = exec.CommandContext(ctx, "sh", "-c", fc)
+	}
+	cmd.Stdin = strings.NewReader(strings.Join(items, "\n") + "\n")
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return -1, fmt.Errorf("failed to run filter command: %w", err)
+	}
+	selected := strings.TrimRight(string(out), "\r\n")
+	for i, item := range items {
+		if item == selected {
+			return i, nil
+		}
+	}
+	return -1, ErrNotFound("no item is selected")
+}
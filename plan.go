@@ -0,0 +1,320 @@
+package ecspresso
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+type ApplyOption struct {
+	Plan   string `arg:"" help:"plan file created by deploy --plan-out"`
+	DryRun bool   `help:"dry run" default:"false"`
+}
+
+// DeployPlan represents a deployment plan created by deploy --plan-out.
+type DeployPlan struct {
+	Version   string    `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Region    string    `json:"region"`
+	Cluster   string    `json:"cluster"`
+	Service   string    `json:"service"`
+
+	Option DeployOption `json:"option"`
+
+	// TaskDefinition is a task definition to be registered.
+	TaskDefinition json.RawMessage `json:"task_definition,omitempty"`
+	// TaskDefinitionArn is a task definition to be deployed without registering.
+	TaskDefinitionArn string `json:"task_definition_arn,omitempty"`
+	// ServiceDefinition is a service definition to update the service attributes.
+	ServiceDefinition json.RawMessage `json:"service_definition,omitempty"`
+
+	DesiredCount       *int32                   `json:"desired_count,omitempty"`
+	ServiceDiff        string                   `json:"service_diff,omitempty"`
+	TaskDefinitionDiff string                   `json:"task_definition_diff,omitempty"`
+	Tags               *DeployPlanTags          `json:"tags,omitempty"`
+	AutoScaling        *modifyAutoScalingParams `json:"auto_scaling,omitempty"`
+
+	Remote DeployPlanRemote `json:"remote"`
+}
+
+// DeployPlanTags represents changes of the service tags.
+type DeployPlanTags struct {
+	Added   []types.Tag `json:"added,omitempty"`
+	Updated []types.Tag `json:"updated,omitempty"`
+	Deleted []types.Tag `json:"deleted,omitempty"`
+}
+
+// DeployPlanRemote represents the remote service when the plan was created.
+type DeployPlanRemote struct {
+	ServiceArn        string `json:"service_arn"`
+	TaskDefinitionArn string `json:"task_definition_arn"`
+	// Fingerprints are hashes of the service attributes by the names.
+	Fingerprints map[string]string `json:"fingerprints"`
+}
+
+func (p *DeployPlan) taskDefinition() (*TaskDefinitionInput, error) {
+	if len(p.TaskDefinition) == 0 {
+		return nil, nil
+	}
+	var td TaskDefinitionInput
+	if err := UnmarshalJSONForStruct(p.TaskDefinition, &td, "plan"); err != nil {
+		return nil, fmt.Errorf("failed to load task definition in the plan: %w", err)
+	}
+	if len(td.Tags) == 0 {
+		td.Tags = nil
+	}
+	return &td, nil
+}
+
+func (p *DeployPlan) serviceDefinition() (*Service, error) {
+	if len(p.ServiceDefinition) == 0 {
+		return nil, nil
+	}
+	var sv Service
+	if err := UnmarshalJSONForStruct(p.ServiceDefinition, &sv, "plan"); err != nil {
+		return nil, fmt.Errorf("failed to load service definition in the plan: %w", err)
+	}
+	sv.ServiceName = aws.String(p.Service)
+	return &sv, nil
+}
+
+// serviceFingerprints returns hashes of the remote service attributes which affect a deployment by the attribute names.
+// DesiredCount is ignored as same as diff, because it may be changed by auto scaling after the plan was created.
+func serviceFingerprints(sv *Service) (map[string]string, error) {
+	svd := ServiceDefinitionForDiff(sv)
+	svd.UpdateServiceInput.DesiredCount = nil
+	b, err := MarshalJSONForAPI(svd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal service: %w", err)
+	}
+	var attrs map[string]json.RawMessage
+	if err := json.Unmarshal(b, &attrs); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal service: %w", err)
+	}
+	fps := make(map[string]string, len(attrs))
+	for name, v := range attrs {
+		h := sha256.Sum256(v)
+		fps[name] = hex.EncodeToString(h[:])
+	}
+	return fps, nil
+}
+
+func (d *App) createDeployPlan(ctx context.Context, sv *Service, opt DeployOption) (*DeployPlan, error) {
+	plan := &DeployPlan{
+		Version:   Version,
+		CreatedAt: time.Now(),
+		Region:    d.config.Region,
+		Cluster:   d.Cluster,
+		Service:   d.Service,
+		Option:    opt,
+		Remote: DeployPlanRemote{
+			ServiceArn:        aws.ToString(sv.ServiceArn),
+			TaskDefinitionArn: aws.ToString(sv.TaskDefinition),
+		},
+	}
+	plan.Option.PlanOut = ""
+
+	// task definition
+	var localTd *TaskDefinitionInput
+	localTdPath := d.config.TaskDefinitionPath
+	if opt.Revision > 0 || opt.LatestTaskDefinition || opt.SkipTaskDefinition {
+		tdArn, err := d.taskDefinitionArnForDeploy(ctx, sv, opt)
+		if err != nil {
+			return nil, err
+		}
+		plan.TaskDefinitionArn = tdArn
+		if tdArn != plan.Remote.TaskDefinitionArn {
+			if localTd, err = d.DescribeTaskDefinition(ctx, tdArn); err != nil {
+				return nil, err
+			}
+			localTdPath = tdArn
+		}
+	} else {
+		td, err := d.LoadTaskDefinition(d.config.TaskDefinitionPath)
+		if err != nil {
+			return nil, err
+		}
+		b, err := MarshalJSONForAPI(td)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal task definition: %w", err)
+		}
+		plan.TaskDefinition = b
+		localTd = td
+	}
+	if localTd != nil {
+		remoteTd, err := d.DescribeTaskDefinition(ctx, plan.Remote.TaskDefinitionArn)
+		if err != nil {
+			return nil, err
+		}
+		ds, err := diffTaskDefs(localTd, remoteTd, localTdPath, plan.Remote.TaskDefinitionArn, true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to diff of task definitions: %w", err)
+		}
+		plan.TaskDefinitionDiff = ds
+	}
+
+	// service definition
+	if d.config.ServiceDefinitionPath != "" && opt.UpdateService {
+		newSv, err := d.LoadServiceDefinition(d.config.ServiceDefinitionPath)
+		if err != nil {
+			return nil, err
+		}
+		b, err := MarshalJSONForAPI(newSv)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal service definition: %w", err)
+		}
+		plan.ServiceDefinition = b
+		added, updated, deleted := CompareTags(sv.Tags, newSv.Tags)
+		if len(added) > 0 || len(updated) > 0 || len(deleted) > 0 {
+			plan.Tags = &DeployPlanTags{Added: added, Updated: updated, Deleted: deleted}
+		}
+		ds, err := diffServices(newSv, sv, d.config.ServiceDefinitionPath, true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to diff of service definitions: %w", err)
+		}
+		plan.ServiceDiff = ds
+		plan.DesiredCount = calcDesiredCount(newSv, opt)
+	} else {
+		plan.DesiredCount = calcDesiredCount(sv, opt)
+	}
+
+	if p := opt.ModifyAutoScalingParams(); !p.isEmpty() {
+		plan.AutoScaling = p
+	}
+
+	fps, err := serviceFingerprints(sv)
+	if err != nil {
+		return nil, err
+	}
+	plan.Remote.Fingerprints = fps
+	return plan, nil
+}
+
+func (d *App) savePlan(ctx context.Context, sv *Service, opt DeployOption) error {
+	plan, err := d.createDeployPlan(ctx, sv, opt)
+	if err != nil {
+		return err
+	}
+	if plan.ServiceDiff != "" {
+		fmt.Fprint(d.humanOutput(), coloredDiff(plan.ServiceDiff))
+	}
+	if plan.TaskDefinitionDiff != "" {
+		fmt.Fprint(d.humanOutput(), coloredDiff(plan.TaskDefinitionDiff))
+	}
+	if t := plan.Tags; t != nil {
+		for _, tag := range append(t.Added, t.Updated...) {
+			d.Log("service tag %s=%s will be set", aws.ToString(tag.Key), aws.ToString(tag.Value))
+		}
+		for _, tag := range t.Deleted {
+			d.Log("service tag %s will be deleted", aws.ToString(tag.Key))
+		}
+	}
+	if plan.AutoScaling != nil {
+		d.Log("auto scaling settings will be modified: %s", plan.AutoScaling.String())
+	}
+	if plan.DesiredCount != nil {
+		d.Log("desired count: %d", *plan.DesiredCount)
+	}
+
+	b, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal plan: %w", err)
+	}
+	if err := os.WriteFile(opt.PlanOut, append(b, '\n'), CreateFileMode); err != nil {
+		return fmt.Errorf("failed to save plan: %w", err)
+	}
+	d.Log("Plan is saved to %s. Run `ecspresso apply %s` to deploy.", opt.PlanOut, opt.PlanOut)
+	return nil
+}
+
+func loadDeployPlan(path string) (*DeployPlan, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan %s: %w", path, err)
+	}
+	var plan DeployPlan
+	if err := json.Unmarshal(b, &plan); err != nil {
+		return nil, fmt.Errorf("failed to parse plan %s: %w", path, err)
+	}
+	return &plan, nil
+}
+
+// checkDrift returns an error when the remote service has been changed since the plan was created.
+func (p *DeployPlan) checkDrift(sv *Service) error {
+	if arn := aws.ToString(sv.ServiceArn); arn != p.Remote.ServiceArn {
+		return fmt.Errorf("the plan was created for %s, but the service is %s", p.Remote.ServiceArn, arn)
+	}
+	if tdArn := aws.ToString(sv.TaskDefinition); tdArn != p.Remote.TaskDefinitionArn {
+		return fmt.Errorf("task definition of the service was changed from %s to %s after the plan was created", arnToName(p.Remote.TaskDefinitionArn), arnToName(tdArn))
+	}
+	fps, err := serviceFingerprints(sv)
+	if err != nil {
+		return err
+	}
+	var drifted []string
+	for name, fp := range fps {
+		if p.Remote.Fingerprints[name] != fp {
+			drifted = append(drifted, name)
+		}
+	}
+	for name := range p.Remote.Fingerprints {
+		if _, ok := fps[name]; !ok {
+			drifted = append(drifted, name)
+		}
+	}
+	if len(drifted) > 0 {
+		sort.Strings(drifted)
+		return fmt.Errorf("the service was changed after the plan was created: %s", strings.Join(drifted, ", "))
+	}
+	return nil
+}
+
+func (d *App) Apply(ctx context.Context, opt ApplyOption) error {
+	plan, err := loadDeployPlan(opt.Plan)
+	if err != nil {
+		return err
+	}
+	if plan.Cluster != d.Cluster || plan.Service != d.Service {
+		return fmt.Errorf("the plan is for %s/%s, but the config is for %s/%s", plan.Service, plan.Cluster, d.Service, d.Cluster)
+	}
+	if plan.Region != d.config.Region {
+		return fmt.Errorf("the plan is for the region %s, but the config is for %s", plan.Region, d.config.Region)
+	}
+	d.Log("Applying the plan created at %s", plan.CreatedAt.In(time.Local).Format(EventTimeFormat))
+	dopt := plan.Option
+	dopt.DryRun = opt.DryRun
+	return d.deploy(ctx, dopt, plan)
+}
+
+func (d *App) taskDefinitionArnForPlan(ctx context.Context, plan *DeployPlan, opt DeployOption) (string, error) {
+	if plan.TaskDefinitionArn != "" {
+		return plan.TaskDefinitionArn, nil
+	}
+	td, err := plan.taskDefinition()
+	if err != nil {
+		return "", err
+	}
+	if td == nil {
+		return "", errors.New("no task definition in the plan")
+	}
+	if opt.DryRun {
+		d.Log("[INFO] task definition:")
+		d.OutputJSONForAPI(os.Stderr, td)
+		return "", nil
+	}
+	newTd, err := d.RegisterTaskDefinition(ctx, td)
+	if err != nil {
+		return "", err
+	}
+	return *newTd.TaskDefinitionArn, nil
+}
@@ -0,0 +1,170 @@
+package ecspresso_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/kayac/ecspresso/v2"
+)
+
+const (
+	testServiceArn = "arn:aws:ecs:us-east-1:123456789012:service/default/test"
+	testTdArn      = "arn:aws:ecs:us-east-1:123456789012:task-definition/test:39"
+)
+
+func loadRemoteServiceForPlan(t *testing.T, app *ecspresso.App) *ecspresso.Service {
+	t.Helper()
+	sv, err := app.LoadServiceDefinition(app.Config().ServiceDefinitionPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv.ServiceArn = aws.String(testServiceArn)
+	sv.TaskDefinition = aws.String(testTdArn)
+	return sv
+}
+
+func TestDeployPlanRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	app, err := ecspresso.New(ctx, &ecspresso.CLIOptions{ConfigFilePath: "tests/test.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	td, err := app.LoadTaskDefinition(app.Config().TaskDefinitionPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv, err := app.LoadServiceDefinition(app.Config().ServiceDefinitionPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tdJSON := ecspresso.MustMarshalJSONStringForAPI(td)
+	svJSON := ecspresso.MustMarshalJSONStringForAPI(sv)
+	plan := &ecspresso.DeployPlan{
+		Cluster:           "default",
+		Service:           "test",
+		Option:            ecspresso.DeployOption{DesiredCount: aws.Int32(3), UpdateService: true, Wait: true},
+		TaskDefinition:    json.RawMessage(tdJSON),
+		ServiceDefinition: json.RawMessage(svJSON),
+	}
+	b, err := json.Marshal(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "plan.json")
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := ecspresso.LoadDeployPlan(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aws.ToInt32(loaded.Option.DesiredCount) != 3 || !loaded.Option.UpdateService || !loaded.Option.Wait {
+		t.Errorf("unexpected option %#v", loaded.Option)
+	}
+	loadedTd, err := loaded.TaskDefinitionInput()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := ecspresso.MustMarshalJSONStringForAPI(loadedTd); s != tdJSON {
+		t.Errorf("unexpected task definition in the plan\n%s\nexpected\n%s", s, tdJSON)
+	}
+	loadedSv, err := loaded.ServiceDefinitionInput()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := ecspresso.MustMarshalJSONStringForAPI(loadedSv); s != svJSON {
+		t.Errorf("unexpected service definition in the plan\n%s\nexpected\n%s", s, svJSON)
+	}
+}
+
+func TestDeployPlanCheckDrift(t *testing.T) {
+	ctx := context.Background()
+	app, err := ecspresso.New(ctx, &ecspresso.CLIOptions{ConfigFilePath: "tests/test.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fps, err := ecspresso.ServiceFingerprints(loadRemoteServiceForPlan(t, app))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := &ecspresso.DeployPlan{
+		Remote: ecspresso.DeployPlanRemote{
+			ServiceArn:        testServiceArn,
+			TaskDefinitionArn: testTdArn,
+			Fingerprints:      fps,
+		},
+	}
+
+	if err := plan.CheckDrift(loadRemoteServiceForPlan(t, app)); err != nil {
+		t.Errorf("unexpected drift: %s", err)
+	}
+
+	// desired count may be changed by auto scaling
+	sv := loadRemoteServiceForPlan(t, app)
+	sv.DesiredCount = aws.Int32(5)
+	if err := plan.CheckDrift(sv); err != nil {
+		t.Errorf("desired count must not be a drift: %s", err)
+	}
+
+	drifts := map[string]struct {
+		fn  func(sv *ecspresso.Service)
+		msg string
+	}{
+		"task definition": {
+			fn:  func(sv *ecspresso.Service) { sv.TaskDefinition = aws.String(testTdArn + "0") },
+			msg: "task definition of the service was changed",
+		},
+		"service arn": {
+			fn:  func(sv *ecspresso.Service) { sv.ServiceArn = aws.String(testServiceArn + "2") },
+			msg: "the plan was created for",
+		},
+		"tags": {
+			fn:  func(sv *ecspresso.Service) { sv.Tags = nil },
+			msg: "the service was changed after the plan was created: tags",
+		},
+		"grace period": {
+			fn:  func(sv *ecspresso.Service) { sv.HealthCheckGracePeriodSeconds = aws.Int32(999) },
+			msg: "the service was changed after the plan was created: healthCheckGracePeriodSeconds",
+		},
+	}
+	for name, d := range drifts {
+		sv := loadRemoteServiceForPlan(t, app)
+		d.fn(sv)
+		if err := plan.CheckDrift(sv); err == nil {
+			t.Errorf("drift of %s is not detected", name)
+		} else if !strings.Contains(err.Error(), d.msg) {
+			t.Errorf("unexpected error for drift of %s: %s", name, err)
+		}
+	}
+}
+
+func TestApplyPlanOfAnotherRegion(t *testing.T) {
+	ctx := context.Background()
+	app, err := ecspresso.New(ctx, &ecspresso.CLIOptions{ConfigFilePath: "tests/test.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := &ecspresso.DeployPlan{
+		Region:  "eu-west-1",
+		Cluster: app.Config().Cluster,
+		Service: app.Config().Service,
+	}
+	b, err := json.Marshal(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "plan.json")
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = app.Apply(ctx, ecspresso.ApplyOption{Plan: path})
+	if err == nil || !strings.Contains(err.Error(), "region eu-west-1") {
+		t.Errorf("plan of another region must be rejected: %v", err)
+	}
+}
@@ -12,8 +12,10 @@ import (
 )
 
 type RenderOption struct {
-	Targets *[]string `arg:"" help:"target to render (config, service-definition, servicedef, task-definition, taskdef)" enum:"config,service-definition,servicedef,task-definition,taskdef"`
-	Jsonnet bool      `help:"render as jsonnet format" default:"false"`
+	Targets        *[]string `arg:"" help:"target to render (config, service-definition, servicedef, task-definition, taskdef, compose)" enum:"config,service-definition,servicedef,task-definition,taskdef,compose"`
+	Jsonnet        bool      `help:"render as jsonnet format" default:"false"`
+	ResolveSecrets bool      `help:"resolve secrets to the values in compose" default:"false"`
+	EnvFilesDir    string    `help:"directory to download environment files in compose" default:""`
 }
 
 func (d *App) Render(ctx context.Context, opt RenderOption) error {
@@ -70,6 +72,10 @@ func (d *App) Render(ctx context.Context, opt RenderOption) error {
 			if _, err := out.WriteString(s); err != nil {
 				return err
 			}
+		case "compose":
+			if err := d.renderCompose(ctx, out, opt); err != nil {
+				return err
+			}
 		default:
 			return fmt.Errorf("unknown target: %s", target)
 		}
@@ -0,0 +1,388 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/goccy/go-yaml"
+)
+
+// composeProject is a docker-compose.yml converted from a task definition.
+type composeProject struct {
+	Services yaml.MapSlice       `yaml:"services"`
+	Volumes  map[string]struct{} `yaml:"volumes,omitempty"`
+}
+
+type composeService struct {
+	Image           string                      `yaml:"image"`
+	Platform        string                      `yaml:"platform,omitempty"`
+	Entrypoint      []string                    `yaml:"entrypoint,omitempty"`
+	Command         []string                    `yaml:"command,omitempty"`
+	WorkingDir      string                      `yaml:"working_dir,omitempty"`
+	User            string                      `yaml:"user,omitempty"`
+	Hostname        string                      `yaml:"hostname,omitempty"`
+	Environment     map[string]string           `yaml:"environment,omitempty"`
+	EnvFile         []string                    `yaml:"env_file,omitempty"`
+	Ports           []string                    `yaml:"ports,omitempty"`
+	NetworkMode     string                      `yaml:"network_mode,omitempty"`
+	DependsOn       map[string]composeDependsOn `yaml:"depends_on,omitempty"`
+	Healthcheck     *composeHealthcheck         `yaml:"healthcheck,omitempty"`
+	Volumes         []string                    `yaml:"volumes,omitempty"`
+	VolumesFrom     []string                    `yaml:"volumes_from,omitempty"`
+	Cpus            string                      `yaml:"cpus,omitempty"`
+	MemLimit        string                      `yaml:"mem_limit,omitempty"`
+	MemReservation  string                      `yaml:"mem_reservation,omitempty"`
+	Ulimits         map[string]composeUlimit    `yaml:"ulimits,omitempty"`
+	Labels          map[string]string           `yaml:"labels,omitempty"`
+	ExtraHosts      []string                    `yaml:"extra_hosts,omitempty"`
+	DNS             []string                    `yaml:"dns,omitempty"`
+	Init            bool                        `yaml:"init,omitempty"`
+	Privileged      bool                        `yaml:"privileged,omitempty"`
+	ReadOnly        bool                        `yaml:"read_only,omitempty"`
+	StdinOpen       bool                        `yaml:"stdin_open,omitempty"`
+	Tty             bool                        `yaml:"tty,omitempty"`
+	StopGracePeriod string                      `yaml:"stop_grace_period,omitempty"`
+}
+
+type composeDependsOn struct {
+	Condition string `yaml:"condition"`
+}
+
+type composeHealthcheck struct {
+	Test        []string `yaml:"test"`
+	Interval    string   `yaml:"interval,omitempty"`
+	Timeout     string   `yaml:"timeout,omitempty"`
+	Retries     int32    `yaml:"retries,omitempty"`
+	StartPeriod string   `yaml:"start_period,omitempty"`
+}
+
+type composeUlimit struct {
+	Soft int32 `yaml:"soft"`
+	Hard int32 `yaml:"hard"`
+}
+
+// composeDependsOnConditions maps the conditions of dependsOn to the ones of docker compose.
+var composeDependsOnConditions = map[types.ContainerCondition]string{
+	types.ContainerConditionStart:    "service_started",
+	types.ContainerConditionComplete: "service_completed_successfully",
+	types.ContainerConditionSuccess:  "service_completed_successfully",
+	types.ContainerConditionHealthy:  "service_healthy",
+}
+
+// renderCompose writes the task definition as a docker-compose.yml.
+func (d *App) renderCompose(ctx context.Context, w io.Writer, opt RenderOption) error {
+	td, err := d.LoadTaskDefinition(d.config.TaskDefinitionPath)
+	if err != nil {
+		return err
+	}
+	p, err := d.composeProject(ctx, td, opt)
+	if err != nil {
+		return err
+	}
+	return yaml.NewEncoder(w).Encode(p)
+}
+
+// composeProject converts the task definition to a compose project.
+// The fields not supported by docker compose are reported as warnings.
+func (d *App) composeProject(ctx context.Context, td *TaskDefinitionInput, opt RenderOption) (*composeProject, error) {
+	p := &composeProject{}
+	volumes := make(map[string]types.Volume, len(td.Volumes))
+	for _, v := range td.Volumes {
+		volumes[aws.ToString(v.Name)] = v
+		if v.EfsVolumeConfiguration != nil || v.FsxWindowsFileServerVolumeConfiguration != nil {
+			d.Log("[WARNING] volume %s is rendered as a local named volume. EFS and FSx are not supported", aws.ToString(v.Name))
+		}
+	}
+	var platform string
+	if rp := td.RuntimePlatform; rp != nil {
+		switch rp.CpuArchitecture {
+		case types.CPUArchitectureArm64:
+			platform = "linux/arm64"
+		case types.CPUArchitectureX8664:
+			platform = "linux/amd64"
+		}
+	}
+	var secrets *secretResolver
+	if opt.ResolveSecrets {
+		secrets = newSecretResolver(d.config.awsv2Config)
+	}
+	// containers in a task of awsvpc network mode share the network namespace,
+	// so the others join the network of the first container which publishes all the ports.
+	var networkOwner *composeService
+	for _, c := range td.ContainerDefinitions {
+		name := aws.ToString(c.Name)
+		s := &composeService{
+			Image:      composeEscape(aws.ToString(c.Image)),
+			Platform:   platform,
+			Entrypoint: composeEscapeSlice(c.EntryPoint),
+			Command:    composeEscapeSlice(c.Command),
+			WorkingDir: composeEscape(aws.ToString(c.WorkingDirectory)),
+			User:       composeEscape(aws.ToString(c.User)),
+			Hostname:   composeEscape(aws.ToString(c.Hostname)),
+			Labels:     composeEscapeMap(c.DockerLabels),
+			DNS:        composeEscapeSlice(c.DnsServers),
+			Privileged: aws.ToBool(c.Privileged),
+			ReadOnly:   aws.ToBool(c.ReadonlyRootFilesystem),
+			StdinOpen:  aws.ToBool(c.Interactive),
+			Tty:        aws.ToBool(c.PseudoTerminal),
+		}
+		if err := d.composeEnvironment(ctx, s, &c, secrets, opt); err != nil {
+			return nil, err
+		}
+		ports := composePorts(c.PortMappings)
+		if td.NetworkMode == types.NetworkModeAwsvpc {
+			if networkOwner == nil {
+				networkOwner = s
+			} else {
+				s.NetworkMode = "service:" + aws.ToString(td.ContainerDefinitions[0].Name)
+				s.Hostname = ""
+			}
+			networkOwner.Ports = append(networkOwner.Ports, ports...)
+		} else {
+			s.Ports = ports
+		}
+		for _, dep := range c.DependsOn {
+			if s.DependsOn == nil {
+				s.DependsOn = map[string]composeDependsOn{}
+			}
+			if dep.Condition == types.ContainerConditionComplete {
+				d.Log("[WARNING] dependsOn COMPLETE of %s is rendered as service_completed_successfully", name)
+			}
+			s.DependsOn[aws.ToString(dep.ContainerName)] = composeDependsOn{Condition: composeDependsOnConditions[dep.Condition]}
+		}
+		if hc := c.HealthCheck; hc != nil {
+			s.Healthcheck = &composeHealthcheck{
+				Test:        composeEscapeSlice(hc.Command),
+				Interval:    composeSeconds(hc.Interval),
+				Timeout:     composeSeconds(hc.Timeout),
+				Retries:     aws.ToInt32(hc.Retries),
+				StartPeriod: composeSeconds(hc.StartPeriod),
+			}
+		}
+		for _, mp := range c.MountPoints {
+			vname := aws.ToString(mp.SourceVolume)
+			source := vname
+			if v, ok := volumes[vname]; ok && v.Host != nil && aws.ToString(v.Host.SourcePath) != "" {
+				source = aws.ToString(v.Host.SourcePath)
+			} else {
+				if p.Volumes == nil {
+					p.Volumes = map[string]struct{}{}
+				}
+				p.Volumes[vname] = struct{}{}
+			}
+			vol := source + ":" + aws.ToString(mp.ContainerPath)
+			if aws.ToBool(mp.ReadOnly) {
+				vol += ":ro"
+			}
+			s.Volumes = append(s.Volumes, composeEscape(vol))
+		}
+		for _, vf := range c.VolumesFrom {
+			from := aws.ToString(vf.SourceContainer)
+			if aws.ToBool(vf.ReadOnly) {
+				from += ":ro"
+			}
+			s.VolumesFrom = append(s.VolumesFrom, from)
+		}
+		if c.Cpu > 0 {
+			s.Cpus = strconv.FormatFloat(float64(c.Cpu)/1024, 'f', -1, 64)
+		}
+		if c.Memory != nil {
+			s.MemLimit = fmt.Sprintf("%dm", *c.Memory)
+		}
+		if c.MemoryReservation != nil {
+			s.MemReservation = fmt.Sprintf("%dm", *c.MemoryReservation)
+		}
+		for _, u := range c.Ulimits {
+			if s.Ulimits == nil {
+				s.Ulimits = map[string]composeUlimit{}
+			}
+			s.Ulimits[string(u.Name)] = composeUlimit{Soft: u.SoftLimit, Hard: u.HardLimit}
+		}
+		for _, h := range c.ExtraHosts {
+			s.ExtraHosts = append(s.ExtraHosts, composeEscape(aws.ToString(h.Hostname)+":"+aws.ToString(h.IpAddress)))
+		}
+		if lp := c.LinuxParameters; lp != nil {
+			s.Init = aws.ToBool(lp.InitProcessEnabled)
+		}
+		if c.StopTimeout != nil {
+			s.StopGracePeriod = fmt.Sprintf("%ds", *c.StopTimeout)
+		}
+		for _, field := range unsupportedComposeFields(&c) {
+			d.Log("[WARNING] %s of the container %s is not supported by compose. ignored", field, name)
+		}
+		p.Services = append(p.Services, yaml.MapItem{Key: name, Value: s})
+	}
+	return p, nil
+}
+
+// unsupportedComposeFields returns the fields of the container definition ignored by composeProject.
+func unsupportedComposeFields(c *types.ContainerDefinition) []string {
+	var fields []string
+	if c.LogConfiguration != nil {
+		fields = append(fields, "logConfiguration")
+	}
+	if c.FirelensConfiguration != nil {
+		fields = append(fields, "firelensConfiguration")
+	}
+	if c.RepositoryCredentials != nil {
+		fields = append(fields, "repositoryCredentials")
+	}
+	if len(c.ResourceRequirements) > 0 {
+		fields = append(fields, "resourceRequirements")
+	}
+	if len(c.Links) > 0 {
+		fields = append(fields, "links")
+	}
+	if len(c.DockerSecurityOptions) > 0 {
+		fields = append(fields, "dockerSecurityOptions")
+	}
+	if len(c.SystemControls) > 0 {
+		fields = append(fields, "systemControls")
+	}
+	if lp := c.LinuxParameters; lp != nil {
+		if lp.Capabilities != nil || len(lp.Devices) > 0 || lp.SharedMemorySize != nil || len(lp.Tmpfs) > 0 ||
+			lp.MaxSwap != nil || lp.Swappiness != nil {
+			fields = append(fields, "linuxParameters (except initProcessEnabled)")
+		}
+	}
+	return fields
+}
+
+func composePorts(pms []types.PortMapping) []string {
+	var ports []string
+	for _, pm := range pms {
+		port := strconv.Itoa(int(aws.ToInt32(pm.ContainerPort)))
+		if hp := aws.ToInt32(pm.HostPort); hp != 0 {
+			port = strconv.Itoa(int(hp)) + ":" + port
+		} else {
+			port = port + ":" + port
+		}
+		if pm.Protocol == types.TransportProtocolUdp {
+			port += "/udp"
+		}
+		ports = append(ports, port)
+	}
+	return ports
+}
+
+func composeSeconds(n *int32) string {
+	if n == nil {
+		return ""
+	}
+	return (time.Duration(*n) * time.Second).String()
+}
+
+// composeEscape escapes "$" not to be interpolated by docker compose.
+// All strings copied from the task definition must be escaped, because ECS does not interpolate them.
+func composeEscape(s string) string {
+	return strings.ReplaceAll(s, "$", "$$")
+}
+
+func composeEscapeSlice(ss []string) []string {
+	if ss == nil {
+		return nil
+	}
+	escaped := make([]string, len(ss))
+	for i, s := range ss {
+		escaped[i] = composeEscape(s)
+	}
+	return escaped
+}
+
+func composeEscapeMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	escaped := make(map[string]string, len(m))
+	for k, v := range m {
+		escaped[k] = composeEscape(v)
+	}
+	return escaped
+}
+
+// composeEnvironment sets the environment, the env files and the secrets of the container.
+// The secrets are placeholders interpolated by the environment variables of the same names, or the resolved values with opt.ResolveSecrets.
+func (d *App) composeEnvironment(ctx context.Context, s *composeService, c *types.ContainerDefinition, secrets *secretResolver, opt RenderOption) error {
+	name := aws.ToString(c.Name)
+	for _, kv := range c.Environment {
+		if s.Environment == nil {
+			s.Environment = map[string]string{}
+		}
+		s.Environment[aws.ToString(kv.Name)] = composeEscape(aws.ToString(kv.Value))
+	}
+	for _, sec := range c.Secrets {
+		if s.Environment == nil {
+			s.Environment = map[string]string{}
+		}
+		key, from := aws.ToString(sec.Name), aws.ToString(sec.ValueFrom)
+		if !opt.ResolveSecrets {
+			s.Environment[key] = fmt.Sprintf("${%s:?%s of the container %s is a secret from %s}", key, key, name, from)
+			continue
+		}
+		v, err := secrets.value(ctx, from)
+		if err != nil {
+			return err
+		}
+		s.Environment[key] = composeEscape(v)
+	}
+	for _, ef := range c.EnvironmentFiles {
+		p, err := d.composeEnvFile(ctx, ef, opt.EnvFilesDir)
+		if err != nil {
+			return err
+		}
+		s.EnvFile = append(s.EnvFile, p)
+	}
+	return nil
+}
+
+// composeEnvFile downloads the environment file from S3 into dir, and returns the local path.
+// When dir is empty, it returns the file name without downloading.
+func (d *App) composeEnvFile(ctx context.Context, ef types.EnvironmentFile, dir string) (string, error) {
+	s3arn := aws.ToString(ef.Value)
+	a, err := arn.Parse(s3arn)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse s3 arn %s: %w", s3arn, err)
+	}
+	bucket, key, ok := strings.Cut(a.Resource, "/")
+	if a.Service != "s3" || !ok {
+		return "", fmt.Errorf("invalid s3 arn %s", s3arn)
+	}
+	if dir == "" {
+		d.Log("[WARNING] environment file %s is not downloaded. put it at %s", s3arn, path.Base(key))
+		return path.Base(key), nil
+	}
+	local := filepath.Join(dir, bucket, filepath.FromSlash(key))
+	out, err := s3.NewFromConfig(d.config.awsv2Config).GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get s3 object %s: %w", s3arn, err)
+	}
+	defer out.Body.Close()
+	if err := os.MkdirAll(filepath.Dir(local), 0755); err != nil {
+		return "", err
+	}
+	// environment files often contain secrets, so they are readable only by the owner.
+	f, err := os.OpenFile(local, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, out.Body); err != nil {
+		return "", fmt.Errorf("failed to download s3 object %s: %w", s3arn, err)
+	}
+	d.Log("[INFO] environment file %s is downloaded to %s", s3arn, local)
+	return local, nil
+}
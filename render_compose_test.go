@@ -0,0 +1,202 @@
+package ecspresso_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmTypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/google/go-cmp/cmp"
+	"github.com/kayac/ecspresso/v2"
+)
+
+var composeTaskDefinition = &ecspresso.TaskDefinitionInput{
+	Family:      aws.String("test"),
+	NetworkMode: types.NetworkModeAwsvpc,
+	RuntimePlatform: &types.RuntimePlatform{
+		CpuArchitecture: types.CPUArchitectureArm64,
+	},
+	Volumes: []types.Volume{
+		{Name: aws.String("data")},
+		{Name: aws.String("config"), Host: &types.HostVolumeProperties{SourcePath: aws.String("./config")}},
+	},
+	ContainerDefinitions: []types.ContainerDefinition{
+		{
+			Name:    aws.String("app"),
+			Image:   aws.String("example/app:latest"),
+			Command: []string{"app", "serve"},
+			Cpu:     512,
+			Memory:  aws.Int32(1024),
+			Environment: []types.KeyValuePair{
+				{Name: aws.String("PRICE"), Value: aws.String("$100")},
+			},
+			Secrets: []types.Secret{
+				{Name: aws.String("DB_PASSWORD"), ValueFrom: aws.String("arn:aws:ssm:ap-northeast-1:123456789012:parameter/db/password")},
+			},
+			PortMappings: []types.PortMapping{
+				{ContainerPort: aws.Int32(8080), HostPort: aws.Int32(8080)},
+			},
+			DependsOn: []types.ContainerDependency{
+				{ContainerName: aws.String("migrate"), Condition: types.ContainerConditionSuccess},
+				{ContainerName: aws.String("proxy"), Condition: types.ContainerConditionHealthy},
+			},
+			MountPoints: []types.MountPoint{
+				{SourceVolume: aws.String("data"), ContainerPath: aws.String("/data")},
+				{SourceVolume: aws.String("config"), ContainerPath: aws.String("/etc/app"), ReadOnly: aws.Bool(true)},
+			},
+			LinuxParameters: &types.LinuxParameters{InitProcessEnabled: aws.Bool(true)},
+			LogConfiguration: &types.LogConfiguration{
+				LogDriver: types.LogDriverAwslogs,
+			},
+		},
+		{
+			Name:  aws.String("proxy"),
+			Image: aws.String("example/proxy:latest"),
+			PortMappings: []types.PortMapping{
+				{ContainerPort: aws.Int32(53), Protocol: types.TransportProtocolUdp},
+			},
+			HealthCheck: &types.HealthCheck{
+				Command:  []string{"CMD-SHELL", "curl -f http://localhost:${PORT}/ || exit 1"},
+				Interval: aws.Int32(30),
+				Retries:  aws.Int32(3),
+			},
+		},
+		{
+			Name:    aws.String("migrate"),
+			Image:   aws.String("example/app:latest"),
+			Command: []string{"sh", "-c", "app migrate --port $PORT"},
+			DockerLabels: map[string]string{
+				"app.cost": "$0",
+			},
+		},
+	},
+}
+
+func TestRenderCompose(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("AWS_REGION", "ap-northeast-1")
+	app, err := ecspresso.New(ctx, &ecspresso.CLIOptions{ConfigFilePath: "tests/ecspresso.yml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs bytes.Buffer
+	app.SetLogger(log.New(&logs, "", 0))
+
+	s, err := app.RenderComposeYAML(ctx, composeTaskDefinition, ecspresso.RenderOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(s, "services:\n  app:\n") {
+		t.Errorf("services must be ordered as the container definitions: %s", s)
+	}
+	for _, expected := range []string{
+		"platform: linux/arm64",
+		"PRICE: $$100",
+		"DB_PASSWORD: ${DB_PASSWORD:?DB_PASSWORD of the container app is a secret from arn:aws:ssm:ap-northeast-1:123456789012:parameter/db/password}",
+		`- "8080:8080"`,
+		"- 53:53/udp",
+		"network_mode: service:app",
+		"condition: service_completed_successfully",
+		"condition: service_healthy",
+		"- CMD-SHELL",
+		"- curl -f http://localhost:$${PORT}/ || exit 1",
+		"- app migrate --port $$PORT",
+		"app.cost: $$0",
+		"interval: 30s",
+		"retries: 3",
+		"- data:/data",
+		"- ./config:/etc/app:ro",
+		`cpus: "0.5"`,
+		"mem_limit: 1024m",
+		"init: true",
+		"volumes:\n  data: {}",
+	} {
+		if !strings.Contains(s, expected) {
+			t.Errorf("compose must contain %q", expected)
+		}
+	}
+	if !strings.Contains(logs.String(), "[WARNING] logConfiguration of the container app is not supported") {
+		t.Errorf("unexpected warnings: %s", logs.String())
+	}
+}
+
+func TestRenderComposeResolveSecrets(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("AWS_REGION", "cn-north-1")
+	var secretIds []string
+	ecspresso.SetAWSV2ConfigLoadOptionsFunc([]func(*config.LoadOptions) error{
+		config.WithRegion("cn-north-1"),
+		config.WithAPIOptions([]func(*middleware.Stack) error{
+			func(stack *middleware.Stack) error {
+				return stack.Initialize.Add(
+					middleware.InitializeMiddlewareFunc(
+						"test",
+						func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+							var out any
+							switch p := in.Parameters.(type) {
+							case *secretsmanager.GetSecretValueInput:
+								secretIds = append(secretIds, aws.ToString(p.SecretId))
+								out = &secretsmanager.GetSecretValueOutput{SecretString: aws.String(`{"password":"pa$$word"}`)}
+							case *ssm.GetParameterInput:
+								if name := aws.ToString(p.Name); name != "/db/user" {
+									return middleware.InitializeOutput{}, middleware.Metadata{}, fmt.Errorf("unexpected parameter %s", name)
+								}
+								out = &ssm.GetParameterOutput{Parameter: &ssmTypes.Parameter{Value: aws.String("admin")}}
+							default:
+								return middleware.InitializeOutput{}, middleware.Metadata{}, fmt.Errorf("unexpected call %T", in.Parameters)
+							}
+							return middleware.InitializeOutput{Result: out}, middleware.Metadata{}, nil
+						},
+					),
+					middleware.Before,
+				)
+			},
+		}),
+	})
+	defer ecspresso.ResetAWSV2ConfigLoadOptionsFunc()
+
+	app, err := ecspresso.New(ctx, &ecspresso.CLIOptions{ConfigFilePath: "tests/ecspresso.yml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.SetLogger(log.New(io.Discard, "", 0))
+
+	td := &ecspresso.TaskDefinitionInput{
+		Family: aws.String("test"),
+		ContainerDefinitions: []types.ContainerDefinition{
+			{
+				Name:  aws.String("app"),
+				Image: aws.String("example/app:latest"),
+				Secrets: []types.Secret{
+					{Name: aws.String("DB_PASSWORD"), ValueFrom: aws.String("arn:aws-cn:secretsmanager:cn-north-1:123456789012:secret:db-AbCdEf:password::")},
+					{Name: aws.String("DB_USER"), ValueFrom: aws.String("arn:aws-cn:ssm:cn-north-1:123456789012:parameter/db/user")},
+				},
+			},
+		},
+	}
+	s, err := app.RenderComposeYAML(ctx, td, ecspresso.RenderOption{ResolveSecrets: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"DB_PASSWORD: pa$$$$word",
+		"DB_USER: admin",
+	} {
+		if !strings.Contains(s, expected) {
+			t.Errorf("compose must contain %q: %s", expected, s)
+		}
+	}
+	if d := cmp.Diff(secretIds, []string{"arn:aws-cn:secretsmanager:cn-north-1:123456789012:secret:db-AbCdEf"}); d != "" {
+		t.Errorf("unexpected secret ids: %s", d)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/ecs"
 	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
 	"github.com/kayac/ecspresso/v2/appspec"
+	"github.com/samber/lo"
 	"github.com/shogo82148/go-retry"
 )
 
@@ -21,6 +22,10 @@ type RollbackOption struct {
 	DeregisterTaskDefinition bool   `help:"deregister the rolled-back task definition. not works with --no-wait" default:"true" negatable:""`
 	Wait                     bool   `help:"wait for the service stable" default:"true" negatable:""`
 	RollbackEvents           string `help:"roll back when specified events happened (DEPLOYMENT_FAILURE,DEPLOYMENT_STOP_ON_ALARM,DEPLOYMENT_STOP_ON_REQUEST,...) CodeDeploy only." default:""`
+	ToDeployment             string `help:"roll back to the task definition of the ECS service deployment (ID or ARN)" default:""`
+	Revision                 int64  `help:"roll back to the revision of the task definition family" default:"0"`
+	Select                   bool   `help:"choose the service deployment to roll back to interactively. ECS deployment controller only. (default when stdin is a terminal)" default:"false"`
+	NoSelect                 bool   `help:"do not choose the service deployment interactively even if stdin is a terminal" default:"false"`
 }
 
 func (opt RollbackOption) DryRunString() string {
@@ -30,13 +35,49 @@ func (opt RollbackOption) DryRunString() string {
 	return ""
 }
 
-func (d *App) Rollback(ctx context.Context, opt RollbackOption) error {
+func (d *App) Rollback(ctx context.Context, opt RollbackOption) (err error) {
 	ctx, cancel := d.Start(ctx)
 	defer cancel()
 
 	if opt.DeregisterTaskDefinition && !opt.Wait {
 		return fmt.Errorf("--deregister-task-definition not works with --no-wait together. Please use --no-deregister-task-definition with --no-wait")
 	}
+	if opt.ToDeployment != "" && opt.Revision > 0 {
+		return ErrConflictOptions("--to-deployment and --revision are exclusive")
+	}
+	if opt.Select && opt.hasTarget() {
+		return ErrConflictOptions("--select can't be used with --to-deployment or --revision")
+	}
+	if opt.Select && opt.NoSelect {
+		return ErrConflictOptions("--select and --no-select are exclusive")
+	}
+
+	if !opt.DryRun {
+		unlock, err := d.lock(ctx, "rollback")
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	var rec *HistoryRecord
+	if !opt.DryRun {
+		rec = d.newHistoryRecord(historyOperationRollback)
+		defer func() { d.recordHistory(rec, err) }()
+		ctx = d.withNotification(ctx, "rollback")
+		d.notify(ctx, NotificationEventStarted, nil)
+		defer func() {
+			if err == nil {
+				d.notify(ctx, NotificationEventRolledBack, nil)
+			} else {
+				d.notifyResult(ctx, err)
+			}
+		}()
+	}
+	var report *deploymentReport
+	if !opt.DryRun {
+		report = d.newDeploymentReport("rollback")
+		defer func() { d.writeDeploymentReport(ctx, report, err) }()
+	}
 
 	d.Log("Starting rollback %s", opt.DryRunString())
 	sv, err := d.DescribeServiceStatus(ctx, 0)
@@ -50,7 +91,7 @@ func (d *App) Rollback(ctx context.Context, opt RollbackOption) error {
 		return err
 	}
 
-	doWait, err := d.WaitFunc(sv)
+	doWait, err := d.rollbackWaitFunc(sv)
 	if err != nil {
 		return err
 	}
@@ -60,6 +101,12 @@ func (d *App) Rollback(ctx context.Context, opt RollbackOption) error {
 	if err != nil {
 		return err
 	}
+	if rec != nil {
+		rec.PreviousTaskDefinitionArn = rollbackedTdArn
+	}
+	if report != nil {
+		report.PreviousTaskDefinitionArn = rollbackedTdArn
+	}
 
 	if opt.DryRun {
 		if err := d.rollbackTaskDefinition(ctx, rollbackedTdArn, opt); err != nil {
@@ -113,17 +160,31 @@ func (d *App) rollbackTaskDefinition(ctx context.Context, rollbackedTdArn string
 
 func (d *App) RollbackServiceTasks(ctx context.Context, sv *Service, opt RollbackOption) (string, error) {
 	currentArn := *sv.TaskDefinition
-	targetArn, err := d.FindRollbackTarget(ctx, currentArn)
+	if sv.isNativeBlueGreen() && !opt.hasTarget() {
+		// stop the blue/green (linear, canary) deployment in progress. ECS rolls back it to the source revision.
+		if stopped, err := d.stopInFlightServiceDeployment(ctx, opt); err != nil {
+			return "", err
+		} else if stopped {
+			return currentArn, nil
+		}
+	}
+	targetArn, err := d.rollbackTarget(ctx, sv, currentArn, opt)
 	if err != nil {
 		return "", err
 	}
 
+	if err := d.rollbackServiceTasksTo(ctx, sv, targetArn, opt); err != nil {
+		return "", err
+	}
+	return currentArn, nil
+}
+
+func (d *App) rollbackServiceTasksTo(ctx context.Context, sv *Service, targetArn string, opt RollbackOption) error {
 	d.Log("Rolling back to %s %s", arnToName(targetArn), opt.DryRunString())
 	if opt.DryRun {
-		return currentArn, nil
+		return nil
 	}
-
-	if err := d.UpdateServiceTasks(
+	return d.UpdateServiceTasks(
 		ctx,
 		targetArn,
 		nil,
@@ -132,10 +193,76 @@ func (d *App) RollbackServiceTasks(ctx context.Context, sv *Service, opt Rollbac
 			ForceNewDeployment: false,
 			UpdateService:      false,
 		},
-	); err != nil {
-		return "", err
+	)
+}
+
+// rollbackDeployment rolls back the service deployed with failedTdArn to prevTdArn after the deployment failed.
+// When opt.DeregisterTaskDefinition is true, failedTdArn is deregistered after the service becomes stable.
+func (d *App) rollbackDeployment(ctx context.Context, failedTdArn, prevTdArn string, opt RollbackOption) error {
+	sv, err := d.DescribeService(ctx)
+	if err != nil {
+		return err
 	}
-	return currentArn, nil
+	d.Log("Rolling back the deployment of %s %s", arnToName(failedTdArn), opt.DryRunString())
+	if sv.isCodeDeploy() {
+		sv.TaskDefinition = aws.String(failedTdArn)
+		if _, err := d.RollbackByCodeDeploy(ctx, sv, opt); err != nil {
+			return err
+		}
+	} else if sv.isExternal() {
+		if err := d.rollbackTaskSetTo(ctx, sv, prevTdArn, opt); err != nil {
+			return err
+		}
+	} else {
+		var stopped bool
+		if sv.isNativeBlueGreen() {
+			if stopped, err = d.stopInFlightServiceDeployment(ctx, opt); err != nil {
+				return err
+			}
+		}
+		if !stopped {
+			if err := d.rollbackServiceTasksTo(ctx, sv, prevTdArn, opt); err != nil {
+				return err
+			}
+		}
+	}
+	if opt.DryRun || !opt.Wait {
+		return d.rollbackTaskDefinition(ctx, failedTdArn, opt)
+	}
+
+	doWait, err := d.rollbackWaitFunc(sv)
+	if err != nil {
+		return err
+	}
+	if err := doWait(ctx, sv); err != nil {
+		if !errors.As(err, &errNotFound) {
+			return err
+		}
+		d.Log("[INFO] %s", err)
+	}
+	d.Log("Service is rolled back to %s", arnToName(prevTdArn))
+	return d.rollbackTaskDefinition(ctx, failedTdArn, opt)
+}
+
+// rollbackFailedDeployment rolls back the failed deployment and returns ErrRolledBack which reports the cause.
+// When the deployment is interrupted by the user, it does not roll back.
+func (d *App) rollbackFailedDeployment(ctx context.Context, cause error, failedTdArn, prevTdArn string, opt RollbackOption) error {
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return cause
+	}
+	if failedTdArn == prevTdArn {
+		d.Log("[WARNING] the task definition was not changed by the deployment. no need to roll back")
+		return cause
+	}
+	d.Log("[WARNING] %s", cause)
+
+	// the context may be expired by the timeout of the deployment
+	rctx, cancel := d.Start(context.Background())
+	defer cancel()
+	if err := d.rollbackDeployment(rctx, failedTdArn, prevTdArn, opt); err != nil {
+		return fmt.Errorf("%w: failed to roll back: %s", cause, err)
+	}
+	return ErrRolledBack(fmt.Sprintf("%s: the service was rolled back to %s", cause, arnToName(prevTdArn)))
 }
 
 func (d *App) RollbackByCodeDeploy(ctx context.Context, sv *Service, opt RollbackOption) (string, error) {
@@ -168,7 +295,7 @@ func (d *App) RollbackByCodeDeploy(ctx context.Context, sv *Service, opt Rollbac
 	switch currentDeployment.Status {
 	case cdTypes.DeploymentStatusSucceeded, cdTypes.DeploymentStatusFailed, cdTypes.DeploymentStatusStopped:
 		currentTdArn := *sv.TaskDefinition
-		targetArn, err := d.FindRollbackTarget(ctx, currentTdArn)
+		targetArn, err := d.rollbackTarget(ctx, sv, currentTdArn, opt)
 		if err != nil {
 			return "", err
 		}
@@ -202,6 +329,86 @@ func (d *App) RollbackByCodeDeploy(ctx context.Context, sv *Service, opt Rollbac
 	}
 }
 
+func (opt RollbackOption) hasTarget() bool {
+	return opt.ToDeployment != "" || opt.Revision > 0
+}
+
+// selectsTarget reports whether the rollback target is chosen interactively.
+// The picker opens by --select, or by default when stdin is a terminal unless --no-select.
+func (opt RollbackOption) selectsTarget() bool {
+	if opt.Select {
+		return true
+	}
+	return !opt.NoSelect && !opt.hasTarget() && isStdinTerminal()
+}
+
+// rollbackTarget returns the task definition ARN to roll back to.
+// By default, it is the task definition of the last successful ECS service deployment except the current one.
+// When the service deployments are not available (CodeDeploy, EXTERNAL or no history), it is the previous revision of the current task definition.
+func (d *App) rollbackTarget(ctx context.Context, sv *Service, currentArn string, opt RollbackOption) (string, error) {
+	if opt.Revision > 0 {
+		family := strings.Split(arnToName(currentArn), ":")[0]
+		name := fmt.Sprintf("%s:%d", family, opt.Revision)
+		out, err := d.ecs.DescribeTaskDefinition(ctx, &ecs.DescribeTaskDefinitionInput{
+			TaskDefinition: aws.String(name),
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to describe task definition %s: %w", name, err)
+		}
+		return aws.ToString(out.TaskDefinition.TaskDefinitionArn), nil
+	}
+	useHistory := !sv.isCodeDeploy() && !sv.isExternal()
+	if opt.Select && !useHistory {
+		return "", ErrConflictOptions("--select works with ECS deployment controller only")
+	}
+	if opt.ToDeployment != "" {
+		if !useHistory {
+			return "", ErrConflictOptions("--to-deployment works with ECS deployment controller only")
+		}
+		history, err := d.serviceDeploymentHistory(ctx)
+		if err != nil {
+			return "", err
+		}
+		for _, r := range history {
+			if r.ID == opt.ToDeployment || r.Arn == opt.ToDeployment {
+				d.Log("the task definition of the service deployment %s is %s", r.ID, arnToName(r.TaskDefinitionArn))
+				return r.TaskDefinitionArn, nil
+			}
+		}
+		return "", ErrNotFound(fmt.Sprintf("service deployment %s is not found", opt.ToDeployment))
+	}
+	if !useHistory {
+		return d.FindRollbackTarget(ctx, currentArn)
+	}
+
+	history, err := d.serviceDeploymentHistory(ctx, types.ServiceDeploymentStatusSuccessful)
+	if err != nil {
+		d.Log("[WARNING] %s", err)
+		return d.FindRollbackTarget(ctx, currentArn)
+	}
+	candidates := lo.Filter(history, func(r serviceDeploymentRecord, _ int) bool {
+		return r.TaskDefinitionArn != currentArn
+	})
+	if len(candidates) == 0 {
+		d.Log("[INFO] no successful service deployments to roll back are found. finding the previous revision of %s", arnToName(currentArn))
+		return d.FindRollbackTarget(ctx, currentArn)
+	}
+	target := candidates[0]
+	if opt.selectsTarget() {
+		if !isStdinTerminal() {
+			return "", fmt.Errorf("--select requires a terminal to choose the service deployment")
+		}
+		items := lo.Map(candidates, func(r serviceDeploymentRecord, _ int) string { return r.String() })
+		i, err := d.pickItem(ctx, "Choose the service deployment to roll back to", items, 0)
+		if err != nil {
+			return "", err
+		}
+		target = candidates[i]
+	}
+	d.Log("rollback target is the service deployment %s (%s)", target.ID, arnToName(target.TaskDefinitionArn))
+	return target.TaskDefinitionArn, nil
+}
+
 func (d *App) FindRollbackTarget(ctx context.Context, taskDefinitionArn string) (string, error) {
 	var found bool
 	var nextToken *string
@@ -237,6 +444,19 @@ func (d *App) FindRollbackTarget(ctx context.Context, taskDefinitionArn string)
 	return "", ErrNotFound("rollback target is not found")
 }
 
+// rollbackWaitFunc returns a waitFunc for rollbacks.
+// It does not watch alarms because they may be still in ALARM state caused by the failed deployment.
+func (d *App) rollbackWaitFunc(sv *Service) (waitFunc, error) {
+	doWait, err := d.WaitFunc(sv)
+	if err != nil {
+		return nil, err
+	}
+	if sv.isCodeDeploy() || sv.isExternal() {
+		return doWait, nil
+	}
+	return d.waitServiceStableWithoutAlarms, nil
+}
+
 type rollbackFunc func(ctx context.Context, sv *Service, opt RollbackOption) (string, error)
 
 func (d *App) RollbackFunc(sv *Service) (rollbackFunc, error) {
@@ -248,6 +468,8 @@ func (d *App) RollbackFunc(sv *Service) (rollbackFunc, error) {
 		switch dc.Type {
 		case types.DeploymentControllerTypeCodeDeploy:
 			return d.RollbackByCodeDeploy, nil
+		case types.DeploymentControllerTypeExternal:
+			return d.RollbackByTaskSet, nil
 		case types.DeploymentControllerTypeEcs:
 			return d.RollbackServiceTasks, nil
 		default:
@@ -10,6 +10,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ecs"
 	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type RunOption struct {
@@ -19,7 +20,7 @@ type RunOption struct {
 	TaskOverrideStr        string  `name:"overrides" help:"task override JSON string" default:""`
 	TaskOverrideFile       string  `name:"overrides-file" help:"task override JSON file path" default:""`
 	SkipTaskDefinition     bool    `help:"skip register a new task definition" default:"false"`
-	Count                  int32   `help:"number of tasks to run (max 10)" default:"1"`
+	Count                  int32   `help:"number of tasks to run" default:"1"`
 	WatchContainer         string  `help:"container name for watching exit code" default:""`
 	LatestTaskDefinition   bool    `help:"use the latest task definition without registering a new task definition" default:"false"`
 	PropagateTags          string  `help:"propagate the tags for the task (SERVICE or TASK_DEFINITION)" default:""`
@@ -28,6 +29,10 @@ type RunOption struct {
 	Revision               *int64  `help:"revision of the task definition to run when --skip-task-definition" default:"0"`
 	ClientToken            *string `help:"unique token that identifies a request, useful for idempotency"`
 	EBSDeleteOnTermination *bool   `help:"whether to delete the EBS volume when the task is stopped" default:"true" negatable:""`
+	MaxConcurrency         int32   `help:"maximum number of tasks running at the same time with --count (0: unlimited)" default:"0"`
+	Exec                   bool    `help:"run the task and start an interactive session in the watch container. the task is stopped when the session ends" default:"false"`
+	ExecCommand            string  `help:"command to execute in the session with --exec" default:"sh"`
+	Logs                   string  `help:"containers to stream logs while waiting (watch: the watch container, all: all containers)" default:"watch" enum:"watch,all"`
 }
 
 func (opt RunOption) waitUntilRunning() bool {
@@ -41,7 +46,14 @@ func (opt RunOption) DryRunString() string {
 	return ""
 }
 
-func (d *App) Run(ctx context.Context, opt RunOption) error {
+func (d *App) Run(ctx context.Context, opt RunOption) (err error) {
+	if err := opt.validateExec(); err != nil {
+		return err
+	}
+	if err := opt.validateCount(); err != nil {
+		return err
+	}
+	sessionCtx := ctx // the session of --exec is not limited by the timeout
 	ctx, cancel := d.Start(ctx)
 	defer cancel()
 
@@ -72,6 +84,11 @@ func (d *App) Run(ctx context.Context, opt RunOption) error {
 		d.Log("DRY RUN OK")
 		return nil
 	}
+	ctx = d.withNotification(ctx, "run")
+	setNotificationTaskDefinition(ctx, tdArn)
+	d.notify(ctx, NotificationEventStarted, nil)
+	defer func() { d.notifyResult(ctx, err) }()
+
 	td, err := d.DescribeTaskDefinition(ctx, tdArn)
 	if err != nil {
 		return err
@@ -79,6 +96,13 @@ func (d *App) Run(ctx context.Context, opt RunOption) error {
 	watchContainer := containerOf(td, &opt.WatchContainer)
 	d.Log("Watch container: %s", *watchContainer.Name)
 
+	if opt.Count > 1 {
+		return d.runTasks(ctx, tdArn, &ov, opt, watchContainer)
+	}
+	if opt.Exec {
+		return d.runExec(ctx, sessionCtx, tdArn, &ov, opt, watchContainer)
+	}
+
 	task, err := d.RunTask(ctx, tdArn, &ov, &opt)
 	if err != nil {
 		return err
@@ -87,7 +111,12 @@ func (d *App) Run(ctx context.Context, opt RunOption) error {
 		d.Log("Run task invoked")
 		return nil
 	}
-	if err := d.WaitRunTask(ctx, task, watchContainer, time.Now(), opt.waitUntilRunning()); err != nil {
+	if opt.Logs == "all" {
+		err = d.waitRunTaskWithAllLogs(ctx, task, td, time.Now(), opt.waitUntilRunning())
+	} else {
+		err = d.WaitRunTask(ctx, task, watchContainer, time.Now(), opt.waitUntilRunning())
+	}
+	if err != nil {
 		return err
 	}
 	if err := d.DescribeTaskStatus(ctx, task, watchContainer); err != nil {
@@ -100,7 +129,18 @@ func (d *App) Run(ctx context.Context, opt RunOption) error {
 
 func (d *App) RunTask(ctx context.Context, tdArn string, ov *types.TaskOverride, opt *RunOption) (*types.Task, error) {
 	d.Log("Running task with %s", tdArn)
+	in, err := d.runTaskInput(ctx, tdArn, ov, opt)
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := d.runTaskWithRetry(ctx, in, opt.Count)
+	if err != nil {
+		return nil, err
+	}
+	return &tasks[0], nil
+}
 
+func (d *App) runTaskInput(ctx context.Context, tdArn string, ov *types.TaskOverride, opt *RunOption) (*ecs.RunTaskInput, error) {
 	sv, err := d.LoadServiceDefinition(d.config.ServiceDefinitionPath)
 	if err != nil {
 		return nil, err
@@ -117,7 +157,7 @@ func (d *App) RunTask(ctx context.Context, tdArn string, ov *types.TaskOverride,
 		NetworkConfiguration:     sv.NetworkConfiguration,
 		LaunchType:               sv.LaunchType,
 		Overrides:                ov,
-		Count:                    &opt.Count,
+		Count:                    aws.Int32(opt.Count),
 		CapacityProviderStrategy: sv.CapacityProviderStrategy,
 		PlacementConstraints:     sv.PlacementConstraints,
 		PlacementStrategy:        sv.PlacementStrategy,
@@ -150,27 +190,67 @@ func (d *App) RunTask(ctx context.Context, tdArn string, ov *types.TaskOverride,
 	default:
 		in.PropagateTags = types.PropagateTagsTaskDefinition
 	}
+	if opt.Exec {
+		in.EnableExecuteCommand = true
+	}
 	d.Log("[DEBUG] run task input")
 	d.LogJSON(in)
+	return in, nil
+}
 
-	out, err := d.ecs.RunTask(ctx, in)
-	if err != nil {
-		return nil, fmt.Errorf("failed to run task: %w", err)
-	}
-	if len(out.Failures) > 0 {
+// runTaskWithRetry runs count tasks (up to 10) by the input.
+// The launches failed by the lack of capacity are retried with backoff, except when the client token is set.
+// It returns the tasks launched even if failed.
+func (d *App) runTaskWithRetry(ctx context.Context, in *ecs.RunTaskInput, count int32) ([]types.Task, error) {
+	var tasks []types.Task
+	interval := runTaskRetryInterval
+	for i := 0; ; i++ {
+		in.Count = aws.Int32(count - int32(len(tasks)))
+		out, err := d.ecs.RunTask(ctx, in)
+		if err != nil {
+			return tasks, fmt.Errorf("failed to run task: %w", err)
+		}
+		for _, task := range out.Tasks {
+			d.Log("Task ARN: %s", aws.ToString(task.TaskArn))
+			d.emitEvent(&OutputEvent{
+				Type:           OutputEventTypePhase,
+				Phase:          "run_task",
+				Status:         phaseStatusCompleted,
+				TaskArn:        aws.ToString(task.TaskArn),
+				TaskDefinition: aws.ToString(in.TaskDefinition),
+			})
+		}
+		tasks = append(tasks, out.Tasks...)
+		if len(out.Failures) == 0 {
+			if len(tasks) == 0 {
+				return nil, fmt.Errorf("failed to run task: no tasks run")
+			}
+			return tasks, nil
+		}
 		f := out.Failures[0]
 		if f.Arn != nil {
 			d.Log("Task ARN: %s", *f.Arn)
 		}
-		return nil, fmt.Errorf("failed to run task: %s %s", aws.ToString(f.Reason), aws.ToString(f.Detail))
+		reason := strings.TrimSpace(aws.ToString(f.Reason) + " " + aws.ToString(f.Detail))
+		if in.ClientToken != nil || !isRetryableRunTaskFailure(f) || i >= runTaskMaxRetries {
+			return tasks, fmt.Errorf("failed to run task: %s", reason)
+		}
+		d.Log("[WARNING] failed to run %d tasks: %s. retrying in %s", len(out.Failures), reason, interval)
+		select {
+		case <-ctx.Done():
+			return tasks, fmt.Errorf("failed to run task: %w", ctx.Err())
+		case <-time.After(interval):
+		}
+		interval *= 2
 	}
+}
 
-	if len(out.Tasks) == 0 {
-		return nil, fmt.Errorf("failed to run task: no tasks run")
-	}
-	task := out.Tasks[0]
-	d.Log("Task ARN: %s", aws.ToString(task.TaskArn))
-	return &task, nil
+// isRetryableRunTaskFailure reports whether the failure of RunTask is caused by the lack of capacity.
+func isRetryableRunTaskFailure(f types.Failure) bool {
+	reason := aws.ToString(f.Reason)
+	return strings.HasPrefix(reason, "RESOURCE:") ||
+		reason == "AGENT" ||
+		strings.Contains(reason, "Capacity is unavailable")
 }
 
 func (d *App) WaitRunTask(ctx context.Context, task *types.Task, watchContainer *types.ContainerDefinition, startedAt time.Time, untilRunning bool) error {
@@ -178,17 +258,15 @@ func (d *App) WaitRunTask(ctx context.Context, task *types.Task, watchContainer
 	waitCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	lc := watchContainer.LogConfiguration
-	if lc == nil || lc.LogDriver != types.LogDriverAwslogs || lc.Options["awslogs-stream-prefix"] == "" {
-		d.Log("awslogs not configured")
-		if err := d.waitTask(ctx, task, untilRunning); err != nil {
-			return err
-		}
-		return nil
+	lt, err := containerLogTarget(task, watchContainer)
+	if err != nil {
+		d.Log("[WARNING] %s", err)
+		return d.waitTask(ctx, task, untilRunning)
 	}
 
 	d.Log("Watching container: %s", *watchContainer.Name)
-	logGroup, logStream := d.GetLogInfo(task, watchContainer)
+	d.Log("[DEBUG] log group: %s, log stream: %s", lt.Group, lt.Stream)
+	logGroup, logStream := lt.Group, lt.Stream
 	time.Sleep(3 * time.Second) // wait for log stream
 
 	go func() {
@@ -210,12 +288,78 @@ func (d *App) WaitRunTask(ctx context.Context, task *types.Task, watchContainer
 	return nil
 }
 
-func (d *App) waitTask(ctx context.Context, task *types.Task, untilRunning bool) error {
+// waitRunTaskWithAllLogs waits for the task, streaming the logs of all containers interleaved with the prefixes.
+func (d *App) waitRunTaskWithAllLogs(ctx context.Context, task *types.Task, td *TaskDefinitionInput, startedAt time.Time, untilRunning bool) error {
+	d.Log("Waiting for run task...(it may take a while)")
+	var targets []logTarget
+	for _, c := range td.ContainerDefinitions {
+		t, err := containerLogTarget(task, &c)
+		if err != nil {
+			d.Log("[WARNING] %s", err)
+			continue
+		}
+		d.Log("Watching container: %s", t.Container)
+		targets = append(targets, t)
+	}
+	if len(targets) == 0 {
+		return d.waitTask(ctx, task, untilRunning)
+	}
+
+	cursors := map[string]*logGroupCursor{}
+	for _, t := range targets {
+		cursors[t.Group] = newLogGroupCursor(startedAt.UnixMilli())
+	}
+	waitCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-waitCtx.Done():
+				return
+			case <-time.After(logsPollInterval):
+				if err := d.showLogEvents(waitCtx, targets, cursors, ""); err != nil {
+					d.Log("[WARNING] %s", err)
+				}
+			}
+		}
+	}()
+
+	err := d.waitTask(ctx, task, untilRunning)
+	cancel()
+	<-done
+	// show the rest of the logs written until the task stopped
+	if err := d.showLogEvents(ctx, targets, cursors, ""); err != nil {
+		d.Log("[WARNING] %s", err)
+	}
+	return err
+}
+
+func (d *App) waitTask(ctx context.Context, task *types.Task, untilRunning bool) (err error) {
 	id := arnToName(*task.TaskArn)
+	ctx, span := startSpan(ctx, "wait for task",
+		attribute.String("ecspresso.task_id", id),
+		attribute.Bool("ecspresso.until_running", untilRunning),
+	)
+	defer func() { endSpan(span, err) }()
+	tracker := newTaskStateTracker()
+	emitTaskStates := func(out *ecs.DescribeTasksOutput) {
+		if out == nil {
+			return
+		}
+		for _, ev := range tracker.changes(out.Tasks) {
+			d.emitEvent(ev)
+		}
+	}
 	if untilRunning {
 		d.Log("Waiting for task ID %s until running", id)
 		waiter := ecs.NewTasksRunningWaiter(d.ecs, func(o *ecs.TasksRunningWaiterOptions) {
 			o.MaxDelay = waiterMaxDelay
+			retryable := o.Retryable
+			o.Retryable = func(ctx context.Context, in *ecs.DescribeTasksInput, out *ecs.DescribeTasksOutput, err error) (bool, error) {
+				emitTaskStates(out)
+				return retryable(ctx, in, out, err)
+			}
 		})
 		if err := waiter.Wait(ctx, d.DescribeTasksInput(task), d.Timeout()); err != nil {
 			return err
@@ -227,6 +371,11 @@ func (d *App) waitTask(ctx context.Context, task *types.Task, untilRunning bool)
 	d.Log("Waiting for task ID %s until stopped", id)
 	waiter := ecs.NewTasksStoppedWaiter(d.ecs, func(o *ecs.TasksStoppedWaiterOptions) {
 		o.MaxDelay = waiterMaxDelay
+		retryable := o.Retryable
+		o.Retryable = func(ctx context.Context, in *ecs.DescribeTasksInput, out *ecs.DescribeTasksOutput, err error) (bool, error) {
+			emitTaskStates(out)
+			return retryable(ctx, in, out, err)
+		}
 	})
 	if err := waiter.Wait(ctx, d.DescribeTasksInput(task), d.Timeout()); err != nil {
 		return fmt.Errorf("failed to wait task: %w", err)
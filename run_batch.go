@@ -0,0 +1,205 @@
+package ecspresso
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+const (
+	runTaskMaxCount   = 10 // RunTask API accepts up to 10 tasks at once
+	runTaskMaxRetries = 5
+)
+
+var (
+	runTaskRetryInterval = 2 * time.Second // doubled on each retry
+	runTasksPollInterval = 10 * time.Second
+)
+
+// runTaskResult is the result of a task run by runTasks.
+type runTaskResult struct {
+	TaskID    string
+	StartedAt *time.Time
+	StoppedAt *time.Time
+	Err       error
+}
+
+func (r runTaskResult) duration() string {
+	if r.StartedAt == nil || r.StoppedAt == nil {
+		return "-"
+	}
+	return r.StoppedAt.Sub(*r.StartedAt).Round(time.Second).String()
+}
+
+func (opt RunOption) validateCount() error {
+	if opt.Count <= 1 {
+		return nil
+	}
+	if opt.Logs == "all" {
+		return ErrConflictOptions("--logs all works with --count 1 only")
+	}
+	return nil
+}
+
+// runTasks runs opt.Count tasks by batches of RunTask API, and waits for all tasks.
+// With opt.MaxConcurrency, new tasks are launched after the running tasks stopped.
+func (d *App) runTasks(ctx context.Context, tdArn string, ov *types.TaskOverride, opt RunOption, watchContainer *types.ContainerDefinition) error {
+	if opt.ClientToken != nil && opt.Count > runTaskMaxCount {
+		return ErrConflictOptions(fmt.Sprintf("--client-token can't be used with --count over %d", runTaskMaxCount))
+	}
+	if opt.MaxConcurrency > 0 && (!opt.Wait || opt.waitUntilRunning()) {
+		return ErrConflictOptions("--max-concurrency works with waiting until the tasks stopped")
+	}
+	d.Log("Running %d tasks with %s", opt.Count, tdArn)
+	in, err := d.runTaskInput(ctx, tdArn, ov, &opt)
+	if err != nil {
+		return err
+	}
+
+	var launched, failedLaunches int32
+	running := []string{} // task ARNs
+	var results []runTaskResult
+	launch := func() error {
+		for launched+failedLaunches < opt.Count {
+			n := opt.Count - launched - failedLaunches
+			if n > runTaskMaxCount {
+				n = runTaskMaxCount
+			}
+			if opt.MaxConcurrency > 0 && n > opt.MaxConcurrency-int32(len(running)) {
+				n = opt.MaxConcurrency - int32(len(running))
+			}
+			if n <= 0 {
+				return nil
+			}
+			tasks, err := d.runTaskWithRetry(ctx, in, n)
+			for _, task := range tasks {
+				running = append(running, aws.ToString(task.TaskArn))
+			}
+			launched += int32(len(tasks))
+			if err != nil {
+				// give up launching the rest of the tasks
+				failedLaunches = opt.Count - launched
+				return err
+			}
+		}
+		return nil
+	}
+
+	launchErr := launch()
+	if launchErr != nil {
+		if len(running) == 0 {
+			return launchErr
+		}
+		d.Log("[ERROR] %s", launchErr)
+	}
+	if !opt.Wait {
+		d.Log("%d tasks invoked", launched)
+		return launchErr
+	}
+
+	d.Log("Waiting for %d tasks...(it may take a while)", launched)
+	tracker := newTaskStateTracker()
+	for len(running) > 0 {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to wait tasks: %w", ctx.Err())
+		case <-time.After(runTasksPollInterval):
+		}
+		tasks, err := d.describeTasks(ctx, running)
+		if err != nil {
+			return err
+		}
+		for _, ev := range tracker.changes(tasks) {
+			d.emitEvent(ev)
+		}
+		var next []string
+		described := make(map[string]bool, len(tasks))
+		for _, task := range tasks {
+			described[aws.ToString(task.TaskArn)] = true
+			id := arnToName(aws.ToString(task.TaskArn))
+			switch {
+			case aws.ToString(task.LastStatus) == "STOPPED":
+				r := runTaskResult{
+					TaskID:    id,
+					StartedAt: task.StartedAt,
+					StoppedAt: task.StoppedAt,
+					Err:       taskExitError(task, watchContainer),
+				}
+				d.Log("Task ID %s is stopped: %s", id, resultString(r.Err))
+				results = append(results, r)
+			case opt.waitUntilRunning() && aws.ToString(task.LastStatus) == "RUNNING":
+				d.Log("Task ID %s is running", id)
+				results = append(results, runTaskResult{TaskID: id, StartedAt: task.StartedAt})
+			default:
+				next = append(next, aws.ToString(task.TaskArn))
+			}
+		}
+		// tasks not found by DescribeTasks can't be waited any more, so they are counted as failures.
+		for _, arn := range running {
+			if described[arn] {
+				continue
+			}
+			d.Log("[WARNING] Task %s is missing in the response of DescribeTasks", arn)
+			results = append(results, runTaskResult{
+				TaskID: arnToName(arn),
+				Err:    errors.New("the task is missing in the response of DescribeTasks"),
+			})
+		}
+		running = next
+		if launchErr == nil {
+			if launchErr = launch(); launchErr != nil {
+				d.Log("[ERROR] %s", launchErr)
+			}
+		}
+	}
+	return d.summarizeRunTasks(results, failedLaunches)
+}
+
+// describeTasks describes the tasks by 100 tasks, the maximum number of DescribeTasks API.
+func (d *App) describeTasks(ctx context.Context, arns []string) ([]types.Task, error) {
+	var tasks []types.Task
+	for i := 0; i < len(arns); i += 100 {
+		end := i + 100
+		if end > len(arns) {
+			end = len(arns)
+		}
+		out, err := d.ecs.DescribeTasks(ctx, &ecs.DescribeTasksInput{
+			Cluster: aws.String(d.Cluster),
+			Tasks:   arns[i:end],
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe tasks: %w", err)
+		}
+		tasks = append(tasks, out.Tasks...)
+	}
+	return tasks, nil
+}
+
+// summarizeRunTasks shows the exit status and the duration of the tasks, and returns an error if any task failed.
+func (d *App) summarizeRunTasks(results []runTaskResult, failedLaunches int32) error {
+	var failed int
+	d.Log("Results of the tasks:")
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+		}
+		d.Log("  %s %s %s", r.TaskID, r.duration(), resultString(r.Err))
+	}
+	d.Log("%d tasks succeeded, %d tasks failed, %d tasks failed to launch", len(results)-failed, failed, failedLaunches)
+	if failed > 0 || failedLaunches > 0 {
+		return fmt.Errorf("%d of %d tasks failed", int32(failed)+failedLaunches, int32(len(results))+failedLaunches)
+	}
+	return nil
+}
+
+func resultString(err error) string {
+	if err != nil {
+		return "failed: " + err.Error()
+	}
+	return "succeeded"
+}
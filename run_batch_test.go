@@ -0,0 +1,185 @@
+package ecspresso_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/google/go-cmp/cmp"
+	"github.com/kayac/ecspresso/v2"
+)
+
+// runTasksStub launches the tasks requested by RunTask, failing the first launch of the second call by the lack of capacity.
+// The tasks are stopped when described, and the container app of the tasks in failed exits with 1.
+// The tasks in missing are not found by DescribeTasks.
+type runTasksStub struct {
+	counts     []int32 // requested counts of RunTask
+	maxRunning int
+	running    map[string]bool
+	failed     map[string]bool
+	missing    map[string]bool
+}
+
+func (s *runTasksStub) middleware(stack *middleware.Stack) error {
+	return stack.Initialize.Add(
+		middleware.InitializeMiddlewareFunc(
+			"test",
+			func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+				var out any
+				switch params := in.Parameters.(type) {
+				case *ecs.RunTaskInput:
+					count := aws.ToInt32(params.Count)
+					s.counts = append(s.counts, count)
+					res := &ecs.RunTaskOutput{}
+					if len(s.counts) == 2 {
+						res.Failures = append(res.Failures, types.Failure{Reason: aws.String("RESOURCE:MEMORY")})
+						count--
+					}
+					for i := int32(0); i < count; i++ {
+						arn := fmt.Sprintf("%st%02d", logsTaskArnPrefix, len(s.running)+1)
+						s.running[arn] = true
+						res.Tasks = append(res.Tasks, types.Task{TaskArn: aws.String(arn)})
+					}
+					if n := s.runningCount(); n > s.maxRunning {
+						s.maxRunning = n
+					}
+					out = res
+				case *ecs.DescribeTasksInput:
+					res := &ecs.DescribeTasksOutput{}
+					started := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+					for _, arn := range params.Tasks {
+						s.running[arn] = false
+						if s.missing[arn] {
+							res.Failures = append(res.Failures, types.Failure{Arn: aws.String(arn), Reason: aws.String("MISSING")})
+							continue
+						}
+						exitCode := int32(0)
+						if s.failed[arn] {
+							exitCode = 1
+						}
+						res.Tasks = append(res.Tasks, types.Task{
+							TaskArn:    aws.String(arn),
+							LastStatus: aws.String("STOPPED"),
+							StartedAt:  aws.Time(started),
+							StoppedAt:  aws.Time(started.Add(time.Minute)),
+							Containers: []types.Container{
+								{Name: aws.String("app"), ExitCode: aws.Int32(exitCode)},
+							},
+						})
+					}
+					out = res
+				default:
+					return next.HandleInitialize(ctx, in)
+				}
+				return middleware.InitializeOutput{Result: out}, middleware.Metadata{}, nil
+			},
+		),
+		middleware.Before,
+	)
+}
+
+func (s *runTasksStub) runningCount() int {
+	var n int
+	for _, r := range s.running {
+		if r {
+			n++
+		}
+	}
+	return n
+}
+
+func TestRunTasks(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("AWS_REGION", "ap-northeast-1")
+	ecspresso.SetRunTasksIntervals(time.Millisecond, time.Millisecond)
+	defer ecspresso.SetRunTasksIntervals(10*time.Second, 2*time.Second)
+
+	tests := []struct {
+		name       string
+		opt        ecspresso.RunOption
+		failed     []string
+		missing    []string
+		counts     []int32
+		maxRunning int
+		err        string
+	}{
+		{
+			name:       "batches",
+			opt:        ecspresso.RunOption{Count: 12, Wait: true, WaitUntil: "stopped"},
+			counts:     []int32{10, 2, 1},
+			maxRunning: 12,
+		},
+		{
+			name:       "max concurrency",
+			opt:        ecspresso.RunOption{Count: 5, MaxConcurrency: 2, Wait: true, WaitUntil: "stopped"},
+			counts:     []int32{2, 2, 1, 1},
+			maxRunning: 2,
+		},
+		{
+			name:       "failed task",
+			opt:        ecspresso.RunOption{Count: 3, Wait: true, WaitUntil: "stopped"},
+			failed:     []string{"t02"},
+			counts:     []int32{3},
+			maxRunning: 3,
+			err:        "1 of 3 tasks failed",
+		},
+		{
+			name:       "missing task",
+			opt:        ecspresso.RunOption{Count: 3, Wait: true, WaitUntil: "stopped"},
+			missing:    []string{"t03"},
+			counts:     []int32{3},
+			maxRunning: 3,
+			err:        "1 of 3 tasks failed",
+		},
+		{
+			name: "client token",
+			opt:  ecspresso.RunOption{Count: 11, Wait: true, WaitUntil: "stopped", ClientToken: aws.String("token")},
+			err:  "--client-token can't be used with --count over 10",
+		},
+		{
+			name: "max concurrency without waiting",
+			opt:  ecspresso.RunOption{Count: 2, MaxConcurrency: 1, Wait: false},
+			err:  "--max-concurrency works with waiting until the tasks stopped",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := &runTasksStub{running: map[string]bool{}, failed: map[string]bool{}, missing: map[string]bool{}}
+			for _, id := range tt.failed {
+				stub.failed[logsTaskArnPrefix+id] = true
+			}
+			for _, id := range tt.missing {
+				stub.missing[logsTaskArnPrefix+id] = true
+			}
+			ecspresso.SetAWSV2ConfigLoadOptionsFunc([]func(*config.LoadOptions) error{
+				config.WithRegion("ap-northeast-1"),
+				config.WithAPIOptions([]func(*middleware.Stack) error{stub.middleware}),
+			})
+			defer ecspresso.ResetAWSV2ConfigLoadOptionsFunc()
+			app, err := ecspresso.New(ctx, &ecspresso.CLIOptions{ConfigFilePath: "tests/ecspresso.yml"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = app.RunTasks(ctx, "arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:1", tt.opt)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.counts, stub.counts); diff != "" {
+				t.Errorf("unexpected counts of RunTask: %s", diff)
+			}
+			if stub.maxRunning != tt.maxRunning {
+				t.Errorf("expected max running %d, got %d", tt.maxRunning, stub.maxRunning)
+			}
+		})
+	}
+}
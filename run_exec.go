@@ -0,0 +1,140 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/fujiwara/ecsta"
+)
+
+const runExecStopTimeout = time.Minute
+
+var (
+	// execKeepAliveCommand keeps the container running while the session is open.
+	execKeepAliveCommand  = []string{"sleep", "infinity"}
+	execAgentPollInterval = 5 * time.Second
+)
+
+func (opt RunOption) validateExec() error {
+	if !opt.Exec {
+		return nil
+	}
+	if opt.Count > 1 {
+		return ErrConflictOptions("--exec works with --count 1 only")
+	}
+	if !opt.Wait {
+		return ErrConflictOptions("--exec and --no-wait are exclusive")
+	}
+	return nil
+}
+
+// runExec runs the task keeping the watch container alive, and starts an interactive session in the container.
+// The task is stopped when the session ends. sessionCtx is not limited by the timeout.
+func (d *App) runExec(ctx, sessionCtx context.Context, tdArn string, ov *types.TaskOverride, opt RunOption, watchContainer *types.ContainerDefinition) error {
+	name := aws.ToString(watchContainer.Name)
+	if err := validateKeepAlive(watchContainer); err != nil {
+		return err
+	}
+	keepAliveOverride(ov, name)
+	task, err := d.RunTask(ctx, tdArn, ov, &opt)
+	if err != nil {
+		return err
+	}
+	defer d.stopExecTask(sessionCtx, task)
+
+	if err := d.waitTask(ctx, task, true); err != nil {
+		return err
+	}
+	if err := d.waitExecuteCommandAgent(ctx, task, name); err != nil {
+		return err
+	}
+
+	ecstaApp, err := d.NewEcsta(sessionCtx)
+	if err != nil {
+		return err
+	}
+	id := arnToName(aws.ToString(task.TaskArn))
+	d.Log("Starting session to the container %s of task ID %s", name, id)
+	return ecstaApp.RunExec(sessionCtx, &ecsta.ExecOption{
+		ID:        id,
+		Command:   opt.ExecCommand,
+		Container: name,
+	})
+}
+
+// validateKeepAlive returns an error when the container can't be kept alive by execKeepAliveCommand.
+// ECS can't override entryPoint of a container, so the command would be passed to the entryPoint as arguments.
+func validateKeepAlive(c *types.ContainerDefinition) error {
+	if len(c.EntryPoint) > 0 {
+		return fmt.Errorf("--exec can't keep the container %s running because entryPoint %q is defined in the task definition. entryPoint can't be overridden by RunTask", aws.ToString(c.Name), c.EntryPoint)
+	}
+	return nil
+}
+
+// keepAliveOverride overrides the command of the container by execKeepAliveCommand.
+// The ENTRYPOINT of the image receives the command as arguments.
+func keepAliveOverride(ov *types.TaskOverride, container string) {
+	for i, co := range ov.ContainerOverrides {
+		if aws.ToString(co.Name) == container {
+			ov.ContainerOverrides[i].Command = execKeepAliveCommand
+			return
+		}
+	}
+	ov.ContainerOverrides = append(ov.ContainerOverrides, types.ContainerOverride{
+		Name:    aws.String(container),
+		Command: execKeepAliveCommand,
+	})
+}
+
+// waitExecuteCommandAgent waits for ExecuteCommandAgent in the container to be RUNNING.
+func (d *App) waitExecuteCommandAgent(ctx context.Context, task *types.Task, container string) error {
+	d.Log("Waiting for %s of the container %s until running", types.ManagedAgentNameExecuteCommandAgent, container)
+	for {
+		out, err := d.ecs.DescribeTasks(ctx, d.DescribeTasksInput(task))
+		if err != nil {
+			return fmt.Errorf("failed to describe tasks: %w", err)
+		}
+		for _, t := range out.Tasks {
+			if aws.ToString(t.LastStatus) == "STOPPED" {
+				return fmt.Errorf("task is stopped: %s", aws.ToString(t.StoppedReason))
+			}
+			for _, c := range t.Containers {
+				if aws.ToString(c.Name) != container {
+					continue
+				}
+				for _, a := range c.ManagedAgents {
+					if a.Name == types.ManagedAgentNameExecuteCommandAgent && aws.ToString(a.LastStatus) == "RUNNING" {
+						d.Log("%s is running", types.ManagedAgentNameExecuteCommandAgent)
+						return nil
+					}
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to wait %s: %w", types.ManagedAgentNameExecuteCommandAgent, ctx.Err())
+		case <-time.After(execAgentPollInterval):
+		}
+	}
+}
+
+// stopExecTask stops the task even if the context is canceled (e.g. interrupted while waiting).
+func (d *App) stopExecTask(ctx context.Context, task *types.Task) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), runExecStopTimeout)
+	defer cancel()
+	id := arnToName(aws.ToString(task.TaskArn))
+	d.Log("Stopping task ID %s", id)
+	if _, err := d.ecs.StopTask(ctx, &ecs.StopTaskInput{
+		Cluster: aws.String(d.Cluster),
+		Task:    task.TaskArn,
+		Reason:  aws.String("session of ecspresso run --exec ended"),
+	}); err != nil {
+		d.Log("[WARNING] failed to stop task ID %s: %s", id, err)
+		return
+	}
+	d.Log("Task ID %s is stopping", id)
+}
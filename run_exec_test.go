@@ -0,0 +1,119 @@
+package ecspresso_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/google/go-cmp/cmp"
+	"github.com/kayac/ecspresso/v2"
+)
+
+func TestKeepAliveOverride(t *testing.T) {
+	ov := &types.TaskOverride{
+		ContainerOverrides: []types.ContainerOverride{
+			{Name: aws.String("app"), Command: []string{"rake", "db:migrate"}},
+		},
+	}
+	ecspresso.KeepAliveOverride(ov, "app")
+	ecspresso.KeepAliveOverride(ov, "sidecar")
+	if len(ov.ContainerOverrides) != 2 {
+		t.Fatalf("unexpected container overrides: %#v", ov.ContainerOverrides)
+	}
+	for _, co := range ov.ContainerOverrides {
+		if diff := cmp.Diff([]string{"sleep", "infinity"}, co.Command); diff != "" {
+			t.Errorf("unexpected command of %s: %s", aws.ToString(co.Name), diff)
+		}
+	}
+}
+
+func TestValidateKeepAlive(t *testing.T) {
+	if err := ecspresso.ValidateKeepAlive(&types.ContainerDefinition{Name: aws.String("app")}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	c := &types.ContainerDefinition{Name: aws.String("app"), EntryPoint: []string{"/docker-entrypoint.sh"}}
+	if err := ecspresso.ValidateKeepAlive(c); err == nil {
+		t.Error("container with entryPoint must not be kept alive")
+	}
+}
+
+func TestRunConflictOptions(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("AWS_REGION", "ap-northeast-1")
+	app, err := ecspresso.New(ctx, &ecspresso.CLIOptions{ConfigFilePath: "tests/ecspresso.yml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, opt := range []ecspresso.RunOption{
+		{Exec: true, Count: 2, Wait: true},
+		{Exec: true, Count: 1, Wait: false},
+		{Count: 2, Wait: true, Logs: "all"},
+	} {
+		var ec ecspresso.ErrConflictOptions
+		if err := app.Run(ctx, opt); !errors.As(err, &ec) {
+			t.Errorf("expected conflict options error, got %v", err)
+		}
+	}
+}
+
+func TestWaitExecuteCommandAgent(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("AWS_REGION", "ap-northeast-1")
+	ecspresso.SetExecAgentPollInterval(time.Millisecond)
+	defer ecspresso.SetExecAgentPollInterval(5 * time.Second)
+
+	var calls int
+	ecspresso.SetAWSV2ConfigLoadOptionsFunc([]func(*config.LoadOptions) error{
+		config.WithRegion("ap-northeast-1"),
+		config.WithAPIOptions([]func(*middleware.Stack) error{
+			func(stack *middleware.Stack) error {
+				return stack.Initialize.Add(
+					middleware.InitializeMiddlewareFunc(
+						"test",
+						func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+							if _, ok := in.Parameters.(*ecs.DescribeTasksInput); !ok {
+								return next.HandleInitialize(ctx, in)
+							}
+							calls++
+							status := "PENDING"
+							if calls >= 3 {
+								status = "RUNNING"
+							}
+							return middleware.InitializeOutput{Result: &ecs.DescribeTasksOutput{
+								Tasks: []types.Task{{
+									TaskArn:    aws.String(logsTaskArnPrefix + "aaa"),
+									LastStatus: aws.String("RUNNING"),
+									Containers: []types.Container{{
+										Name: aws.String("app"),
+										ManagedAgents: []types.ManagedAgent{
+											{Name: types.ManagedAgentNameExecuteCommandAgent, LastStatus: aws.String(status)},
+										},
+									}},
+								}},
+							}}, middleware.Metadata{}, nil
+						},
+					),
+					middleware.Before,
+				)
+			},
+		}),
+	})
+	defer ecspresso.ResetAWSV2ConfigLoadOptionsFunc()
+	app, err := ecspresso.New(ctx, &ecspresso.CLIOptions{ConfigFilePath: "tests/ecspresso.yml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	task := &types.Task{TaskArn: aws.String(logsTaskArnPrefix + "aaa")}
+	if err := app.WaitExecuteCommandAgent(ctx, task, "app"); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 calls of DescribeTasks, got %d", calls)
+	}
+}
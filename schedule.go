@@ -0,0 +1,435 @@
+package ecspresso
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/scheduler"
+	schedulerTypes "github.com/aws/aws-sdk-go-v2/service/scheduler/types"
+	"github.com/hexops/gotextdiff"
+	"github.com/hexops/gotextdiff/myers"
+	"github.com/hexops/gotextdiff/span"
+	"github.com/kylelemons/godebug/diff"
+)
+
+const defaultScheduleGroupName = "default"
+
+// ScheduleDefinition is an EventBridge Scheduler schedule running the task definition.
+// The keys are the same as CreateSchedule API.
+type ScheduleDefinition = scheduler.CreateScheduleInput
+
+// ConfigSchedule represents a schedule definition file.
+type ConfigSchedule struct {
+	Path string `yaml:"path" json:"path"`
+}
+
+func (s *ConfigSchedule) validate(i int) error {
+	if s.Path == "" {
+		return fmt.Errorf("schedules[%d].path is required", i)
+	}
+	return nil
+}
+
+// LoadScheduleDefinition loads the schedule definition file, filling the defaults of the API.
+func (d *App) LoadScheduleDefinition(path string) (*ScheduleDefinition, error) {
+	var sd ScheduleDefinition
+	src, err := d.readDefinitionFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load schedule definition %s: %w", path, err)
+	}
+	if err := unmarshalJSON(src, &sd, path); err != nil {
+		return nil, fmt.Errorf("failed to load schedule definition %s: %w", path, err)
+	}
+	if aws.ToString(sd.Name) == "" {
+		return nil, fmt.Errorf("name is required in schedule definition %s", path)
+	}
+	if aws.ToString(sd.ScheduleExpression) == "" {
+		return nil, fmt.Errorf("scheduleExpression is required in schedule definition %s", path)
+	}
+	if sd.Target == nil || aws.ToString(sd.Target.RoleArn) == "" {
+		return nil, fmt.Errorf("target.roleArn is required in schedule definition %s", path)
+	}
+	if sd.GroupName == nil {
+		sd.GroupName = aws.String(defaultScheduleGroupName)
+	}
+	if sd.FlexibleTimeWindow == nil {
+		sd.FlexibleTimeWindow = &schedulerTypes.FlexibleTimeWindow{Mode: schedulerTypes.FlexibleTimeWindowModeOff}
+	}
+	if sd.State == "" {
+		sd.State = schedulerTypes.ScheduleStateEnabled
+	}
+	if sd.ActionAfterCompletion == "" {
+		sd.ActionAfterCompletion = schedulerTypes.ActionAfterCompletionNone
+	}
+	if sd.Target.EcsParameters == nil {
+		sd.Target.EcsParameters = &schedulerTypes.EcsParameters{}
+	}
+	if sd.Target.EcsParameters.TaskCount == nil {
+		sd.Target.EcsParameters.TaskCount = aws.Int32(1)
+	}
+	return &sd, nil
+}
+
+// completeScheduleTarget sets the cluster and the task definition to the target of the schedule.
+// The network configuration, the launch type (or the capacity provider strategy), the platform version and the placement
+// are taken from the service definition when they are not defined in the schedule.
+func completeScheduleTarget(sd *ScheduleDefinition, clusterArn, tdArn string, sv *Service) {
+	if sd.Target.Arn == nil {
+		sd.Target.Arn = aws.String(clusterArn)
+	}
+	p := sd.Target.EcsParameters
+	p.TaskDefinitionArn = aws.String(tdArn)
+	if sv == nil {
+		return
+	}
+	if p.LaunchType == "" && len(p.CapacityProviderStrategy) == 0 {
+		p.LaunchType = schedulerTypes.LaunchType(sv.LaunchType)
+		for _, s := range sv.CapacityProviderStrategy {
+			p.CapacityProviderStrategy = append(p.CapacityProviderStrategy, schedulerTypes.CapacityProviderStrategyItem{
+				CapacityProvider: s.CapacityProvider,
+				Base:             s.Base,
+				Weight:           s.Weight,
+			})
+		}
+	}
+	if p.NetworkConfiguration == nil && sv.NetworkConfiguration != nil {
+		if ac := sv.NetworkConfiguration.AwsvpcConfiguration; ac != nil {
+			p.NetworkConfiguration = &schedulerTypes.NetworkConfiguration{
+				AwsvpcConfiguration: &schedulerTypes.AwsVpcConfiguration{
+					Subnets:        ac.Subnets,
+					SecurityGroups: ac.SecurityGroups,
+					AssignPublicIp: schedulerTypes.AssignPublicIp(ac.AssignPublicIp),
+				},
+			}
+		}
+	}
+	if p.PlatformVersion == nil {
+		p.PlatformVersion = sv.PlatformVersion
+	}
+	if len(p.PlacementConstraints) == 0 {
+		for _, c := range sv.PlacementConstraints {
+			p.PlacementConstraints = append(p.PlacementConstraints, schedulerTypes.PlacementConstraint{
+				Expression: c.Expression,
+				Type:       schedulerTypes.PlacementConstraintType(c.Type),
+			})
+		}
+	}
+	if len(p.PlacementStrategy) == 0 {
+		for _, s := range sv.PlacementStrategy {
+			p.PlacementStrategy = append(p.PlacementStrategy, schedulerTypes.PlacementStrategy{
+				Field: s.Field,
+				Type:  schedulerTypes.PlacementStrategyType(s.Type),
+			})
+		}
+	}
+}
+
+// scheduleDefinitions loads the schedule definitions in the config and completes their targets by the task definition.
+func (d *App) scheduleDefinitions(ctx context.Context, tdArn string) ([]*ScheduleDefinition, error) {
+	var sv *Service
+	if d.config.ServiceDefinitionPath != "" {
+		var err error
+		if sv, err = d.LoadServiceDefinition(d.config.ServiceDefinitionPath); err != nil {
+			return nil, err
+		}
+	}
+	out, err := d.ecs.DescribeClusters(ctx, &ecs.DescribeClustersInput{
+		Clusters: []string{d.config.Cluster},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe cluster %s: %w", d.config.Cluster, err)
+	} else if len(out.Clusters) == 0 {
+		return nil, ErrNotFound(fmt.Sprintf("cluster %s is not found", d.config.Cluster))
+	}
+	clusterArn := aws.ToString(out.Clusters[0].ClusterArn)
+
+	sds := make([]*ScheduleDefinition, 0, len(d.config.Schedules))
+	for _, cs := range d.config.Schedules {
+		sd, err := d.LoadScheduleDefinition(cs.Path)
+		if err != nil {
+			return nil, err
+		}
+		completeScheduleTarget(sd, clusterArn, tdArn, sv)
+		sds = append(sds, sd)
+	}
+	return sds, nil
+}
+
+// describeSchedule returns the schedule, or nil when it does not exist.
+func (d *App) describeSchedule(ctx context.Context, name, groupName *string) (*ScheduleDefinition, string, error) {
+	out, err := d.scheduler.GetSchedule(ctx, &scheduler.GetScheduleInput{
+		Name:      name,
+		GroupName: groupName,
+	})
+	if err != nil {
+		var nf *schedulerTypes.ResourceNotFoundException
+		if errors.As(err, &nf) {
+			return nil, "", nil
+		}
+		return nil, "", fmt.Errorf("failed to get schedule %s: %w", aws.ToString(name), err)
+	}
+	return &ScheduleDefinition{
+		ActionAfterCompletion:      out.ActionAfterCompletion,
+		Description:                out.Description,
+		EndDate:                    out.EndDate,
+		FlexibleTimeWindow:         out.FlexibleTimeWindow,
+		GroupName:                  out.GroupName,
+		KmsKeyArn:                  out.KmsKeyArn,
+		Name:                       out.Name,
+		ScheduleExpression:         out.ScheduleExpression,
+		ScheduleExpressionTimezone: out.ScheduleExpressionTimezone,
+		StartDate:                  out.StartDate,
+		State:                      out.State,
+		Target:                     out.Target,
+	}, aws.ToString(out.Arn), nil
+}
+
+// scheduleTaskDefinitionArn returns the task definition ARN to compare when the new task definition is not registered yet.
+// The remote one is used when it has the same family, because the revision is compared as the task definition.
+func scheduleTaskDefinitionArn(family string, remote *ScheduleDefinition) string {
+	if remote != nil && remote.Target != nil && remote.Target.EcsParameters != nil {
+		arn := aws.ToString(remote.Target.EcsParameters.TaskDefinitionArn)
+		if strings.Split(arnToName(arn), ":")[0] == family {
+			return arn
+		}
+	}
+	return family
+}
+
+// deploySchedules creates or updates the schedules to run the task definition.
+// When tdArn is empty (the task definition is not registered by dry run), the schedules are compared with the family of the task definition.
+func (d *App) deploySchedules(ctx context.Context, tdArn string, dryRun bool) error {
+	if len(d.config.Schedules) == 0 {
+		return nil
+	}
+	var family string
+	if tdArn != "" && !strings.HasPrefix(tdArn, "arn:") {
+		// EventBridge Scheduler requires the ARN of the task definition instead of family:revision.
+		out, err := d.ecs.DescribeTaskDefinition(ctx, &ecs.DescribeTaskDefinitionInput{TaskDefinition: aws.String(tdArn)})
+		if err != nil {
+			return fmt.Errorf("failed to describe task definition %s: %w", tdArn, err)
+		}
+		tdArn = aws.ToString(out.TaskDefinition.TaskDefinitionArn)
+	}
+	if tdArn == "" {
+		td, err := d.LoadTaskDefinition(d.config.TaskDefinitionPath)
+		if err != nil {
+			return err
+		}
+		family = aws.ToString(td.Family)
+	}
+	sds, err := d.scheduleDefinitions(ctx, tdArn)
+	if err != nil {
+		return err
+	}
+	for i, sd := range sds {
+		path := d.config.Schedules[i].Path
+		name := aws.ToString(sd.Name)
+		remote, remoteArn, err := d.describeSchedule(ctx, sd.Name, sd.GroupName)
+		if err != nil {
+			return err
+		}
+		if tdArn == "" {
+			sd.Target.EcsParameters.TaskDefinitionArn = aws.String(scheduleTaskDefinitionArn(family, remote))
+		}
+		ds, err := diffSchedules(sd, remote, path, remoteArn, true)
+		if err != nil {
+			return err
+		}
+		if ds == "" {
+			d.Log("Schedule %s will not change", name)
+			continue
+		}
+		fmt.Fprint(d.humanOutput(), coloredDiff(ds))
+		if dryRun {
+			continue
+		}
+		if remote == nil {
+			d.Log("Creating schedule %s", name)
+			if _, err := d.scheduler.CreateSchedule(ctx, sd); err != nil {
+				return fmt.Errorf("failed to create schedule %s: %w", name, err)
+			}
+			d.Log("Schedule %s is created", name)
+			continue
+		}
+		d.Log("Updating schedule %s", name)
+		if _, err := d.scheduler.UpdateSchedule(ctx, scheduleToUpdateInput(sd)); err != nil {
+			return fmt.Errorf("failed to update schedule %s: %w", name, err)
+		}
+		d.Log("Schedule %s is updated", name)
+	}
+	return nil
+}
+
+func scheduleToUpdateInput(sd *ScheduleDefinition) *scheduler.UpdateScheduleInput {
+	return &scheduler.UpdateScheduleInput{
+		ActionAfterCompletion:      sd.ActionAfterCompletion,
+		ClientToken:                sd.ClientToken,
+		Description:                sd.Description,
+		EndDate:                    sd.EndDate,
+		FlexibleTimeWindow:         sd.FlexibleTimeWindow,
+		GroupName:                  sd.GroupName,
+		KmsKeyArn:                  sd.KmsKeyArn,
+		Name:                       sd.Name,
+		ScheduleExpression:         sd.ScheduleExpression,
+		ScheduleExpressionTimezone: sd.ScheduleExpressionTimezone,
+		StartDate:                  sd.StartDate,
+		State:                      sd.State,
+		Target:                     sd.Target,
+	}
+}
+
+// scheduleDiffs returns the differences of the schedules in the config from the remote ones.
+func (d *App) scheduleDiffs(ctx context.Context, unified bool) ([]string, error) {
+	if len(d.config.Schedules) == 0 {
+		return nil, nil
+	}
+	td, err := d.LoadTaskDefinition(d.config.TaskDefinitionPath)
+	if err != nil {
+		return nil, err
+	}
+	sds, err := d.scheduleDefinitions(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	var diffs []string
+	for i, sd := range sds {
+		remote, remoteArn, err := d.describeSchedule(ctx, sd.Name, sd.GroupName)
+		if err != nil {
+			return nil, err
+		}
+		if remote == nil {
+			d.Log("[INFO] schedule %s not found, will create a new schedule", aws.ToString(sd.Name))
+		}
+		sd.Target.EcsParameters.TaskDefinitionArn = aws.String(scheduleTaskDefinitionArn(aws.ToString(td.Family), remote))
+		ds, err := diffSchedules(sd, remote, d.config.Schedules[i].Path, remoteArn, unified)
+		if err != nil {
+			return nil, err
+		}
+		if ds != "" {
+			diffs = append(diffs, ds)
+		}
+	}
+	return diffs, nil
+}
+
+func diffSchedules(local, remote *ScheduleDefinition, localPath, remoteArn string, unified bool) (string, error) {
+	sortSchedule(local)
+	sortSchedule(remote)
+	if remote != nil && remote.Target != nil && local.Target.RetryPolicy == nil {
+		// ignore the default retry policy when it in local is not defined.
+		remote.Target.RetryPolicy = nil
+	}
+
+	newBytes, err := MarshalJSONForAPI(local)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal new schedule definition: %w", err)
+	}
+	remoteBytes, err := MarshalJSONForAPI(remote)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal remote schedule definition: %w", err)
+	}
+	remoteSd := toDiffString(remoteBytes)
+	newSd := toDiffString(newBytes)
+
+	if unified {
+		edits := myers.ComputeEdits(span.URIFromPath(remoteArn), remoteSd, newSd)
+		return fmt.Sprint(gotextdiff.ToUnified(remoteArn, localPath, remoteSd, edits)), nil
+	}
+
+	ds := diff.Diff(remoteSd, newSd)
+	if ds == "" {
+		return ds, nil
+	}
+	return fmt.Sprintf("--- %s\n+++ %s\n%s", remoteArn, localPath, ds), nil
+}
+
+func sortSchedule(sd *ScheduleDefinition) {
+	if sd == nil || sd.Target == nil || sd.Target.EcsParameters == nil {
+		return
+	}
+	if nc := sd.Target.EcsParameters.NetworkConfiguration; nc != nil {
+		if ac := nc.AwsvpcConfiguration; ac != nil {
+			sort.Strings(ac.Subnets)
+			sort.Strings(ac.SecurityGroups)
+		}
+	}
+}
+
+func (d *App) verifySchedules(ctx context.Context) error {
+	if len(d.config.Schedules) == 0 {
+		return ErrSkipVerify("no Schedules")
+	}
+	td, err := d.LoadTaskDefinition(d.config.TaskDefinitionPath)
+	if err != nil {
+		return err
+	}
+	sds, err := d.scheduleDefinitions(ctx, aws.ToString(td.Family))
+	if err != nil {
+		return err
+	}
+	for _, sd := range sds {
+		name := fmt.Sprintf("Schedule[%s]", aws.ToString(sd.Name))
+		err := d.verifyResource(ctx, name, func(ctx context.Context) error {
+			if td.NetworkMode == types.NetworkModeAwsvpc && sd.Target.EcsParameters.NetworkConfiguration == nil {
+				return errors.New("target.ecsParameters.networkConfiguration is required for the taskDefinition networkMode=awsvpc")
+			}
+			if g := aws.ToString(sd.GroupName); g != defaultScheduleGroupName {
+				if _, err := d.scheduler.GetScheduleGroup(ctx, &scheduler.GetScheduleGroupInput{Name: sd.GroupName}); err != nil {
+					return fmt.Errorf("failed to get schedule group %s: %w", g, err)
+				}
+			}
+			return d.verifyRoleFor(ctx, aws.ToString(sd.Target.RoleArn), "scheduler.amazonaws.com")
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deployScheduledTask registers the task definition and deploys the schedules, for the config without the service.
+func (d *App) deployScheduledTask(ctx context.Context, opt DeployOption) error {
+	td, err := d.LoadTaskDefinition(d.config.TaskDefinitionPath)
+	if err != nil {
+		return err
+	}
+	family := aws.ToString(td.Family)
+	var tdArn string
+	switch {
+	case opt.Revision > 0:
+		if opt.LatestTaskDefinition {
+			return ErrConflictOptions("revision and latest-task-definition are exclusive")
+		}
+		tdArn = fmt.Sprintf("%s:%d", family, opt.Revision)
+	case opt.LatestTaskDefinition, opt.SkipTaskDefinition:
+		if tdArn, err = d.findLatestTaskDefinitionArn(ctx, family); err != nil {
+			return err
+		}
+	case opt.DryRun:
+		d.Log("[INFO] task definition:")
+		d.OutputJSONForAPI(os.Stderr, td)
+	default:
+		newTd, err := d.RegisterTaskDefinition(ctx, td)
+		if err != nil {
+			return err
+		}
+		tdArn = aws.ToString(newTd.TaskDefinitionArn)
+	}
+	if err := d.deploySchedules(ctx, tdArn, opt.DryRun); err != nil {
+		return err
+	}
+	if opt.DryRun {
+		d.Log("DRY RUN OK")
+		return nil
+	}
+	d.Log("Schedules are deployed.")
+	return nil
+}
@@ -0,0 +1,151 @@
+package ecspresso_test
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	ecsTypes "github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/scheduler"
+	"github.com/aws/aws-sdk-go-v2/service/scheduler/types"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/kayac/ecspresso/v2"
+)
+
+const testClusterArn = "arn:aws:ecs:ap-northeast-1:123456789012:cluster/default"
+
+// schedulesStub stores the schedules created and updated.
+type schedulesStub struct {
+	schedules map[string]*scheduler.CreateScheduleInput
+	created   []string
+	updated   []string
+}
+
+func (s *schedulesStub) middleware(stack *middleware.Stack) error {
+	return stack.Initialize.Add(
+		middleware.InitializeMiddlewareFunc(
+			"test",
+			func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+				var out any
+				switch params := in.Parameters.(type) {
+				case *ecs.DescribeClustersInput:
+					out = &ecs.DescribeClustersOutput{
+						Clusters: []ecsTypes.Cluster{{ClusterArn: aws.String(testClusterArn)}},
+					}
+				case *scheduler.GetScheduleInput:
+					sd, ok := s.schedules[aws.ToString(params.Name)]
+					if !ok {
+						return middleware.InitializeOutput{}, middleware.Metadata{}, &types.ResourceNotFoundException{Message: aws.String("not found")}
+					}
+					out = &scheduler.GetScheduleOutput{
+						Arn:                        aws.String("arn:aws:scheduler:ap-northeast-1:123456789012:schedule/default/" + aws.ToString(sd.Name)),
+						ActionAfterCompletion:      sd.ActionAfterCompletion,
+						FlexibleTimeWindow:         sd.FlexibleTimeWindow,
+						GroupName:                  sd.GroupName,
+						Name:                       sd.Name,
+						ScheduleExpression:         sd.ScheduleExpression,
+						ScheduleExpressionTimezone: sd.ScheduleExpressionTimezone,
+						State:                      sd.State,
+						Target:                     sd.Target,
+					}
+				case *scheduler.CreateScheduleInput:
+					s.schedules[aws.ToString(params.Name)] = params
+					s.created = append(s.created, aws.ToString(params.Target.EcsParameters.TaskDefinitionArn))
+					out = &scheduler.CreateScheduleOutput{}
+				case *scheduler.UpdateScheduleInput:
+					sd := s.schedules[aws.ToString(params.Name)]
+					sd.Target = params.Target
+					s.updated = append(s.updated, aws.ToString(params.Target.EcsParameters.TaskDefinitionArn))
+					out = &scheduler.UpdateScheduleOutput{}
+				default:
+					return next.HandleInitialize(ctx, in)
+				}
+				return middleware.InitializeOutput{Result: out}, middleware.Metadata{}, nil
+			},
+		),
+		middleware.Before,
+	)
+}
+
+func TestLoadConfigSchedules(t *testing.T) {
+	ctx := context.Background()
+	loader := ecspresso.NewConfigLoader(nil, nil)
+	conf, err := loader.Load(ctx, "tests/schedules.yml", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conf.Schedules) != 1 || conf.Schedules[0].Path != filepath.Join("tests", "schedule.json") {
+		t.Errorf("unexpected schedules: %#v", conf.Schedules)
+	}
+	_, err = loader.Load(ctx, "tests/schedules_invalid.yml", "")
+	if err == nil || !strings.Contains(err.Error(), "schedules[0].path is required") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestDeploySchedules(t *testing.T) {
+	ctx := context.Background()
+	stub := &schedulesStub{schedules: map[string]*scheduler.CreateScheduleInput{}}
+	ecspresso.SetAWSV2ConfigLoadOptionsFunc([]func(*config.LoadOptions) error{
+		config.WithRegion("ap-northeast-1"),
+		config.WithAPIOptions([]func(*middleware.Stack) error{stub.middleware}),
+	})
+	defer ecspresso.ResetAWSV2ConfigLoadOptionsFunc()
+	app, err := ecspresso.New(ctx, &ecspresso.CLIOptions{ConfigFilePath: "tests/schedules.yml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tdArn := func(rev string) string {
+		return "arn:aws:ecs:ap-northeast-1:123456789012:task-definition/app:" + rev
+	}
+	// created
+	if err := app.DeploySchedules(ctx, tdArn("1"), false); err != nil {
+		t.Fatal(err)
+	}
+	if len(stub.created) != 1 || stub.created[0] != tdArn("1") {
+		t.Fatalf("unexpected created schedules: %v", stub.created)
+	}
+	sd := stub.schedules["daily-report"]
+	if aws.ToString(sd.GroupName) != "default" || sd.State != types.ScheduleStateEnabled || sd.FlexibleTimeWindow.Mode != types.FlexibleTimeWindowModeOff {
+		t.Errorf("unexpected defaults: %#v", sd)
+	}
+	if aws.ToString(sd.Target.Arn) != testClusterArn {
+		t.Errorf("unexpected target: %s", aws.ToString(sd.Target.Arn))
+	}
+	p := sd.Target.EcsParameters
+	if p.LaunchType != types.LaunchTypeEc2 || aws.ToInt32(p.TaskCount) != 1 {
+		t.Errorf("unexpected ecs parameters: %#v", p)
+	}
+	if nc := p.NetworkConfiguration; nc == nil || nc.AwsvpcConfiguration.AssignPublicIp != types.AssignPublicIpEnabled || len(nc.AwsvpcConfiguration.Subnets) != 1 {
+		t.Errorf("network configuration of the service must be used: %#v", nc)
+	}
+
+	// not changed
+	if err := app.DeploySchedules(ctx, tdArn("1"), false); err != nil {
+		t.Fatal(err)
+	}
+	if len(stub.created) != 1 || len(stub.updated) != 0 {
+		t.Errorf("schedules must not be changed: %v %v", stub.created, stub.updated)
+	}
+
+	// dry run
+	if err := app.DeploySchedules(ctx, tdArn("2"), true); err != nil {
+		t.Fatal(err)
+	}
+	if len(stub.updated) != 0 {
+		t.Errorf("schedules must not be updated by dry run: %v", stub.updated)
+	}
+
+	// updated
+	if err := app.DeploySchedules(ctx, tdArn("2"), false); err != nil {
+		t.Fatal(err)
+	}
+	if len(stub.updated) != 1 || stub.updated[0] != tdArn("2") {
+		t.Errorf("unexpected updated schedules: %v", stub.updated)
+	}
+}
@@ -0,0 +1,89 @@
+package ecspresso
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// secretResolver gets the values of the secrets of container definitions
+// from Secrets Manager or SSM Parameter Store.
+type secretResolver struct {
+	secretsmanager *secretsmanager.Client
+	ssm            *ssm.Client
+}
+
+func newSecretResolver(cfg aws.Config) *secretResolver {
+	return &secretResolver{
+		secretsmanager: secretsmanager.NewFromConfig(cfg),
+		ssm:            ssm.NewFromConfig(cfg),
+	}
+}
+
+// value returns the value of the secret specified by valueFrom of the container definition.
+// The value from Secrets Manager can be specified by the JSON key (arn:...:secret:name:json-key:version-stage:version-id).
+// https://docs.aws.amazon.com/AmazonECS/latest/developerguide/specifying-sensitive-data-secrets.html
+func (r *secretResolver) value(ctx context.Context, from string) (string, error) {
+	a, err := arn.Parse(from)
+	if err == nil && a.Service == "secretsmanager" {
+		return r.secretsManagerValue(ctx, from)
+	}
+	name := from
+	if err == nil && a.Service == "ssm" {
+		name = strings.TrimPrefix(a.Resource, "parameter")
+	}
+	out, err := r.ssm.GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get ssm parameter %s: %w", name, err)
+	}
+	return aws.ToString(out.Parameter.Value), nil
+}
+
+func (r *secretResolver) secretsManagerValue(ctx context.Context, from string) (string, error) {
+	// Truncate additional params in secretsmanager Arn.
+	part := strings.Split(from, ":")
+	if len(part) < 7 {
+		return "", fmt.Errorf("invalid secret arn %s", from)
+	}
+	secretArn := strings.Join(part[0:7], ":")
+	in := &secretsmanager.GetSecretValueInput{SecretId: aws.String(secretArn)}
+	if len(part) > 8 && part[8] != "" {
+		in.VersionStage = aws.String(part[8])
+	}
+	if len(part) > 9 && part[9] != "" {
+		in.VersionId = aws.String(part[9])
+	}
+	out, err := r.secretsmanager.GetSecretValue(ctx, in)
+	if err != nil {
+		return "", fmt.Errorf("failed to get secret value from %s secret id %s: %w", from, secretArn, err)
+	}
+	if len(part) < 8 || part[7] == "" {
+		return aws.ToString(out.SecretString), nil
+	}
+	key := part[7]
+	var m map[string]any
+	if err := json.Unmarshal([]byte(aws.ToString(out.SecretString)), &m); err != nil {
+		return "", fmt.Errorf("failed to parse secret string from %s secret id %s: %w", from, secretArn, err)
+	}
+	v, ok := m[key]
+	if !ok {
+		return "", fmt.Errorf("failed to find key %s on secret json value from %s secret id %s", key, from, secretArn)
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal the value of key %s from %s: %w", key, from, err)
+	}
+	return string(b), nil
+}
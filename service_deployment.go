@@ -0,0 +1,204 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// deploymentStrategy returns the deployment strategy of the ECS deployment controller. ROLLING by default.
+func (sv *Service) deploymentStrategy() types.DeploymentStrategy {
+	if dc := sv.DeploymentConfiguration; dc != nil && dc.Strategy != "" {
+		return dc.Strategy
+	}
+	return types.DeploymentStrategyRolling
+}
+
+// isNativeBlueGreen reports whether the service is deployed by the ECS native blue/green, linear or canary strategy.
+func (sv *Service) isNativeBlueGreen() bool {
+	if sv.isCodeDeploy() || sv.isExternal() {
+		return false
+	}
+	return sv.deploymentStrategy() != types.DeploymentStrategyRolling
+}
+
+// inFlightServiceDeployment returns the service deployment in progress. It returns nil when not found.
+func (d *App) inFlightServiceDeployment(ctx context.Context) (*types.ServiceDeployment, error) {
+	out, err := d.ecs.ListServiceDeployments(ctx, &ecs.ListServiceDeploymentsInput{
+		Cluster: aws.String(d.Cluster),
+		Service: aws.String(d.Service),
+		Status: []types.ServiceDeploymentStatus{
+			types.ServiceDeploymentStatusPending,
+			types.ServiceDeploymentStatusInProgress,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list service deployments: %w", err)
+	}
+	if len(out.ServiceDeployments) == 0 {
+		return nil, nil
+	}
+	res, err := d.ecs.DescribeServiceDeployments(ctx, &ecs.DescribeServiceDeploymentsInput{
+		ServiceDeploymentArns: []string{aws.ToString(out.ServiceDeployments[0].ServiceDeploymentArn)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe service deployments: %w", err)
+	}
+	if len(res.ServiceDeployments) == 0 {
+		return nil, nil
+	}
+	return &res.ServiceDeployments[0], nil
+}
+
+// lifecycleStageState holds the last shown state of the service deployment.
+type lifecycleStageState struct {
+	arn    string
+	status types.ServiceDeploymentStatus
+	stage  types.ServiceDeploymentLifecycleStage
+}
+
+// showLifecycleStage shows the lifecycle stage of the service deployment in progress when it changed.
+func (d *App) showLifecycleStage(ctx context.Context, st *lifecycleStageState) error {
+	dp, err := d.inFlightServiceDeployment(ctx)
+	if err != nil {
+		return err
+	}
+	if dp == nil {
+		return nil
+	}
+	arn := aws.ToString(dp.ServiceDeploymentArn)
+	if st.arn == arn && st.status == dp.Status && st.stage == dp.LifecycleStage {
+		return nil
+	}
+	st.arn, st.status, st.stage = arn, dp.Status, dp.LifecycleStage
+
+	var weight *float64
+	msg := fmt.Sprintf("Service deployment %s %s: %s", arnToName(arn), dp.Status, dp.LifecycleStage)
+	if rev := dp.TargetServiceRevision; rev != nil {
+		weight = rev.RequestedProductionTrafficWeight
+		msg += fmt.Sprintf(" (running:%d pending:%d requested:%d", rev.RunningTaskCount, rev.PendingTaskCount, rev.RequestedTaskCount)
+		if weight != nil {
+			msg += fmt.Sprintf(" production traffic:%.0f%%", *weight)
+		}
+		msg += ")"
+	}
+	d.Log(msg)
+	d.emitEvent(&OutputEvent{
+		Type:           OutputEventTypeServiceDeployment,
+		ID:             arn,
+		Status:         string(dp.Status),
+		LifecycleStage: string(dp.LifecycleStage),
+		TrafficWeight:  weight,
+	})
+	return nil
+}
+
+// stopInFlightServiceDeployment stops the service deployment in progress and rolls back it.
+// It reports whether the service deployment was found.
+func (d *App) stopInFlightServiceDeployment(ctx context.Context, opt RollbackOption) (bool, error) {
+	dp, err := d.inFlightServiceDeployment(ctx)
+	if err != nil {
+		return false, err
+	}
+	if dp == nil {
+		return false, nil
+	}
+	arn := aws.ToString(dp.ServiceDeploymentArn)
+	d.Log("the service deployment in progress found, stopping the deployment %s (%s) %s", arnToName(arn), dp.LifecycleStage, opt.DryRunString())
+	if opt.DryRun {
+		return true, nil
+	}
+	if _, err := d.ecs.StopServiceDeployment(ctx, &ecs.StopServiceDeploymentInput{
+		ServiceDeploymentArn: aws.String(arn),
+		StopType:             types.StopServiceDeploymentStopTypeRollback,
+	}); err != nil {
+		return false, fmt.Errorf("failed to stop the service deployment: %w", err)
+	}
+	return true, nil
+}
+
+// serviceDeploymentRecord is a service deployment with the task definition of its target revision.
+type serviceDeploymentRecord struct {
+	ID                string
+	Arn               string
+	Status            types.ServiceDeploymentStatus
+	TaskDefinitionArn string
+	CreatedAt         time.Time
+}
+
+func (r serviceDeploymentRecord) String() string {
+	return fmt.Sprintf("%s\t%s\t%s\t%s", r.ID, arnToName(r.TaskDefinitionArn), r.Status, r.CreatedAt.Local().Format(time.RFC3339))
+}
+
+// serviceDeploymentHistory returns the service deployments in the statuses (all statuses when empty), newest first.
+func (d *App) serviceDeploymentHistory(ctx context.Context, statuses ...types.ServiceDeploymentStatus) ([]serviceDeploymentRecord, error) {
+	var briefs []types.ServiceDeploymentBrief
+	var nextToken *string
+	for {
+		out, err := d.ecs.ListServiceDeployments(ctx, &ecs.ListServiceDeploymentsInput{
+			Cluster:   aws.String(d.Cluster),
+			Service:   aws.String(d.Service),
+			Status:    statuses,
+			NextToken: nextToken,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list service deployments: %w", err)
+		}
+		briefs = append(briefs, out.ServiceDeployments...)
+		if nextToken = out.NextToken; nextToken == nil {
+			break
+		}
+	}
+	sort.SliceStable(briefs, func(i, j int) bool {
+		return aws.ToTime(briefs[i].CreatedAt).After(aws.ToTime(briefs[j].CreatedAt))
+	})
+
+	// resolve the task definitions of the target revisions
+	tds := make(map[string]string)
+	var revArns []string
+	for _, b := range briefs {
+		if arn := aws.ToString(b.TargetServiceRevisionArn); arn != "" {
+			if _, ok := tds[arn]; !ok {
+				tds[arn] = ""
+				revArns = append(revArns, arn)
+			}
+		}
+	}
+	for i := 0; i < len(revArns); i += 20 { // DescribeServiceRevisions accepts up to 20 ARNs
+		end := i + 20
+		if end > len(revArns) {
+			end = len(revArns)
+		}
+		out, err := d.ecs.DescribeServiceRevisions(ctx, &ecs.DescribeServiceRevisionsInput{
+			ServiceRevisionArns: revArns[i:end],
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe service revisions: %w", err)
+		}
+		for _, rev := range out.ServiceRevisions {
+			tds[aws.ToString(rev.ServiceRevisionArn)] = aws.ToString(rev.TaskDefinition)
+		}
+	}
+
+	records := make([]serviceDeploymentRecord, 0, len(briefs))
+	for _, b := range briefs {
+		td := tds[aws.ToString(b.TargetServiceRevisionArn)]
+		if td == "" {
+			d.Log("[DEBUG] task definition of the service deployment %s is not found", aws.ToString(b.ServiceDeploymentArn))
+			continue
+		}
+		records = append(records, serviceDeploymentRecord{
+			ID:                arnToName(aws.ToString(b.ServiceDeploymentArn)),
+			Arn:               aws.ToString(b.ServiceDeploymentArn),
+			Status:            b.Status,
+			TaskDefinitionArn: td,
+			CreatedAt:         aws.ToTime(b.CreatedAt),
+		})
+	}
+	return records, nil
+}
@@ -0,0 +1,287 @@
+package ecspresso_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/google/go-cmp/cmp"
+	"github.com/kayac/ecspresso/v2"
+)
+
+func TestLoadServiceDefinitionBlueGreen(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("AWS_REGION", "ap-northeast-1")
+	app, err := ecspresso.New(ctx, &ecspresso.CLIOptions{ConfigFilePath: "tests/ecspresso.yml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv, err := app.LoadServiceDefinition("tests/sv-bluegreen.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc := ecspresso.ServiceDefinitionForDiff(sv).DeploymentConfiguration
+	if dc.Strategy != types.DeploymentStrategyBlueGreen || aws.ToInt32(dc.BakeTimeInMinutes) != 5 {
+		t.Errorf("unexpected deployment strategy: %s bake time %d", dc.Strategy, aws.ToInt32(dc.BakeTimeInMinutes))
+	}
+	if len(dc.LifecycleHooks) != 1 || dc.LifecycleHooks[0].LifecycleStages[0] != types.DeploymentLifecycleHookStagePostTestTrafficShift {
+		t.Errorf("unexpected lifecycle hooks: %#v", dc.LifecycleHooks)
+	}
+	if ac := sv.LoadBalancers[0].AdvancedConfiguration; ac == nil || aws.ToString(ac.AlternateTargetGroupArn) == "" {
+		t.Errorf("unexpected advanced configuration: %#v", ac)
+	}
+}
+
+func TestServiceDefinitionForDiffRollingStrategy(t *testing.T) {
+	omitted := &ecspresso.Service{}
+	rolling := &ecspresso.Service{}
+	rolling.DeploymentConfiguration = &types.DeploymentConfiguration{
+		Strategy:              types.DeploymentStrategyRolling,
+		BakeTimeInMinutes:     aws.Int32(0),
+		MaximumPercent:        aws.Int32(200),
+		MinimumHealthyPercent: aws.Int32(100),
+	}
+	a := ecspresso.ServiceDefinitionForDiff(omitted)
+	b := ecspresso.ServiceDefinitionForDiff(rolling)
+	if diff := cmp.Diff(ecspresso.MustMarshalJSONStringForAPI(a), ecspresso.MustMarshalJSONStringForAPI(b)); diff != "" {
+		t.Errorf("unexpected diff: %s", diff)
+	}
+}
+
+func TestRollbackStopsServiceDeployment(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("AWS_REGION", "ap-northeast-1")
+	const dpArn = "arn:aws:ecs:ap-northeast-1:123456789012:service-deployment/default/test/abcdef"
+	const tdArn = "arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:2"
+	var calls []string
+	var stopped *ecs.StopServiceDeploymentInput
+	stub := func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(
+			middleware.InitializeMiddlewareFunc(
+				"test",
+				func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+					var out any
+					switch params := in.Parameters.(type) {
+					case *ecs.ListServiceDeploymentsInput:
+						calls = append(calls, "ListServiceDeployments")
+						out = &ecs.ListServiceDeploymentsOutput{
+							ServiceDeployments: []types.ServiceDeploymentBrief{{ServiceDeploymentArn: aws.String(dpArn)}},
+						}
+					case *ecs.DescribeServiceDeploymentsInput:
+						calls = append(calls, "DescribeServiceDeployments")
+						out = &ecs.DescribeServiceDeploymentsOutput{
+							ServiceDeployments: []types.ServiceDeployment{{
+								ServiceDeploymentArn: aws.String(dpArn),
+								Status:               types.ServiceDeploymentStatusInProgress,
+								LifecycleStage:       types.ServiceDeploymentLifecycleStageBakeTime,
+							}},
+						}
+					case *ecs.StopServiceDeploymentInput:
+						calls = append(calls, "StopServiceDeployment")
+						stopped = params
+						out = &ecs.StopServiceDeploymentOutput{ServiceDeploymentArn: aws.String(dpArn)}
+					default:
+						calls = append(calls, "other")
+						return next.HandleInitialize(ctx, in)
+					}
+					return middleware.InitializeOutput{Result: out}, middleware.Metadata{}, nil
+				},
+			),
+			middleware.Before,
+		)
+	}
+	ecspresso.SetAWSV2ConfigLoadOptionsFunc([]func(*config.LoadOptions) error{
+		config.WithRegion("ap-northeast-1"),
+		config.WithAPIOptions([]func(*middleware.Stack) error{stub}),
+	})
+	defer ecspresso.ResetAWSV2ConfigLoadOptionsFunc()
+	app, err := ecspresso.New(ctx, &ecspresso.CLIOptions{ConfigFilePath: "tests/ecspresso.yml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sv := &ecspresso.Service{}
+	sv.TaskDefinition = aws.String(tdArn)
+	sv.DeploymentConfiguration = &types.DeploymentConfiguration{Strategy: types.DeploymentStrategyBlueGreen}
+	rollback, err := app.RollbackFunc(sv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rolledBack, err := rollback(ctx, sv, ecspresso.RollbackOption{Wait: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rolledBack != tdArn {
+		t.Errorf("unexpected rolled back task definition: %s", rolledBack)
+	}
+	expected := []string{"ListServiceDeployments", "DescribeServiceDeployments", "StopServiceDeployment"}
+	if diff := cmp.Diff(expected, calls); diff != "" {
+		t.Errorf("unexpected calls: %s", diff)
+	}
+	if stopped == nil || aws.ToString(stopped.ServiceDeploymentArn) != dpArn || stopped.StopType != types.StopServiceDeploymentStopTypeRollback {
+		t.Errorf("unexpected stop input: %#v", stopped)
+	}
+}
+
+// serviceDeploymentHistoryMiddleware returns the service deployments targeting the task definition revisions.
+// The revisions are ordered newest first. ListTaskDefinitions returns the revisions 1-5 for the fallback.
+func serviceDeploymentHistoryMiddleware(deployments []types.ServiceDeploymentBrief) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(
+			middleware.InitializeMiddlewareFunc(
+				"test",
+				func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+					var out any
+					switch params := in.Parameters.(type) {
+					case *ecs.ListServiceDeploymentsInput:
+						res := &ecs.ListServiceDeploymentsOutput{}
+						for _, dp := range deployments {
+							if len(params.Status) == 0 || dp.Status == params.Status[0] {
+								res.ServiceDeployments = append(res.ServiceDeployments, dp)
+							}
+						}
+						out = res
+					case *ecs.DescribeServiceRevisionsInput:
+						res := &ecs.DescribeServiceRevisionsOutput{}
+						for _, arn := range params.ServiceRevisionArns {
+							var rev int
+							fmt.Sscanf(arn, "arn:aws:ecs:ap-northeast-1:123456789012:service-revision/default/test/%d", &rev)
+							res.ServiceRevisions = append(res.ServiceRevisions, types.ServiceRevision{
+								ServiceRevisionArn: aws.String(arn),
+								TaskDefinition:     aws.String(fmt.Sprintf(tasksetTdArnFmt, rev)),
+							})
+						}
+						out = res
+					case *ecs.DescribeTaskDefinitionInput:
+						var rev int
+						fmt.Sscanf(aws.ToString(params.TaskDefinition), "test:%d", &rev)
+						out = &ecs.DescribeTaskDefinitionOutput{
+							TaskDefinition: &types.TaskDefinition{TaskDefinitionArn: aws.String(fmt.Sprintf(tasksetTdArnFmt, rev))},
+						}
+					case *ecs.ListTaskDefinitionsInput:
+						res := &ecs.ListTaskDefinitionsOutput{}
+						for rev := 5; rev >= 1; rev-- {
+							res.TaskDefinitionArns = append(res.TaskDefinitionArns, fmt.Sprintf(tasksetTdArnFmt, rev))
+						}
+						out = res
+					default:
+						return next.HandleInitialize(ctx, in)
+					}
+					return middleware.InitializeOutput{Result: out}, middleware.Metadata{}, nil
+				},
+			),
+			middleware.Before,
+		)
+	}
+}
+
+func serviceDeploymentBrief(id string, rev int, status types.ServiceDeploymentStatus, createdAt time.Time) types.ServiceDeploymentBrief {
+	return types.ServiceDeploymentBrief{
+		ServiceDeploymentArn:     aws.String("arn:aws:ecs:ap-northeast-1:123456789012:service-deployment/default/test/" + id),
+		TargetServiceRevisionArn: aws.String(fmt.Sprintf("arn:aws:ecs:ap-northeast-1:123456789012:service-revision/default/test/%d", rev)),
+		Status:                   status,
+		CreatedAt:                aws.Time(createdAt),
+	}
+}
+
+func TestRollbackTarget(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("AWS_REGION", "ap-northeast-1")
+	ecspresso.SetStdinTerminal(false)
+	now := time.Now()
+	// test:3 was deployed after test:4, then test:5 was deployed and test:4 failed
+	history := []types.ServiceDeploymentBrief{
+		serviceDeploymentBrief("dp5", 5, types.ServiceDeploymentStatusSuccessful, now),
+		serviceDeploymentBrief("dp4", 4, types.ServiceDeploymentStatusRollbackSuccessful, now.Add(-time.Hour)),
+		serviceDeploymentBrief("dp3", 3, types.ServiceDeploymentStatusSuccessful, now.Add(-2*time.Hour)),
+		serviceDeploymentBrief("dp1", 1, types.ServiceDeploymentStatusSuccessful, now.Add(-3*time.Hour)),
+	}
+	current := fmt.Sprintf(tasksetTdArnFmt, 5)
+	tests := []struct {
+		name     string
+		history  []types.ServiceDeploymentBrief
+		opt      ecspresso.RollbackOption
+		terminal bool
+		expect   int
+	}{
+		{name: "last successful deployment", history: history, expect: 3},
+		{name: "to deployment", history: history, opt: ecspresso.RollbackOption{ToDeployment: "dp1"}, expect: 1},
+		{name: "revision", history: history, opt: ecspresso.RollbackOption{Revision: 2}, expect: 2},
+		{name: "no history", history: nil, expect: 4},
+		{name: "no select on a terminal", history: history, opt: ecspresso.RollbackOption{NoSelect: true}, terminal: true, expect: 3},
+		{name: "to deployment on a terminal", history: history, opt: ecspresso.RollbackOption{ToDeployment: "dp1"}, terminal: true, expect: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ecspresso.SetStdinTerminal(tt.terminal)
+			defer ecspresso.SetStdinTerminal(false)
+			ecspresso.SetAWSV2ConfigLoadOptionsFunc([]func(*config.LoadOptions) error{
+				config.WithRegion("ap-northeast-1"),
+				config.WithAPIOptions([]func(*middleware.Stack) error{
+					serviceDeploymentHistoryMiddleware(tt.history),
+				}),
+			})
+			defer ecspresso.ResetAWSV2ConfigLoadOptionsFunc()
+			app, err := ecspresso.New(ctx, &ecspresso.CLIOptions{ConfigFilePath: "tests/ecspresso.yml"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			sv := &ecspresso.Service{}
+			sv.TaskDefinition = aws.String(current)
+			target, err := app.RollbackTarget(ctx, sv, current, tt.opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expect := fmt.Sprintf(tasksetTdArnFmt, tt.expect); target != expect {
+				t.Errorf("unexpected rollback target: %s expected %s", target, expect)
+			}
+		})
+	}
+}
+
+func TestRollbackTargetSelectWithoutTerminal(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("AWS_REGION", "ap-northeast-1")
+	ecspresso.SetStdinTerminal(false)
+	now := time.Now()
+	ecspresso.SetAWSV2ConfigLoadOptionsFunc([]func(*config.LoadOptions) error{
+		config.WithRegion("ap-northeast-1"),
+		config.WithAPIOptions([]func(*middleware.Stack) error{
+			serviceDeploymentHistoryMiddleware([]types.ServiceDeploymentBrief{
+				serviceDeploymentBrief("dp5", 5, types.ServiceDeploymentStatusSuccessful, now),
+				serviceDeploymentBrief("dp3", 3, types.ServiceDeploymentStatusSuccessful, now.Add(-time.Hour)),
+			}),
+		}),
+	})
+	defer ecspresso.ResetAWSV2ConfigLoadOptionsFunc()
+	app, err := ecspresso.New(ctx, &ecspresso.CLIOptions{ConfigFilePath: "tests/ecspresso.yml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := fmt.Sprintf(tasksetTdArnFmt, 5)
+	sv := &ecspresso.Service{}
+	sv.TaskDefinition = aws.String(current)
+	if _, err := app.RollbackTarget(ctx, sv, current, ecspresso.RollbackOption{Select: true}); err == nil {
+		t.Error("--select must fail without a terminal")
+	}
+
+	sv.DeploymentController = &types.DeploymentController{Type: types.DeploymentControllerTypeCodeDeploy}
+	var ec ecspresso.ErrConflictOptions
+	if _, err := app.RollbackTarget(ctx, sv, current, ecspresso.RollbackOption{Select: true}); !errors.As(err, &ec) {
+		t.Errorf("--select must conflict with CodeDeploy: %v", err)
+	}
+	if _, err := app.RollbackTarget(ctx, sv, current, ecspresso.RollbackOption{}); err != nil {
+		t.Errorf("the picker must not be required with CodeDeploy by default: %v", err)
+	}
+
+	if err := app.Rollback(ctx, ecspresso.RollbackOption{Select: true, NoSelect: true}); !errors.As(err, &ec) {
+		t.Errorf("--select and --no-select must conflict: %v", err)
+	}
+}
@@ -0,0 +1,307 @@
+package ecspresso
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type StackOption struct {
+	Action      string `arg:"" help:"action for the services in the stack (deploy, diff, verify, status)" enum:"deploy,diff,verify,status"`
+	Stack       string `help:"stack file" default:"ecspresso-stack.yml" env:"ECSPRESSO_STACK"`
+	MaxParallel int    `help:"max number of services deployed in parallel (0 means unlimited)" default:"0"`
+	Unified     bool   `help:"unified diff format" default:"true" negatable:""`
+	Events      int    `help:"show events num" default:"2"`
+
+	// Deploy is passed to deploy of each service.
+	// With --wait, dependents are deployed after the upstream services are stable.
+	Deploy DeployOption `embed:""`
+	// Verify is passed to verify of each service.
+	Verify VerifyOption `embed:""`
+}
+
+func (o *StackOption) validate() error {
+	if o.Action != "deploy" {
+		return nil
+	}
+	if o.Deploy.PlanOut != "" {
+		return ErrConflictOptions("stack deploy does not support --plan-out")
+	}
+	if o.Deploy.DiagnosticsFile != "" {
+		return ErrConflictOptions("stack deploy does not support --diagnostics-file. the diagnostics of each service are saved to a temporary file")
+	}
+	return nil
+}
+
+// Stack represents a set of ecspresso configurations deployed together.
+type Stack struct {
+	Services map[string]*StackService `yaml:"services" json:"services"`
+
+	path  string
+	order []string
+}
+
+// StackService represents a service in a stack.
+type StackService struct {
+	Config    string   `yaml:"config" json:"config"`
+	DependsOn []string `yaml:"depends_on,omitempty" json:"depends_on,omitempty"`
+}
+
+func loadStack(path string, loader *configLoader) (*Stack, error) {
+	st := &Stack{path: path}
+	ext := filepath.Ext(path)
+	switch ext {
+	case ymlExt, yamlExt:
+		b, err := loader.ReadWithEnv(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read stack file %s: %w", path, err)
+		}
+		if err := unmarshalYAML(b, st, path); err != nil {
+			return nil, fmt.Errorf("failed to parse stack file %s: %w", path, err)
+		}
+	case jsonExt, jsonnetExt:
+		jsonStr, err := loader.VM.EvaluateFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate stack file %s: %w", path, err)
+		}
+		b, err := loader.ReadWithEnvBytes([]byte(jsonStr))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read stack file %s: %w", path, err)
+		}
+		if err := unmarshalJSON(b, st, path); err != nil {
+			return nil, fmt.Errorf("failed to parse stack file %s: %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported stack file extension: %s", ext)
+	}
+	if err := st.restrict(); err != nil {
+		return nil, fmt.Errorf("invalid stack file %s: %w", path, err)
+	}
+	return st, nil
+}
+
+func (st *Stack) restrict() error {
+	if len(st.Services) == 0 {
+		return errors.New("no services are defined")
+	}
+	dir := filepath.Dir(st.path)
+	for name, s := range st.Services {
+		if s == nil || s.Config == "" {
+			return fmt.Errorf("config is required for service %s", name)
+		}
+		if !filepath.IsAbs(s.Config) {
+			s.Config = filepath.Join(dir, s.Config)
+		}
+		for _, dep := range s.DependsOn {
+			if _, ok := st.Services[dep]; !ok {
+				return fmt.Errorf("service %s depends on undefined service %s", name, dep)
+			}
+			if dep == name {
+				return fmt.Errorf("service %s depends on itself", name)
+			}
+		}
+	}
+	order, err := st.sort()
+	if err != nil {
+		return err
+	}
+	st.order = order
+	return nil
+}
+
+// sort returns the names of services in topological order.
+// Services that have no dependencies between each other are sorted by name.
+func (st *Stack) sort() ([]string, error) {
+	indegree := make(map[string]int, len(st.Services))
+	dependents := make(map[string][]string, len(st.Services))
+	for name, s := range st.Services {
+		indegree[name] = len(s.DependsOn)
+		for _, dep := range s.DependsOn {
+			dependents[dep] = append(dependents[dep], name)
+		}
+	}
+	var queue []string
+	for name, n := range indegree {
+		if n == 0 {
+			queue = append(queue, name)
+		}
+	}
+	sort.Strings(queue)
+
+	order := make([]string, 0, len(st.Services))
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		order = append(order, name)
+		var next []string
+		for _, dependent := range dependents[name] {
+			indegree[dependent]--
+			if indegree[dependent] == 0 {
+				next = append(next, dependent)
+			}
+		}
+		sort.Strings(next)
+		queue = append(queue, next...)
+	}
+	if len(order) != len(st.Services) {
+		var cycle []string
+		for name, n := range indegree {
+			if n > 0 {
+				cycle = append(cycle, name)
+			}
+		}
+		sort.Strings(cycle)
+		return nil, fmt.Errorf("circular dependency detected among services: %s", strings.Join(cycle, ", "))
+	}
+	return order, nil
+}
+
+// Order returns the names of services in the order of dependencies.
+func (st *Stack) Order() []string {
+	return st.order
+}
+
+type stackFunc func(ctx context.Context, app *App) error
+
+type stackResult struct {
+	err     error
+	skipped bool
+}
+
+func (opt *StackOption) run(ctx context.Context, cliOpts *CLIOptions) error {
+	if err := opt.validate(); err != nil {
+		return err
+	}
+	st, err := loadStack(opt.Stack, newConfigLoader(cliOpts.ExtStr, cliOpts.ExtCode))
+	if err != nil {
+		return err
+	}
+	Log("[INFO] stack %s services: %s", opt.Stack, strings.Join(st.Order(), ", "))
+
+	// load all of the configurations before running any actions
+	apps := make(map[string]*App, len(st.Services))
+	for _, name := range st.Order() {
+		o := *cliOpts
+		o.ConfigFilePath = st.Services[name].Config
+		app, err := New(ctx, &o)
+		if err != nil {
+			return fmt.Errorf("failed to load service %s in stack: %w", name, err)
+		}
+		apps[name] = app
+	}
+
+	var results map[string]stackResult
+	switch opt.Action {
+	case "deploy":
+		results = st.runParallel(ctx, apps, opt.MaxParallel, func(ctx context.Context, app *App) error {
+			return app.Deploy(ctx, opt.Deploy)
+		})
+	case "diff":
+		results = st.runSerial(ctx, apps, func(ctx context.Context, app *App) error {
+			return app.Diff(ctx, DiffOption{Unified: opt.Unified})
+		})
+	case "verify":
+		results = st.runSerial(ctx, apps, func(ctx context.Context, app *App) error {
+			return app.Verify(ctx, opt.Verify)
+		})
+	case "status":
+		results = st.runSerial(ctx, apps, func(ctx context.Context, app *App) error {
+			return app.Status(ctx, StatusOption{Events: opt.Events})
+		})
+	default:
+		return fmt.Errorf("unknown stack action: %s", opt.Action)
+	}
+	return st.report(opt.Action, results)
+}
+
+// runSerial runs fn for each service in the order of dependencies.
+// A failure of a service does not stop the others.
+func (st *Stack) runSerial(ctx context.Context, apps map[string]*App, fn stackFunc) map[string]stackResult {
+	results := make(map[string]stackResult, len(apps))
+	for _, name := range st.order {
+		if err := ctx.Err(); err != nil {
+			results[name] = stackResult{err: err, skipped: true}
+			continue
+		}
+		results[name] = stackResult{err: fn(ctx, apps[name])}
+	}
+	return results
+}
+
+// runParallel runs fn for each service after all of its dependencies succeeded.
+// Services which have no dependencies between each other run in parallel.
+// When a service fails, its dependents are skipped.
+func (st *Stack) runParallel(ctx context.Context, apps map[string]*App, maxParallel int, fn stackFunc) map[string]stackResult {
+	var mu sync.Mutex
+	results := make(map[string]stackResult, len(apps))
+	done := make(map[string]chan struct{}, len(apps))
+	for name := range st.Services {
+		done[name] = make(chan struct{})
+	}
+	var sem chan struct{}
+	if maxParallel > 0 {
+		sem = make(chan struct{}, maxParallel)
+	}
+
+	var wg sync.WaitGroup
+	for _, name := range st.order {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			defer close(done[name])
+			result := func() stackResult {
+				for _, dep := range st.Services[name].DependsOn {
+					<-done[dep]
+					mu.Lock()
+					r := results[dep]
+					mu.Unlock()
+					if r.err != nil {
+						return stackResult{err: fmt.Errorf("dependency %s was not completed", dep), skipped: true}
+					}
+				}
+				if sem != nil {
+					select {
+					case sem <- struct{}{}:
+						defer func() { <-sem }()
+					case <-ctx.Done():
+						return stackResult{err: ctx.Err(), skipped: true}
+					}
+				}
+				if err := ctx.Err(); err != nil {
+					return stackResult{err: err, skipped: true}
+				}
+				return stackResult{err: fn(ctx, apps[name])}
+			}()
+			mu.Lock()
+			results[name] = result
+			mu.Unlock()
+		}(name)
+	}
+	wg.Wait()
+	return results
+}
+
+func (st *Stack) report(action string, results map[string]stackResult) error {
+	var failed []string
+	for _, name := range st.order {
+		r := results[name]
+		switch {
+		case r.skipped:
+			Log("[WARNING] stack %s %s: SKIPPED (%s)", action, name, r.err)
+			failed = append(failed, name)
+		case r.err != nil:
+			Log("[ERROR] stack %s %s: FAILED %s", action, name, r.err)
+			failed = append(failed, name)
+		default:
+			Log("[INFO] stack %s %s: OK", action, name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("stack %s failed for services: %s", action, strings.Join(failed, ", "))
+	}
+	return nil
+}
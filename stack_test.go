@@ -0,0 +1,126 @@
+package ecspresso_test
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kayac/ecspresso/v2"
+)
+
+func TestLoadStack(t *testing.T) {
+	t.Setenv("ECSPRESSO_TEST_STACK_DB", "db/ecspresso.yml")
+	loader := ecspresso.NewConfigLoader(nil, nil)
+	st, err := ecspresso.LoadStack("tests/stack/ecspresso-stack.yml", loader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"cache", "db-migrate", "api", "worker", "web"}
+	if diff := cmp.Diff(expected, st.Order()); diff != "" {
+		t.Errorf("unexpected order: %s", diff)
+	}
+	configs := map[string]string{
+		"web":        "tests/stack/web/ecspresso.yml",
+		"api":        "tests/stack/api/ecspresso.yml",
+		"db-migrate": "tests/stack/db/ecspresso.yml",
+		"cache":      "/path/to/cache/ecspresso.yml",
+		"worker":     "tests/stack/worker/ecspresso.yml",
+	}
+	for name, path := range configs {
+		if st.Services[name].Config != path {
+			t.Errorf("unexpected config path of %s: expected %s, got %s", name, path, st.Services[name].Config)
+		}
+	}
+}
+
+func TestLoadStackJsonnet(t *testing.T) {
+	loader := ecspresso.NewConfigLoader(nil, nil)
+	st, err := ecspresso.LoadStack("tests/stack/ecspresso-stack.jsonnet", loader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"api", "web"}, st.Order()); diff != "" {
+		t.Errorf("unexpected order: %s", diff)
+	}
+}
+
+func TestLoadStackInvalid(t *testing.T) {
+	cases := map[string]string{
+		"tests/stack/circular.yml":  "circular dependency detected among services: a, b, c",
+		"tests/stack/undefined.yml": "service a depends on undefined service x",
+	}
+	loader := ecspresso.NewConfigLoader(nil, nil)
+	for path, msg := range cases {
+		_, err := ecspresso.LoadStack(path, loader)
+		if err == nil {
+			t.Errorf("%s: expected error, but got nil", path)
+			continue
+		}
+		if !strings.Contains(err.Error(), msg) {
+			t.Errorf("%s: unexpected error: %s", path, err)
+		}
+	}
+}
+
+func TestStackOptionValidate(t *testing.T) {
+	cases := []struct {
+		opt   ecspresso.StackOption
+		valid bool
+	}{
+		{opt: ecspresso.StackOption{Action: "deploy", Deploy: ecspresso.DeployOption{RollbackOnFailure: true}}, valid: true},
+		{opt: ecspresso.StackOption{Action: "deploy", Deploy: ecspresso.DeployOption{PlanOut: "plan.json"}}, valid: false},
+		{opt: ecspresso.StackOption{Action: "deploy", Deploy: ecspresso.DeployOption{DiagnosticsFile: "diag.json"}}, valid: false},
+		{opt: ecspresso.StackOption{Action: "diff", Deploy: ecspresso.DeployOption{PlanOut: "plan.json"}}, valid: true},
+	}
+	for i, c := range cases {
+		err := c.opt.Validate()
+		if c.valid && err != nil {
+			t.Errorf("case %d: unexpected error: %s", i, err)
+		}
+		if !c.valid {
+			var e ecspresso.ErrConflictOptions
+			if !errors.As(err, &e) {
+				t.Errorf("case %d: expected ErrConflictOptions, but got %v", i, err)
+			}
+		}
+	}
+}
+
+func TestRunStackParallel(t *testing.T) {
+	t.Setenv("ECSPRESSO_TEST_STACK_DB", "db/ecspresso.yml")
+	loader := ecspresso.NewConfigLoader(nil, nil)
+	st, err := ecspresso.LoadStack("tests/stack/ecspresso-stack.yml", loader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var ran []string
+	errs := ecspresso.RunStackParallel(context.Background(), st, 1, func(name string) error {
+		mu.Lock()
+		ran = append(ran, name)
+		mu.Unlock()
+		if name == "db-migrate" {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	sort.Strings(ran)
+	// api, worker and web are skipped because db-migrate failed
+	if diff := cmp.Diff([]string{"cache", "db-migrate"}, ran); diff != "" {
+		t.Errorf("unexpected services ran: %s", diff)
+	}
+	for _, name := range []string{"cache"} {
+		if errs[name] != nil {
+			t.Errorf("unexpected error for %s: %s", name, errs[name])
+		}
+	}
+	for _, name := range []string{"db-migrate", "api", "worker", "web"} {
+		if errs[name] == nil {
+			t.Errorf("expected error for %s, but got nil", name)
+		}
+	}
+}
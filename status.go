@@ -1,14 +1,154 @@
 package ecspresso
 
-import "context"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	aasTypes "github.com/aws/aws-sdk-go-v2/service/applicationautoscaling/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/goccy/go-yaml"
+)
 
 type StatusOption struct {
-	Events int `help:"show events num" default:"10"`
+	Events   int           `help:"show events num" default:"10"`
+	Watch    bool          `help:"refresh the status until interrupted" default:"false"`
+	Interval time.Duration `help:"interval of refreshing the status with --watch" default:"5s"`
+	Output   string        `help:"output format (table, json, yaml)" default:"table" enum:"table,json,yaml"`
+	Query    string        `help:"jq query to filter the status. works with --output json or yaml" default:""`
+}
+
+// ServiceStatus represents the status of the service shown by the status command.
+type ServiceStatus struct {
+	Service        string               `json:"service"`
+	Cluster        string               `json:"cluster"`
+	TaskDefinition string               `json:"taskDefinition"`
+	Deployments    []types.Deployment   `json:"deployments,omitempty"`
+	TaskSets       []types.TaskSet      `json:"taskSets,omitempty"`
+	AutoScaling    *AutoScalingStatus   `json:"autoScaling,omitempty"`
+	Targets        []TargetHealth       `json:"targets,omitempty"`
+	Events         []types.ServiceEvent `json:"events,omitempty"`
+}
+
+// AutoScalingStatus represents the Application Auto Scaling settings of the service.
+type AutoScalingStatus struct {
+	ResourceID string                    `json:"resourceId"`
+	Targets    []aasTypes.ScalableTarget `json:"targets,omitempty"`
+	Policies   []aasTypes.ScalingPolicy  `json:"policies,omitempty"`
 }
 
 func (d *App) Status(ctx context.Context, opt StatusOption) error {
+	isTable := opt.Output == "" || opt.Output == "table"
+	if opt.Query != "" && isTable {
+		return ErrConflictOptions("--query works with --output json or yaml")
+	}
+	if opt.Watch {
+		if !isTable {
+			return ErrConflictOptions("--watch works with --output table only")
+		}
+		// Do not call d.Start() because it runs until interrupted.
+		return d.watchStatus(ctx, opt)
+	}
 	ctx, cancel := d.Start(ctx)
 	defer cancel()
-	_, err := d.DescribeServiceStatus(ctx, opt.Events)
-	return err
+	_, st, err := d.describeServiceStatus(ctx, opt.Events)
+	if err != nil {
+		return err
+	}
+	switch opt.Output {
+	case "json":
+		return st.OutputJSON(os.Stdout, opt.Query)
+	case "yaml":
+		return st.OutputYAML(os.Stdout, opt.Query)
+	default:
+		return st.OutputTable(os.Stdout)
+	}
+}
+
+// OutputTable writes the status as human readable text.
+func (st *ServiceStatus) OutputTable(w io.Writer) error {
+	fmt.Fprintln(w, "Service:", st.Service)
+	fmt.Fprintln(w, "Cluster:", st.Cluster)
+	fmt.Fprintln(w, "TaskDefinition:", st.TaskDefinition)
+	if len(st.Deployments) > 0 {
+		fmt.Fprintln(w, "Deployments:")
+		for _, dep := range st.Deployments {
+			fmt.Fprintln(w, spcIndent+formatDeployment(dep))
+		}
+	}
+	if len(st.TaskSets) > 0 {
+		fmt.Fprintln(w, "TaskSets:")
+		for _, ts := range st.TaskSets {
+			fmt.Fprintln(w, spcIndent+formatTaskSet(ts))
+		}
+	}
+	if as := st.AutoScaling; as != nil {
+		fmt.Fprintln(w, "AutoScaling:")
+		for _, target := range as.Targets {
+			fmt.Fprintln(w, formatScalableTarget(target))
+		}
+		for _, policy := range as.Policies {
+			fmt.Fprintln(w, formatScalingPolicy(policy))
+		}
+	}
+	if len(st.Targets) > 0 {
+		fmt.Fprintln(w, "Targets:")
+		for _, th := range st.Targets {
+			fmt.Fprintln(w, spcIndent+th.String())
+		}
+	}
+	fmt.Fprintln(w, "Events:")
+	for _, e := range st.Events {
+		fmt.Fprintln(w, formatEvent(e))
+	}
+	return nil
+}
+
+// OutputJSON writes the status (or the results of the jq query) as JSON.
+func (st *ServiceStatus) OutputJSON(w io.Writer, query string) error {
+	return outputQueryResults(w, st, query, marshalJSONIndent)
+}
+
+// OutputYAML writes the status (or the results of the jq query) as YAML.
+func (st *ServiceStatus) OutputYAML(w io.Writer, query string) error {
+	return outputQueryResults(w, st, query, func(v any) ([]byte, error) {
+		// via JSON to keep the numbers as integers
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return yaml.JSONToYAML(b)
+	})
+}
+
+// outputQueryResults writes v in the keys same as AWS API, or the results of the jq query.
+// The string results of the query are written as is.
+func outputQueryResults(w io.Writer, v any, query string, marshal func(any) ([]byte, error)) error {
+	m, err := toMapForAPI(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal: %w", err)
+	}
+	results := []any{m}
+	if query != "" {
+		if results, err = jqQuery(m, query); err != nil {
+			return fmt.Errorf("failed to query %s: %w", query, err)
+		}
+	}
+	for _, r := range results {
+		if s, ok := r.(string); ok {
+			fmt.Fprintln(w, s)
+			continue
+		}
+		b, err := marshal(r)
+		if err != nil {
+			return fmt.Errorf("failed to marshal: %w", err)
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
 }
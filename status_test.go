@@ -0,0 +1,121 @@
+package ecspresso_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aasTypes "github.com/aws/aws-sdk-go-v2/service/applicationautoscaling/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/kayac/ecspresso/v2"
+)
+
+var testServiceStatus = &ecspresso.ServiceStatus{
+	Service:        "test",
+	Cluster:        "default",
+	TaskDefinition: "test:2",
+	Deployments: []types.Deployment{
+		{
+			Id:             aws.String("ecs-svc/new"),
+			Status:         aws.String("PRIMARY"),
+			TaskDefinition: aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:2"),
+			DesiredCount:   2,
+			RunningCount:   1,
+			PendingCount:   1,
+			RolloutState:   types.DeploymentRolloutStateInProgress,
+		},
+		{
+			Id:             aws.String("ecs-svc/old"),
+			Status:         aws.String("ACTIVE"),
+			TaskDefinition: aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:1"),
+			DesiredCount:   1,
+			RunningCount:   1,
+			RolloutState:   types.DeploymentRolloutStateCompleted,
+		},
+	},
+	AutoScaling: &ecspresso.AutoScalingStatus{
+		ResourceID: "service/default/test",
+		Targets: []aasTypes.ScalableTarget{
+			{MinCapacity: aws.Int32(1), MaxCapacity: aws.Int32(4)},
+		},
+	},
+	Events: []types.ServiceEvent{
+		{Id: aws.String("e1"), CreatedAt: aws.Time(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)), Message: aws.String("has started 1 tasks")},
+	},
+}
+
+func TestServiceStatusOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		output func(*bytes.Buffer) error
+		expect string
+	}{
+		{
+			name: "json query",
+			output: func(buf *bytes.Buffer) error {
+				return testServiceStatus.OutputJSON(buf, ".deployments[] | {id, rolloutState}")
+			},
+			expect: `{
+  "id": "ecs-svc/new",
+  "rolloutState": "IN_PROGRESS"
+}
+{
+  "id": "ecs-svc/old",
+  "rolloutState": "COMPLETED"
+}
+`,
+		},
+		{
+			name: "json query string",
+			output: func(buf *bytes.Buffer) error {
+				return testServiceStatus.OutputJSON(buf, ".autoScaling.resourceId")
+			},
+			expect: "service/default/test\n",
+		},
+		{
+			name: "yaml query",
+			output: func(buf *bytes.Buffer) error {
+				return testServiceStatus.OutputYAML(buf, ".autoScaling.targets[0] | {minCapacity, maxCapacity}")
+			},
+			expect: "maxCapacity: 4\nminCapacity: 1\n",
+		},
+		{
+			name: "yaml",
+			output: func(buf *bytes.Buffer) error {
+				s := *testServiceStatus
+				s.Deployments, s.AutoScaling, s.Events = nil, nil, nil
+				return s.OutputYAML(buf, "")
+			},
+			expect: "cluster: default\nservice: test\ntaskDefinition: test:2\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tt.output(&buf); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.expect {
+				t.Errorf("unexpected output:\n%s\nexpected:\n%s", buf.String(), tt.expect)
+			}
+		})
+	}
+}
+
+func TestServiceStatusOutputJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testServiceStatus.OutputJSON(&buf, ""); err != nil {
+		t.Fatal(err)
+	}
+	var got bytes.Buffer
+	if err := testServiceStatus.OutputJSON(&got, "."); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != got.String() {
+		t.Errorf("identity query must output the same JSON:\n%s\n%s", buf.String(), got.String())
+	}
+	if !bytes.Contains(buf.Bytes(), []byte(`"taskDefinition": "test:2"`)) || !bytes.Contains(buf.Bytes(), []byte(`"runningCount": 1`)) {
+		t.Errorf("unexpected JSON: %s", buf.String())
+	}
+}
@@ -0,0 +1,213 @@
+package ecspresso
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/applicationautoscaling"
+	aasTypes "github.com/aws/aws-sdk-go-v2/service/applicationautoscaling/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/smithy-go"
+	isatty "github.com/mattn/go-isatty"
+)
+
+const (
+	statusScalingActivities = 5
+	clearScreen             = "\033[H\033[2J"
+)
+
+var isStdoutTerminal = func() bool {
+	return isatty.IsTerminal(os.Stdout.Fd()) || isatty.IsCygwinTerminal(os.Stdout.Fd())
+}
+
+// statusSection is a section of the status dashboard.
+type statusSection struct {
+	Title string
+	Lines []string
+}
+
+// statusDashboard is a snapshot of the service shown by status --watch.
+type statusDashboard struct {
+	Service        string
+	TaskDefinition string
+	Sections       []statusSection
+	Events         []types.ServiceEvent // oldest first
+}
+
+// statusDashboard collects a snapshot of the service.
+func (d *App) statusDashboard(ctx context.Context) (*statusDashboard, error) {
+	sv, err := d.DescribeService(ctx)
+	if err != nil {
+		return nil, err
+	}
+	db := &statusDashboard{
+		Service:        aws.ToString(sv.ServiceName),
+		TaskDefinition: arnToName(aws.ToString(sv.TaskDefinition)),
+	}
+
+	var lines []string
+	for _, dp := range sv.Deployments {
+		lines = append(lines, formatDeployment(dp))
+	}
+	db.Sections = append(db.Sections, statusSection{Title: "Deployments", Lines: lines})
+
+	if len(sv.TaskSets) > 0 {
+		lines = nil
+		for _, ts := range sv.TaskSets {
+			lines = append(lines, formatTaskSet(ts))
+		}
+		db.Sections = append(db.Sections, statusSection{Title: "TaskSets", Lines: lines})
+	}
+
+	as, err := d.describeAutoScaling(ctx, sv)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe autoscaling: %w", err)
+	}
+	if as != nil {
+		lines = nil
+		for _, t := range as.Targets {
+			for _, line := range strings.Split(formatScalableTarget(t), "\n") {
+				lines = append(lines, strings.TrimPrefix(line, spcIndent))
+			}
+		}
+		db.Sections = append(db.Sections, statusSection{Title: "AutoScaling", Lines: lines})
+
+		activities, err := d.describeScalingActivities(ctx, as.ResourceID)
+		if err != nil {
+			return nil, err
+		}
+		lines = nil
+		for _, a := range activities {
+			lines = append(lines, formatScalingActivity(a))
+		}
+		db.Sections = append(db.Sections, statusSection{Title: "ScalingActivities", Lines: lines})
+	}
+
+	healths, err := d.describeTargetHealth(ctx, sv)
+	if err != nil {
+		d.Log("[WARNING] %s", err)
+	} else if len(healths) > 0 {
+		lines = nil
+		for _, th := range healths {
+			lines = append(lines, th.String())
+		}
+		db.Sections = append(db.Sections, statusSection{Title: "Targets", Lines: lines})
+	}
+
+	db.Events = append(db.Events, sv.Events...)
+	sort.SliceStable(db.Events, func(i, j int) bool {
+		return aws.ToTime(db.Events[i].CreatedAt).Before(aws.ToTime(db.Events[j].CreatedAt))
+	})
+	return db, nil
+}
+
+// describeScalingActivities returns the recent scaling activities of the resource.
+func (d *App) describeScalingActivities(ctx context.Context, resourceId string) ([]aasTypes.ScalingActivity, error) {
+	out, err := d.autoScaling.DescribeScalingActivities(ctx, &applicationautoscaling.DescribeScalingActivitiesInput{
+		ResourceId:        aws.String(resourceId),
+		ServiceNamespace:  aasTypes.ServiceNamespaceEcs,
+		ScalableDimension: aasTypes.ScalableDimensionECSServiceDesiredCount,
+		MaxResults:        aws.Int32(statusScalingActivities),
+	})
+	if err != nil {
+		var oe *smithy.OperationError
+		if errors.As(err, &oe) {
+			d.Log("[WARNING] failed to describe scaling activities: %s", oe)
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to describe scaling activities: %w", err)
+	}
+	return out.ScalingActivities, nil
+}
+
+// watchStatus refreshes the status of the service until the context is canceled.
+// On a terminal, the dashboard is redrawn. Otherwise, only the changes are printed.
+func (d *App) watchStatus(ctx context.Context, opt StatusOption) error {
+	w := os.Stdout
+	tty := isStdoutTerminal()
+	var prev *statusDashboard
+	for {
+		db, err := d.statusDashboard(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if n := len(db.Events); n > opt.Events {
+			db.Events = db.Events[n-opt.Events:]
+		}
+		if tty {
+			fmt.Fprint(w, clearScreen)
+			fmt.Fprintf(w, "Every %s: ecspresso status %s\n\n", opt.Interval, time.Now().Format(EventTimeFormat))
+			db.render(w)
+		} else {
+			db.renderChanges(w, prev)
+		}
+		prev = db
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(opt.Interval):
+		}
+	}
+}
+
+func (db *statusDashboard) render(w io.Writer) {
+	fmt.Fprintln(w, "Service:", db.Service)
+	fmt.Fprintln(w, "TaskDefinition:", db.TaskDefinition)
+	for _, s := range db.Sections {
+		if len(s.Lines) == 0 {
+			continue
+		}
+		fmt.Fprintln(w, s.Title+":")
+		for _, line := range s.Lines {
+			fmt.Fprintln(w, spcIndent+line)
+		}
+	}
+	fmt.Fprintln(w, "Events:")
+	for _, e := range db.Events {
+		fmt.Fprintln(w, formatEvent(e))
+	}
+}
+
+// renderChanges prints the lines changed from the previous dashboard and the new events.
+// All lines are printed when prev is nil.
+func (db *statusDashboard) renderChanges(w io.Writer, prev *statusDashboard) {
+	now := time.Now().Format(EventTimeFormat)
+	if prev == nil || prev.TaskDefinition != db.TaskDefinition {
+		fmt.Fprintf(w, "%s TaskDefinition: %s\n", now, db.TaskDefinition)
+	}
+	prevLines := map[string]struct{}{}
+	lastEventAt := time.Time{}
+	if prev != nil {
+		for _, s := range prev.Sections {
+			for _, line := range s.Lines {
+				prevLines[s.Title+"\t"+line] = struct{}{}
+			}
+		}
+		if n := len(prev.Events); n > 0 {
+			lastEventAt = aws.ToTime(prev.Events[n-1].CreatedAt)
+		}
+	}
+	for _, s := range db.Sections {
+		for _, line := range s.Lines {
+			if _, ok := prevLines[s.Title+"\t"+line]; !ok {
+				fmt.Fprintf(w, "%s %s: %s\n", now, s.Title, line)
+			}
+		}
+	}
+	for _, e := range db.Events {
+		if prev == nil || aws.ToTime(e.CreatedAt).After(lastEventAt) {
+			fmt.Fprintln(w, formatEvent(e))
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package ecspresso_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	elbv2Types "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/google/go-cmp/cmp"
+	"github.com/kayac/ecspresso/v2"
+)
+
+const statusTgArn = "arn:aws:elasticloadbalancing:ap-northeast-1:123456789012:targetgroup/test/0123456789abcdef"
+
+// statusWatchMiddleware returns the service in progress at the first call, and completed after that.
+func statusWatchMiddleware(calls *int) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		return statusWatchStub(stack, calls)
+	}
+}
+
+func statusWatchStub(stack *middleware.Stack, calls *int) error {
+	createdAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	return stack.Initialize.Add(
+		middleware.InitializeMiddlewareFunc(
+			"test",
+			func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+				var out any
+				switch in.Parameters.(type) {
+				case *ecs.DescribeServicesInput:
+					*calls++
+					sv := types.Service{
+						ServiceName:    aws.String("test"),
+						ClusterArn:     aws.String("arn:aws:ecs:ap-northeast-1:123456789012:cluster/default"),
+						Status:         aws.String("ACTIVE"),
+						TaskDefinition: aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:2"),
+						LoadBalancers:  []types.LoadBalancer{{TargetGroupArn: aws.String(statusTgArn)}},
+						Deployments: []types.Deployment{{
+							Id:             aws.String("ecs-svc/new"),
+							Status:         aws.String("PRIMARY"),
+							TaskDefinition: aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:2"),
+							DesiredCount:   1,
+							PendingCount:   1,
+							RolloutState:   types.DeploymentRolloutStateInProgress,
+						}},
+						Events: []types.ServiceEvent{
+							{Id: aws.String("e1"), CreatedAt: aws.Time(createdAt), Message: aws.String("has started 1 tasks")},
+						},
+					}
+					if *calls > 1 {
+						sv.Deployments[0].PendingCount = 0
+						sv.Deployments[0].RunningCount = 1
+						sv.Deployments[0].RolloutState = types.DeploymentRolloutStateCompleted
+						sv.Events = append(sv.Events, types.ServiceEvent{
+							Id: aws.String("e2"), CreatedAt: aws.Time(createdAt.Add(time.Minute)), Message: aws.String("has reached a steady state"),
+						})
+					}
+					out = &ecs.DescribeServicesOutput{Services: []types.Service{sv}}
+				case *applicationautoscaling.DescribeScalableTargetsInput:
+					out = &applicationautoscaling.DescribeScalableTargetsOutput{}
+				case *ecs.ListTasksInput:
+					out = &ecs.ListTasksOutput{TaskArns: []string{"arn:aws:ecs:ap-northeast-1:123456789012:task/default/aaa"}}
+				case *ecs.DescribeTasksInput:
+					out = &ecs.DescribeTasksOutput{Tasks: []types.Task{{
+						TaskArn: aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task/default/aaa"),
+						Attachments: []types.Attachment{{
+							Type:    aws.String("ElasticNetworkInterface"),
+							Details: []types.KeyValuePair{{Name: aws.String("privateIPv4Address"), Value: aws.String("10.0.0.1")}},
+						}},
+					}}}
+				case *elasticloadbalancingv2.DescribeTargetHealthInput:
+					th := &elbv2Types.TargetHealth{State: elbv2Types.TargetHealthStateEnumInitial, Reason: elbv2Types.TargetHealthReasonEnumInitialHealthChecking, Description: aws.String("Initial health checks in progress")}
+					if *calls > 1 {
+						th = &elbv2Types.TargetHealth{State: elbv2Types.TargetHealthStateEnumHealthy}
+					}
+					out = &elasticloadbalancingv2.DescribeTargetHealthOutput{
+						TargetHealthDescriptions: []elbv2Types.TargetHealthDescription{
+							{Target: &elbv2Types.TargetDescription{Id: aws.String("10.0.0.1"), Port: aws.Int32(80)}, TargetHealth: th},
+							{Target: &elbv2Types.TargetDescription{Id: aws.String("10.0.0.9"), Port: aws.Int32(80)}, TargetHealth: &elbv2Types.TargetHealth{State: elbv2Types.TargetHealthStateEnumDraining}},
+						},
+					}
+				default:
+					return next.HandleInitialize(ctx, in)
+				}
+				return middleware.InitializeOutput{Result: out}, middleware.Metadata{}, nil
+			},
+		),
+		middleware.Before,
+	)
+}
+
+func TestStatusWatchChanges(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("AWS_REGION", "ap-northeast-1")
+	t.Setenv("TZ", "UTC")
+	var calls int
+	ecspresso.SetAWSV2ConfigLoadOptionsFunc([]func(*config.LoadOptions) error{
+		config.WithRegion("ap-northeast-1"),
+		config.WithAPIOptions([]func(*middleware.Stack) error{statusWatchMiddleware(&calls)}),
+	})
+	defer ecspresso.ResetAWSV2ConfigLoadOptionsFunc()
+	app, err := ecspresso.New(ctx, &ecspresso.CLIOptions{ConfigFilePath: "tests/ecspresso.yml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := app.StatusDashboard(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	first.RenderChanges(&buf, nil)
+	expected := []string{
+		"TaskDefinition: test:2",
+		"Deployments:  PRIMARY test:2 desired:1 pending:1 running:0 IN_PROGRESS()",
+		"Targets: test aaa 10.0.0.1:80 initial Elb.InitialHealthChecking(Initial health checks in progress)",
+		"Targets: test - 10.0.0.9:80 draining",
+		"has started 1 tasks",
+	}
+	if diff := cmp.Diff(expected, trimTimestamps(buf.String())); diff != "" {
+		t.Errorf("unexpected first output: %s", diff)
+	}
+
+	second, err := app.StatusDashboard(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	second.RenderChanges(&buf, first)
+	expected = []string{
+		"Deployments:  PRIMARY test:2 desired:1 pending:0 running:1 COMPLETED()",
+		"Targets: test aaa 10.0.0.1:80 healthy",
+		"has reached a steady state",
+	}
+	if diff := cmp.Diff(expected, trimTimestamps(buf.String())); diff != "" {
+		t.Errorf("unexpected changes: %s", diff)
+	}
+}
+
+// trimTimestamps removes the leading "2006/01/02 15:04:05 " of the lines.
+func trimTimestamps(s string) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(s), "\n") {
+		lines = append(lines, line[len(ecspresso.EventTimeFormat)+1:])
+	}
+	return lines
+}
@@ -0,0 +1,273 @@
+package ecspresso
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+const (
+	envGitHubStepSummary = "GITHUB_STEP_SUMMARY"
+	envGitHubOutput      = "GITHUB_OUTPUT"
+)
+
+// stepSummary writes Markdown reports to the job summary file and key values to the step outputs.
+// The files are compatible with GITHUB_STEP_SUMMARY and GITHUB_OUTPUT of GitHub Actions.
+type stepSummary struct {
+	path       string
+	outputPath string
+}
+
+func newStepSummary(path, outputPath string) *stepSummary {
+	if path == "" && outputPath == "" {
+		return nil
+	}
+	return &stepSummary{path: path, outputPath: outputPath}
+}
+
+func appendFile(path string, s string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, CreateFileMode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.WriteString(s)
+	return err
+}
+
+func (s *stepSummary) write(markdown string) error {
+	if s == nil || s.path == "" {
+		return nil
+	}
+	if err := appendFile(s.path, markdown); err != nil {
+		return fmt.Errorf("failed to write summary file %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// setOutputs writes the key values as the step outputs. Empty values are skipped.
+func (s *stepSummary) setOutputs(outputs map[string]string) error {
+	if s == nil || s.outputPath == "" {
+		return nil
+	}
+	keys := make([]string, 0, len(outputs))
+	for k, v := range outputs {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s=%s\n", k, outputs[k])
+	}
+	if err := appendFile(s.outputPath, b.String()); err != nil {
+		return fmt.Errorf("failed to write output file %s: %w", s.outputPath, err)
+	}
+	return nil
+}
+
+func markdownCodeBlock(lang, s string) string {
+	return "```" + lang + "\n" + strings.TrimRight(s, "\n") + "\n```\n"
+}
+
+func markdownDiffSection(title, ds string) string {
+	if ds == "" {
+		return ""
+	}
+	return "### " + title + "\n\n" + markdownCodeBlock("diff", ds) + "\n"
+}
+
+func (d *App) summaryTitle(operation string) string {
+	return fmt.Sprintf("## ecspresso %s: %s/%s\n\n", operation, d.Cluster, d.Service)
+}
+
+func (d *App) writeSummary(markdown string) {
+	if err := d.summary.write(markdown); err != nil {
+		d.Log("[WARNING] %s", err)
+	}
+}
+
+func (d *App) setOutputs(outputs map[string]string) {
+	if err := d.summary.setOutputs(outputs); err != nil {
+		d.Log("[WARNING] %s", err)
+	}
+}
+
+// summarizeDiff writes the diff report.
+func (d *App) summarizeDiff(serviceDiff, taskDefinitionDiff string) {
+	if d.summary == nil {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(d.summaryTitle("diff"))
+	if serviceDiff == "" && taskDefinitionDiff == "" {
+		b.WriteString("No differences.\n\n")
+	}
+	b.WriteString(markdownDiffSection("Service definition", serviceDiff))
+	b.WriteString(markdownDiffSection("Task definition", taskDefinitionDiff))
+	d.writeSummary(b.String())
+}
+
+// summarizeVerify writes the verify report.
+func (d *App) summarizeVerify(tree []string, err error) {
+	if d.summary == nil {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(d.summaryTitle("verify"))
+	if err != nil {
+		fmt.Fprintf(&b, ":x: **NG** %s\n\n", err)
+	} else {
+		b.WriteString(":white_check_mark: **OK**\n\n")
+	}
+	b.WriteString(markdownCodeBlock("", strings.Join(tree, "\n")))
+	d.writeSummary(b.String())
+}
+
+// deploymentReport represents values collected while deploying or rolling back for the summary.
+type deploymentReport struct {
+	Operation                 string
+	TaskDefinitionArn         string
+	PreviousTaskDefinitionArn string
+	ServiceDiff               string
+}
+
+// newDeploymentReport returns a new report. It returns nil when the summary is not enabled.
+func (d *App) newDeploymentReport(operation string) *deploymentReport {
+	if d.summary == nil {
+		return nil
+	}
+	return &deploymentReport{Operation: operation}
+}
+
+type imageChange struct {
+	Container string
+	Old       string
+	New       string
+}
+
+func imageChanges(oldTd, newTd *TaskDefinitionInput) []imageChange {
+	images := map[string]*imageChange{}
+	var names []string
+	get := func(name string) *imageChange {
+		if c, ok := images[name]; ok {
+			return c
+		}
+		c := &imageChange{Container: name}
+		images[name] = c
+		names = append(names, name)
+		return c
+	}
+	if oldTd != nil {
+		for _, c := range oldTd.ContainerDefinitions {
+			get(aws.ToString(c.Name)).Old = aws.ToString(c.Image)
+		}
+	}
+	if newTd != nil {
+		for _, c := range newTd.ContainerDefinitions {
+			get(aws.ToString(c.Name)).New = aws.ToString(c.Image)
+		}
+	}
+	var changes []imageChange
+	for _, name := range names {
+		if c := images[name]; c.Old != c.New {
+			changes = append(changes, *c)
+		}
+	}
+	return changes
+}
+
+func markdownCode(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return "`" + s + "`"
+}
+
+func (d *App) describeTaskDefinitionPair(ctx context.Context, oldArn, newArn string) (*TaskDefinitionInput, *TaskDefinitionInput, error) {
+	oldTd, err := d.DescribeTaskDefinition(ctx, oldArn)
+	if err != nil {
+		return nil, nil, err
+	}
+	newTd, err := d.DescribeTaskDefinition(ctx, newArn)
+	if err != nil {
+		return nil, nil, err
+	}
+	return oldTd, newTd, nil
+}
+
+// writeDeploymentReport writes the report of deploy or rollback and sets the step outputs.
+func (d *App) writeDeploymentReport(ctx context.Context, r *deploymentReport, err error) {
+	if r == nil {
+		return
+	}
+	var deploymentID string
+	if n := notificationOf(ctx); n != nil {
+		deploymentID = n.DeploymentID // CodeDeploy
+	}
+
+	// the context of the operation may be canceled already
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if sv, serr := d.DescribeService(ctx); serr == nil {
+		if r.TaskDefinitionArn == "" && err == nil {
+			// rollback does not know the task definition rolled back to
+			r.TaskDefinitionArn = aws.ToString(sv.TaskDefinition)
+		}
+		for _, dp := range sv.Deployments {
+			if aws.ToString(dp.Status) == "PRIMARY" && deploymentID == "" {
+				deploymentID = aws.ToString(dp.Id)
+			}
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(d.summaryTitle(r.Operation))
+	var e ErrRolledBack
+	switch {
+	case err == nil:
+		b.WriteString(":white_check_mark: **Succeeded**\n\n")
+	case errors.As(err, &e):
+		fmt.Fprintf(&b, ":leftwards_arrow_with_hook: **Rolled back** %s\n\n", err)
+	default:
+		fmt.Fprintf(&b, ":x: **Failed** %s\n\n", err)
+	}
+	b.WriteString("| | Task definition |\n|---|---|\n")
+	fmt.Fprintf(&b, "| Old | %s |\n", markdownCode(arnToName(r.PreviousTaskDefinitionArn)))
+	fmt.Fprintf(&b, "| New | %s |\n\n", markdownCode(arnToName(r.TaskDefinitionArn)))
+
+	var tdDiff string
+	if r.TaskDefinitionArn != "" && r.PreviousTaskDefinitionArn != "" && r.TaskDefinitionArn != r.PreviousTaskDefinitionArn {
+		oldTd, newTd, derr := d.describeTaskDefinitionPair(ctx, r.PreviousTaskDefinitionArn, r.TaskDefinitionArn)
+		if derr != nil {
+			d.Log("[WARNING] failed to describe task definitions for the summary: %s", derr)
+		} else {
+			if changes := imageChanges(oldTd, newTd); len(changes) > 0 {
+				b.WriteString("### Image changes\n\n| Container | Old | New |\n|---|---|---|\n")
+				for _, c := range changes {
+					fmt.Fprintf(&b, "| %s | %s | %s |\n", c.Container, markdownCode(c.Old), markdownCode(c.New))
+				}
+				b.WriteString("\n")
+			}
+			if tdDiff, derr = diffTaskDefs(newTd, oldTd, r.TaskDefinitionArn, r.PreviousTaskDefinitionArn, true); derr != nil {
+				d.Log("[WARNING] %s", derr)
+			}
+		}
+	}
+	b.WriteString(markdownDiffSection("Service definition", r.ServiceDiff))
+	b.WriteString(markdownDiffSection("Task definition", tdDiff))
+	d.writeSummary(b.String())
+
+	d.setOutputs(map[string]string{
+		"task_definition_arn":          r.TaskDefinitionArn,
+		"previous_task_definition_arn": r.PreviousTaskDefinitionArn,
+		"deployment_id":                deploymentID,
+	})
+}
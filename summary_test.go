@@ -0,0 +1,94 @@
+package ecspresso_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/google/go-cmp/cmp"
+	"github.com/kayac/ecspresso/v2"
+)
+
+func TestStepSummary(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("AWS_REGION", "ap-northeast-1")
+	dir := t.TempDir()
+	summaryFile := filepath.Join(dir, "summary.md")
+	outputFile := filepath.Join(dir, "output")
+	app, err := ecspresso.New(ctx, &ecspresso.CLIOptions{ConfigFilePath: "tests/ecspresso.yml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.SetSummary(summaryFile, outputFile)
+
+	app.SummarizeDiff("--- remote\n+++ local\n-a\n+b\n", "")
+	app.SummarizeVerify([]string{
+		"  TaskDefinition",
+		"    ExecutionRole[ecsTaskExecutionRole]",
+		"    --> [OK]",
+		"  --> [NG] container app is not found",
+	}, errors.New("verify TaskDefinition failed"))
+	app.SetOutputs(map[string]string{
+		"task_definition_arn":          "arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:2",
+		"previous_task_definition_arn": "",
+		"deployment_id":                "ecs-svc/123",
+	})
+
+	b, err := os.ReadFile(summaryFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedSummary := "## ecspresso diff: default/test\n\n" +
+		"### Service definition\n\n" +
+		"```diff\n--- remote\n+++ local\n-a\n+b\n```\n\n" +
+		"## ecspresso verify: default/test\n\n" +
+		":x: **NG** verify TaskDefinition failed\n\n" +
+		"```\n" +
+		"  TaskDefinition\n" +
+		"    ExecutionRole[ecsTaskExecutionRole]\n" +
+		"    --> [OK]\n" +
+		"  --> [NG] container app is not found\n" +
+		"```\n"
+	if diff := cmp.Diff(expectedSummary, string(b)); diff != "" {
+		t.Errorf("unexpected summary: %s", diff)
+	}
+
+	b, err = os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedOutput := "deployment_id=ecs-svc/123\n" +
+		"task_definition_arn=arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:2\n"
+	if diff := cmp.Diff(expectedOutput, string(b)); diff != "" {
+		t.Errorf("unexpected output: %s", diff)
+	}
+}
+
+func TestImageChanges(t *testing.T) {
+	oldTd := &ecspresso.TaskDefinitionInput{
+		ContainerDefinitions: []types.ContainerDefinition{
+			{Name: aws.String("app"), Image: aws.String("app:v1")},
+			{Name: aws.String("nginx"), Image: aws.String("nginx:1.25")},
+			{Name: aws.String("old"), Image: aws.String("old:latest")},
+		},
+	}
+	newTd := &ecspresso.TaskDefinitionInput{
+		ContainerDefinitions: []types.ContainerDefinition{
+			{Name: aws.String("app"), Image: aws.String("app:v2")},
+			{Name: aws.String("nginx"), Image: aws.String("nginx:1.25")},
+			{Name: aws.String("sidecar"), Image: aws.String("sidecar:latest")},
+		},
+	}
+	expected := []ecspresso.ImageChange{
+		{Container: "app", Old: "app:v1", New: "app:v2"},
+		{Container: "old", Old: "old:latest"},
+		{Container: "sidecar", New: "sidecar:latest"},
+	}
+	if diff := cmp.Diff(expected, ecspresso.ImageChanges(oldTd, newTd)); diff != "" {
+		t.Errorf("unexpected image changes: %s", diff)
+	}
+}
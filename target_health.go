@@ -0,0 +1,187 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+)
+
+// TargetHealth represents a health state of a target in the target groups of the service.
+type TargetHealth struct {
+	TargetGroupArn string `json:"targetGroupArn"`
+	TargetID       string `json:"targetId"`
+	Port           int32  `json:"port"`
+	TaskID         string `json:"taskId,omitempty"` // empty when the target is not a task of the service
+	State          string `json:"state"`
+	Reason         string `json:"reason,omitempty"`
+	Description    string `json:"description,omitempty"`
+}
+
+func (t TargetHealth) target() string {
+	return fmt.Sprintf("%s:%d", t.TargetID, t.Port)
+}
+
+func (t TargetHealth) String() string {
+	task := t.TaskID
+	if task == "" {
+		task = "-"
+	}
+	s := fmt.Sprintf("%s %s %s %s", targetGroupName(t.TargetGroupArn), task, t.target(), t.State)
+	if t.Reason != "" {
+		s += fmt.Sprintf(" %s(%s)", t.Reason, t.Description)
+	}
+	return s
+}
+
+// targetGroupName returns the name of the target group from the ARN (arn:...:targetgroup/name/id).
+func targetGroupName(arn string) string {
+	p := strings.Split(arn, "/")
+	if len(p) < 3 {
+		return arn
+	}
+	return p[len(p)-2]
+}
+
+// describeTargetHealth returns the health of the targets in the target groups of the service.
+// The targets are associated with the running tasks of the service by the IP address (awsvpc)
+// or the EC2 instance and the host port (bridge and host).
+func (d *App) describeTargetHealth(ctx context.Context, sv *Service) ([]TargetHealth, error) {
+	var tgArns []string
+	for _, lb := range sv.LoadBalancers {
+		if arn := aws.ToString(lb.TargetGroupArn); arn != "" {
+			tgArns = append(tgArns, arn)
+		}
+	}
+	if len(tgArns) == 0 {
+		return nil, nil
+	}
+	tasks, err := d.targetTasks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var healths []TargetHealth
+	for _, tgArn := range tgArns {
+		out, err := d.elbv2.DescribeTargetHealth(ctx, &elasticloadbalancingv2.DescribeTargetHealthInput{
+			TargetGroupArn: aws.String(tgArn),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe target health of %s: %w", targetGroupName(tgArn), err)
+		}
+		for _, desc := range out.TargetHealthDescriptions {
+			th := TargetHealth{TargetGroupArn: tgArn}
+			if t := desc.Target; t != nil {
+				th.TargetID = aws.ToString(t.Id)
+				th.Port = aws.ToInt32(t.Port)
+			}
+			if h := desc.TargetHealth; h != nil {
+				th.State = string(h.State)
+				th.Reason = string(h.Reason)
+				th.Description = aws.ToString(h.Description)
+			}
+			if id, ok := tasks[th.TargetID]; ok {
+				th.TaskID = id
+			} else if id, ok := tasks[th.target()]; ok {
+				th.TaskID = id
+			}
+			healths = append(healths, th)
+		}
+	}
+	return healths, nil
+}
+
+// targetTasks returns the IDs of the running tasks of the service keyed by the IP address or "EC2 instance ID:host port".
+func (d *App) targetTasks(ctx context.Context) (map[string]string, error) {
+	tasks := map[string]string{}
+	lt, err := d.ecs.ListTasks(ctx, &ecs.ListTasksInput{
+		Cluster:     aws.String(d.Cluster),
+		ServiceName: aws.String(d.Service),
+		MaxResults:  aws.Int32(100),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tasks: %w", err)
+	}
+	if len(lt.TaskArns) == 0 {
+		return tasks, nil
+	}
+	out, err := d.ecs.DescribeTasks(ctx, &ecs.DescribeTasksInput{
+		Cluster: aws.String(d.Cluster),
+		Tasks:   lt.TaskArns,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe tasks: %w", err)
+	}
+
+	byInstance := map[string][]types.Task{}
+	for _, task := range out.Tasks {
+		id := arnToName(aws.ToString(task.TaskArn))
+		for _, at := range task.Attachments {
+			for _, kv := range at.Details {
+				if aws.ToString(kv.Name) == "privateIPv4Address" {
+					tasks[aws.ToString(kv.Value)] = id
+				}
+			}
+		}
+		if arn := aws.ToString(task.ContainerInstanceArn); arn != "" {
+			byInstance[arn] = append(byInstance[arn], task)
+		}
+	}
+	if len(byInstance) == 0 {
+		return tasks, nil
+	}
+	arns := make([]string, 0, len(byInstance))
+	for arn := range byInstance {
+		arns = append(arns, arn)
+	}
+	ci, err := d.ecs.DescribeContainerInstances(ctx, &ecs.DescribeContainerInstancesInput{
+		Cluster:            aws.String(d.Cluster),
+		ContainerInstances: arns,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe container instances: %w", err)
+	}
+	for _, inst := range ci.ContainerInstances {
+		for _, task := range byInstance[aws.ToString(inst.ContainerInstanceArn)] {
+			for _, c := range task.Containers {
+				for _, nb := range c.NetworkBindings {
+					key := fmt.Sprintf("%s:%d", aws.ToString(inst.Ec2InstanceId), aws.ToInt32(nb.HostPort))
+					tasks[key] = arnToName(aws.ToString(task.TaskArn))
+				}
+			}
+		}
+	}
+	return tasks, nil
+}
+
+// showTargetHealth shows the targets whose health state or reason changed from the last time.
+// states holds the last states keyed by the target group and the target.
+func (d *App) showTargetHealth(ctx context.Context, sv *Service, states map[string]string) error {
+	healths, err := d.describeTargetHealth(ctx, sv)
+	if err != nil {
+		return err
+	}
+	current := make(map[string]string, len(healths))
+	for _, th := range healths {
+		key := th.TargetGroupArn + "\t" + th.target()
+		state := th.State + "\t" + th.Reason
+		current[key] = state
+		if states[key] == state {
+			continue
+		}
+		d.Log("Target %s", th)
+		d.emitEvent(targetHealthEvent(th))
+	}
+	for key := range states {
+		if _, ok := current[key]; !ok {
+			delete(states, key)
+		}
+	}
+	for key, state := range current {
+		states[key] = state
+	}
+	return nil
+}
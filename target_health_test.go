@@ -0,0 +1,69 @@
+package ecspresso_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/google/go-cmp/cmp"
+	"github.com/kayac/ecspresso/v2"
+)
+
+func TestShowTargetHealth(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("AWS_REGION", "ap-northeast-1")
+	var calls int
+	ecspresso.SetAWSV2ConfigLoadOptionsFunc([]func(*config.LoadOptions) error{
+		config.WithRegion("ap-northeast-1"),
+		config.WithAPIOptions([]func(*middleware.Stack) error{statusWatchMiddleware(&calls)}),
+	})
+	defer ecspresso.ResetAWSV2ConfigLoadOptionsFunc()
+	app, err := ecspresso.New(ctx, &ecspresso.CLIOptions{ConfigFilePath: "tests/ecspresso.yml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	app.SetEventsOutput(&buf)
+
+	sv := &ecspresso.Service{}
+	sv.LoadBalancers = []types.LoadBalancer{{TargetGroupArn: aws.String(statusTgArn)}}
+	states := map[string]string{}
+
+	// the stub returns the initial state of the target while calls <= 1
+	steps := []struct {
+		calls  int
+		expect []map[string]any
+	}{
+		{
+			calls: 1,
+			expect: []map[string]any{
+				{"type": "target_health", "cluster": "default", "service": "test", "target_group_arn": statusTgArn, "target": "10.0.0.1:80", "task_id": "aaa", "status": "initial", "reason": "Elb.InitialHealthChecking", "message": "Initial health checks in progress"},
+				{"type": "target_health", "cluster": "default", "service": "test", "target_group_arn": statusTgArn, "target": "10.0.0.9:80", "status": "draining"},
+			},
+		},
+		{
+			calls:  1,
+			expect: nil, // not changed
+		},
+		{
+			calls: 2,
+			expect: []map[string]any{
+				{"type": "target_health", "cluster": "default", "service": "test", "target_group_arn": statusTgArn, "target": "10.0.0.1:80", "task_id": "aaa", "status": "healthy"},
+			},
+		},
+	}
+	for i, step := range steps {
+		calls = step.calls
+		buf.Reset()
+		if err := app.ShowTargetHealth(ctx, sv, states); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(step.expect, decodeEvents(t, &buf)); diff != "" {
+			t.Errorf("unexpected events at step %d: %s", i, diff)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+const (
+	taskSetStatusPrimary  = "PRIMARY"
+	taskSetStatusActive   = "ACTIVE"
+	taskSetStatusDraining = "DRAINING"
+)
+
+var taskSetCheckInterval = 10 * time.Second
+
+func (sv *Service) isExternal() bool {
+	return sv.DeploymentController != nil && sv.DeploymentController.Type == types.DeploymentControllerTypeExternal
+}
+
+// primaryTaskSet returns the PRIMARY task set of the service.
+func (sv *Service) primaryTaskSet() *types.TaskSet {
+	for _, ts := range sv.TaskSets {
+		if aws.ToString(ts.Status) == taskSetStatusPrimary {
+			ts := ts
+			return &ts
+		}
+	}
+	return nil
+}
+
+// applyPrimaryTaskSet copies the attributes held by the PRIMARY task set to the service.
+// A service with the EXTERNAL deployment controller does not have them by itself.
+func (sv *Service) applyPrimaryTaskSet() {
+	ts := sv.primaryTaskSet()
+	if ts == nil {
+		return
+	}
+	sv.TaskDefinition = ts.TaskDefinition
+	sv.LaunchType = ts.LaunchType
+	sv.CapacityProviderStrategy = ts.CapacityProviderStrategy
+	sv.PlatformVersion = ts.PlatformVersion
+	sv.NetworkConfiguration = ts.NetworkConfiguration
+	sv.LoadBalancers = ts.LoadBalancers
+	sv.ServiceRegistries = ts.ServiceRegistries
+}
+
+// DeployByTaskSet deploys the task definition to the service with the EXTERNAL deployment controller.
+func (d *App) DeployByTaskSet(ctx context.Context, taskDefinitionArn string, count *int32, sv *Service, opt DeployOption) error {
+	if count != nil {
+		d.Log("updating desired count to %d", *count)
+		if _, err := d.ecs.UpdateService(ctx, &ecs.UpdateServiceInput{
+			Service:      aws.String(d.Service),
+			Cluster:      aws.String(d.Cluster),
+			DesiredCount: count,
+		}); err != nil {
+			return fmt.Errorf("failed to update service: %w", err)
+		}
+	}
+	if opt.SkipTaskDefinition && !opt.UpdateService && !opt.ForceNewDeployment {
+		// no need to create a new task set.
+		return nil
+	}
+	return d.shiftTaskSet(ctx, sv, taskDefinitionArn, opt.ForceNewDeployment, opt.Wait)
+}
+
+// shiftTaskSet makes the task set running the task definition PRIMARY.
+// The task set is created when it does not exist (or forceNew is true), and scaled to 100% when it was scaled in.
+// When wait is true, it waits for the task set to be stable before shifting, and deletes the other task sets after that.
+func (d *App) shiftTaskSet(ctx context.Context, sv *Service, taskDefinitionArn string, forceNew bool, wait bool) (err error) {
+	ctx, span := startSpan(ctx, "shift task set", d.spanAttributes()...)
+	defer func() { endSpan(span, err) }()
+
+	current, err := d.DescribeService(ctx)
+	if err != nil {
+		return err
+	}
+	var target *types.TaskSet
+	if !forceNew {
+		for _, ts := range current.TaskSets {
+			if aws.ToString(ts.TaskDefinition) == taskDefinitionArn && aws.ToString(ts.Status) != taskSetStatusDraining {
+				ts := ts
+				target = &ts
+				break
+			}
+		}
+	}
+
+	if target == nil {
+		if target, err = d.createTaskSet(ctx, sv, current, taskDefinitionArn); err != nil {
+			return err
+		}
+	} else if target.Scale == nil || target.Scale.Unit != types.ScaleUnitPercent || target.Scale.Value < 100 {
+		d.Log("Scaling the task set %s to 100%%", aws.ToString(target.Id))
+		out, err := d.ecs.UpdateTaskSet(ctx, &ecs.UpdateTaskSetInput{
+			Cluster: aws.String(d.Cluster),
+			Service: aws.String(d.Service),
+			TaskSet: target.TaskSetArn,
+			Scale:   &types.Scale{Unit: types.ScaleUnitPercent, Value: 100},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update task set: %w", err)
+		}
+		target = out.TaskSet
+	}
+
+	if wait {
+		if err := d.waitTaskSetSteady(ctx, target); err != nil {
+			return err
+		}
+	}
+
+	if aws.ToString(target.Status) != taskSetStatusPrimary {
+		d.Log("Updating the primary task set to %s", aws.ToString(target.Id))
+		if _, err := d.ecs.UpdateServicePrimaryTaskSet(ctx, &ecs.UpdateServicePrimaryTaskSetInput{
+			Cluster:        aws.String(d.Cluster),
+			Service:        aws.String(d.Service),
+			PrimaryTaskSet: target.TaskSetArn,
+		}); err != nil {
+			return fmt.Errorf("failed to update primary task set: %w", err)
+		}
+		d.emitPhase("update_primary_task_set", phaseStatusCompleted, nil)
+	}
+
+	if !wait {
+		if len(current.TaskSets) > 0 {
+			d.Log("[INFO] the previous task sets are not deleted without waiting for the new task set stable")
+		}
+		return nil
+	}
+	return d.deleteTaskSets(ctx, current.TaskSets, aws.ToString(target.TaskSetArn))
+}
+
+func (d *App) createTaskSet(ctx context.Context, sv *Service, current *Service, taskDefinitionArn string) (*types.TaskSet, error) {
+	in := &ecs.CreateTaskSetInput{
+		Cluster:        aws.String(d.Cluster),
+		Service:        aws.String(d.Service),
+		TaskDefinition: aws.String(taskDefinitionArn),
+		Scale:          &types.Scale{Unit: types.ScaleUnitPercent, Value: 100},
+	}
+	// the attributes of the task set are inherited from the primary task set,
+	// and overridden by the service definition.
+	if ts := current.primaryTaskSet(); ts != nil {
+		in.LaunchType = ts.LaunchType
+		in.CapacityProviderStrategy = ts.CapacityProviderStrategy
+		in.PlatformVersion = ts.PlatformVersion
+		in.NetworkConfiguration = ts.NetworkConfiguration
+		in.LoadBalancers = ts.LoadBalancers
+		in.ServiceRegistries = ts.ServiceRegistries
+	}
+	if sv != nil {
+		if sv.LaunchType != "" {
+			in.LaunchType = sv.LaunchType
+		}
+		if len(sv.CapacityProviderStrategy) > 0 {
+			in.CapacityProviderStrategy = sv.CapacityProviderStrategy
+			in.LaunchType = ""
+		}
+		if sv.PlatformVersion != nil {
+			in.PlatformVersion = sv.PlatformVersion
+		}
+		if sv.NetworkConfiguration != nil {
+			in.NetworkConfiguration = sv.NetworkConfiguration
+		}
+		if len(sv.LoadBalancers) > 0 {
+			in.LoadBalancers = sv.LoadBalancers
+		}
+		if len(sv.ServiceRegistries) > 0 {
+			in.ServiceRegistries = sv.ServiceRegistries
+		}
+	}
+	d.Log("Creating a new task set with %s", arnToName(taskDefinitionArn))
+	d.LogJSON(in)
+	out, err := d.ecs.CreateTaskSet(ctx, in)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create task set: %w", err)
+	}
+	d.Log("Task set %s is created", aws.ToString(out.TaskSet.Id))
+	d.emitEvent(&OutputEvent{
+		Type:   OutputEventTypePhase,
+		Phase:  "create_task_set",
+		Status: phaseStatusCompleted,
+		ID:     aws.ToString(out.TaskSet.Id),
+	})
+	return out.TaskSet, nil
+}
+
+// waitTaskSetSteady waits for the task set to reach STEADY_STATE.
+func (d *App) waitTaskSetSteady(ctx context.Context, ts *types.TaskSet) (err error) {
+	id := aws.ToString(ts.Id)
+	ctx, span := startSpan(ctx, "wait for task set steady", d.spanAttributes()...)
+	defer func() { endSpan(span, err) }()
+	d.Log("Waiting for the task set %s stable", id)
+	var prev types.StabilityStatus
+	for {
+		out, err := d.ecs.DescribeTaskSets(ctx, &ecs.DescribeTaskSetsInput{
+			Cluster:  aws.String(d.Cluster),
+			Service:  aws.String(d.Service),
+			TaskSets: []string{aws.ToString(ts.TaskSetArn)},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to describe task sets: %w", err)
+		}
+		if len(out.TaskSets) == 0 {
+			return ErrNotFound(fmt.Sprintf("task set %s is not found", id))
+		}
+		cur := out.TaskSets[0]
+		if cur.StabilityStatus != prev {
+			d.Log("Task set %s: %s running=%d pending=%d computedDesired=%d",
+				id, cur.StabilityStatus, cur.RunningCount, cur.PendingCount, cur.ComputedDesiredCount)
+			prev = cur.StabilityStatus
+		}
+		if cur.StabilityStatus == types.StabilityStatusSteadyState {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to wait for task set %s stable: %w", id, ctx.Err())
+		case <-time.After(taskSetCheckInterval):
+		}
+	}
+}
+
+// deleteTaskSets deletes the task sets except the one to keep.
+func (d *App) deleteTaskSets(ctx context.Context, taskSets []types.TaskSet, keepArn string) error {
+	for _, ts := range taskSets {
+		if aws.ToString(ts.TaskSetArn) == keepArn || aws.ToString(ts.Status) == taskSetStatusDraining {
+			continue
+		}
+		d.Log("Deleting the task set %s (%s)", aws.ToString(ts.Id), arnToName(aws.ToString(ts.TaskDefinition)))
+		if _, err := d.ecs.DeleteTaskSet(ctx, &ecs.DeleteTaskSetInput{
+			Cluster: aws.String(d.Cluster),
+			Service: aws.String(d.Service),
+			TaskSet: ts.TaskSetArn,
+		}); err != nil {
+			return fmt.Errorf("failed to delete task set %s: %w", aws.ToString(ts.Id), err)
+		}
+	}
+	return nil
+}
+
+// RollbackByTaskSet rolls back the service with the EXTERNAL deployment controller by re-promoting the previous task set.
+// When the previous task set does not exist, a new task set is created with the previous task definition.
+func (d *App) RollbackByTaskSet(ctx context.Context, sv *Service, opt RollbackOption) (string, error) {
+	primary := sv.primaryTaskSet()
+	if primary == nil {
+		return "", ErrNotFound("primary task set is not found")
+	}
+	currentArn := aws.ToString(primary.TaskDefinition)
+
+	var targetArn string
+	if prev := previousTaskSet(sv.TaskSets); prev != nil && !opt.hasTarget() {
+		d.Log("previous task set %s is found", aws.ToString(prev.Id))
+		targetArn = aws.ToString(prev.TaskDefinition)
+	} else {
+		arn, err := d.rollbackTarget(ctx, sv, currentArn, opt)
+		if err != nil {
+			return "", err
+		}
+		targetArn = arn
+	}
+	if err := d.rollbackTaskSetTo(ctx, sv, targetArn, opt); err != nil {
+		return "", err
+	}
+	return currentArn, nil
+}
+
+func (d *App) rollbackTaskSetTo(ctx context.Context, sv *Service, targetArn string, opt RollbackOption) error {
+	d.Log("Rolling back to %s %s", arnToName(targetArn), opt.DryRunString())
+	if opt.DryRun {
+		return nil
+	}
+	return d.shiftTaskSet(ctx, sv, targetArn, false, opt.Wait)
+}
+
+// previousTaskSet returns the latest ACTIVE task set.
+func previousTaskSet(taskSets []types.TaskSet) *types.TaskSet {
+	var actives []types.TaskSet
+	for _, ts := range taskSets {
+		if aws.ToString(ts.Status) == taskSetStatusActive {
+			actives = append(actives, ts)
+		}
+	}
+	if len(actives) == 0 {
+		return nil
+	}
+	sort.SliceStable(actives, func(i, j int) bool {
+		return aws.ToTime(actives[i].CreatedAt).After(aws.ToTime(actives[j].CreatedAt))
+	})
+	return &actives[0]
+}
@@ -0,0 +1,236 @@
+package ecspresso_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/google/go-cmp/cmp"
+	"github.com/kayac/ecspresso/v2"
+)
+
+const tasksetTdArnFmt = "arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:%d"
+
+// fakeTaskSets is a stand-in of ECS API for a service with the EXTERNAL deployment controller.
+type fakeTaskSets struct {
+	taskSets []types.TaskSet
+	calls    []string
+	created  *ecs.CreateTaskSetInput
+	seq      int
+}
+
+func (f *fakeTaskSets) addTaskSet(status string, rev int, stability types.StabilityStatus) *types.TaskSet {
+	f.seq++
+	id := fmt.Sprintf("ecs-svc/%d", f.seq)
+	f.taskSets = append(f.taskSets, types.TaskSet{
+		Id:              aws.String(id),
+		TaskSetArn:      aws.String("arn:aws:ecs:ap-northeast-1:123456789012:task-set/default/test/" + id),
+		Status:          aws.String(status),
+		TaskDefinition:  aws.String(fmt.Sprintf(tasksetTdArnFmt, rev)),
+		StabilityStatus: stability,
+		Scale:           &types.Scale{Unit: types.ScaleUnitPercent, Value: 100},
+		CreatedAt:       aws.Time(time.Unix(int64(f.seq), 0)),
+		NetworkConfiguration: &types.NetworkConfiguration{
+			AwsvpcConfiguration: &types.AwsVpcConfiguration{Subnets: []string{"subnet-1"}},
+		},
+	})
+	return &f.taskSets[len(f.taskSets)-1]
+}
+
+func (f *fakeTaskSets) find(arn string) *types.TaskSet {
+	for i := range f.taskSets {
+		if aws.ToString(f.taskSets[i].TaskSetArn) == arn {
+			return &f.taskSets[i]
+		}
+	}
+	return nil
+}
+
+func (f *fakeTaskSets) handle(params any) (any, bool) {
+	switch in := params.(type) {
+	case *ecs.DescribeServicesInput:
+		f.calls = append(f.calls, "DescribeServices")
+		return &ecs.DescribeServicesOutput{
+			Services: []types.Service{{
+				ServiceName:          aws.String("test"),
+				Status:               aws.String("ACTIVE"),
+				DeploymentController: &types.DeploymentController{Type: types.DeploymentControllerTypeExternal},
+				TaskSets:             append([]types.TaskSet{}, f.taskSets...),
+			}},
+		}, true
+	case *ecs.CreateTaskSetInput:
+		f.calls = append(f.calls, "CreateTaskSet")
+		f.created = in
+		var rev int
+		fmt.Sscanf(aws.ToString(in.TaskDefinition), tasksetTdArnFmt, &rev)
+		ts := f.addTaskSet("ACTIVE", rev, types.StabilityStatusStabilizing)
+		return &ecs.CreateTaskSetOutput{TaskSet: ts}, true
+	case *ecs.DescribeTaskSetsInput:
+		f.calls = append(f.calls, "DescribeTaskSets")
+		out := &ecs.DescribeTaskSetsOutput{}
+		for _, arn := range in.TaskSets {
+			if ts := f.find(arn); ts != nil {
+				out.TaskSets = append(out.TaskSets, *ts)
+				ts.StabilityStatus = types.StabilityStatusSteadyState // stable at the next call
+			}
+		}
+		return out, true
+	case *ecs.UpdateTaskSetInput:
+		f.calls = append(f.calls, "UpdateTaskSet")
+		ts := f.find(aws.ToString(in.TaskSet))
+		ts.Scale = in.Scale
+		return &ecs.UpdateTaskSetOutput{TaskSet: ts}, true
+	case *ecs.UpdateServicePrimaryTaskSetInput:
+		f.calls = append(f.calls, "UpdateServicePrimaryTaskSet")
+		for i := range f.taskSets {
+			if aws.ToString(f.taskSets[i].TaskSetArn) == aws.ToString(in.PrimaryTaskSet) {
+				f.taskSets[i].Status = aws.String("PRIMARY")
+			} else {
+				f.taskSets[i].Status = aws.String("ACTIVE")
+			}
+		}
+		return &ecs.UpdateServicePrimaryTaskSetOutput{}, true
+	case *ecs.DeleteTaskSetInput:
+		f.calls = append(f.calls, "DeleteTaskSet")
+		var remains []types.TaskSet
+		for _, ts := range f.taskSets {
+			if aws.ToString(ts.TaskSetArn) != aws.ToString(in.TaskSet) {
+				remains = append(remains, ts)
+			}
+		}
+		f.taskSets = remains
+		return &ecs.DeleteTaskSetOutput{}, true
+	}
+	return nil, false
+}
+
+func (f *fakeTaskSets) middleware(stack *middleware.Stack) error {
+	return stack.Initialize.Add(
+		middleware.InitializeMiddlewareFunc(
+			"test",
+			func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+				if out, ok := f.handle(in.Parameters); ok {
+					return middleware.InitializeOutput{Result: out}, middleware.Metadata{}, nil
+				}
+				return next.HandleInitialize(ctx, in)
+			},
+		),
+		middleware.Before,
+	)
+}
+
+func newTaskSetTestApp(t *testing.T, f *fakeTaskSets) *ecspresso.App {
+	t.Helper()
+	t.Setenv("AWS_REGION", "ap-northeast-1")
+	ecspresso.SetTaskSetCheckInterval(time.Millisecond)
+	t.Cleanup(func() { ecspresso.SetTaskSetCheckInterval(10 * time.Second) })
+	ecspresso.SetAWSV2ConfigLoadOptionsFunc([]func(*config.LoadOptions) error{
+		config.WithRegion("ap-northeast-1"),
+		config.WithAPIOptions([]func(*middleware.Stack) error{f.middleware}),
+	})
+	t.Cleanup(ecspresso.ResetAWSV2ConfigLoadOptionsFunc)
+	app, err := ecspresso.New(context.Background(), &ecspresso.CLIOptions{ConfigFilePath: "tests/ecspresso.yml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+type taskSetState struct {
+	Status         string
+	TaskDefinition string
+}
+
+func taskSetStates(tss []types.TaskSet) []taskSetState {
+	var s []taskSetState
+	for _, ts := range tss {
+		s = append(s, taskSetState{aws.ToString(ts.Status), ecspresso.ArnToName(aws.ToString(ts.TaskDefinition))})
+	}
+	return s
+}
+
+func TestDeployByTaskSet(t *testing.T) {
+	ctx := context.Background()
+	f := &fakeTaskSets{}
+	f.addTaskSet("PRIMARY", 1, types.StabilityStatusSteadyState)
+	app := newTaskSetTestApp(t, f)
+
+	sv, err := app.DescribeService(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if td := aws.ToString(sv.TaskDefinition); td != fmt.Sprintf(tasksetTdArnFmt, 1) {
+		t.Errorf("task definition of the primary task set is not applied: %s", td)
+	}
+	deploy, err := app.DeployFunc(sv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := deploy(ctx, fmt.Sprintf(tasksetTdArnFmt, 2), nil, sv, ecspresso.DeployOption{UpdateService: true, Wait: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedCalls := []string{
+		"DescribeServices",
+		"CreateTaskSet",
+		"DescribeTaskSets", // STABILIZING
+		"DescribeTaskSets", // STEADY_STATE
+		"UpdateServicePrimaryTaskSet",
+		"DeleteTaskSet",
+	}
+	if diff := cmp.Diff(expectedCalls, f.calls[1:]); diff != "" {
+		t.Errorf("unexpected calls: %s", diff)
+	}
+	if f.created.NetworkConfiguration == nil {
+		t.Error("network configuration of the primary task set is not inherited")
+	}
+	if diff := cmp.Diff([]taskSetState{{"PRIMARY", "test:2"}}, taskSetStates(f.taskSets)); diff != "" {
+		t.Errorf("unexpected task sets: %s", diff)
+	}
+}
+
+func TestRollbackByTaskSet(t *testing.T) {
+	ctx := context.Background()
+	f := &fakeTaskSets{}
+	f.addTaskSet("ACTIVE", 1, types.StabilityStatusSteadyState).Scale.Value = 0
+	f.addTaskSet("PRIMARY", 2, types.StabilityStatusSteadyState)
+	app := newTaskSetTestApp(t, f)
+
+	sv, err := app.DescribeService(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rollback, err := app.RollbackFunc(sv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rolledBack, err := rollback(ctx, sv, ecspresso.RollbackOption{Wait: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rolledBack != fmt.Sprintf(tasksetTdArnFmt, 2) {
+		t.Errorf("unexpected rolled back task definition: %s", rolledBack)
+	}
+	if f.created != nil {
+		t.Error("the previous task set should be re-promoted, not created")
+	}
+	expectedCalls := []string{
+		"DescribeServices",
+		"UpdateTaskSet",
+		"DescribeTaskSets",
+		"UpdateServicePrimaryTaskSet",
+		"DeleteTaskSet",
+	}
+	if diff := cmp.Diff(expectedCalls, f.calls[1:]); diff != "" {
+		t.Errorf("unexpected calls: %s", diff)
+	}
+	if diff := cmp.Diff([]taskSetState{{"PRIMARY", "test:1"}}, taskSetStates(f.taskSets)); diff != "" {
+		t.Errorf("unexpected task sets: %s", diff)
+	}
+}
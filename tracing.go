@@ -0,0 +1,128 @@
+package ecspresso
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	awsMiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName                  = "github.com/kayac/ecspresso"
+	serviceMetadataMiddlewareID = "RegisterServiceMetadata"
+	tracingMiddlewareID         = "ecspressoTracing"
+	otlpDefaultTracesURLPath    = "/v1/traces"
+	envOTLPEndpoint             = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	envOTLPTracesEndpoint       = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"
+	tracingShutdownTimeout      = 5 * time.Second
+)
+
+// setupTracing sets up the global tracer provider that exports spans over OTLP/HTTP.
+// Tracing is enabled when the endpoint is specified or OTEL_EXPORTER_OTLP_(TRACES_)ENDPOINT is set.
+// The returned function flushes and shuts down the provider.
+func setupTracing(ctx context.Context, endpoint string) (func(context.Context) error, error) {
+	nop := func(context.Context) error { return nil }
+	if endpoint == "" && os.Getenv(envOTLPEndpoint) == "" && os.Getenv(envOTLPTracesEndpoint) == "" {
+		return nop, nil
+	}
+	var opts []otlptracehttp.Option
+	if endpoint != "" {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nop, fmt.Errorf("invalid OTLP endpoint %s: %w", endpoint, err)
+		}
+		switch u.Scheme {
+		case "http":
+			opts = append(opts, otlptracehttp.WithInsecure())
+		case "https":
+		default:
+			return nop, fmt.Errorf("invalid OTLP endpoint %s: scheme must be http or https", endpoint)
+		}
+		path := u.Path
+		if path == "" || path == "/" {
+			path = otlpDefaultTracesURLPath
+		}
+		opts = append(opts, otlptracehttp.WithEndpoint(u.Host), otlptracehttp.WithURLPath(path))
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nop, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+	}
+	res, err := resource.Merge(
+		resource.Default(),
+		resource.NewSchemaless(
+			attribute.String("service.name", "ecspresso"),
+			attribute.String("service.version", Version),
+		),
+	)
+	if err != nil {
+		return nop, fmt.Errorf("failed to create trace resource: %w", err)
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	Log("[DEBUG] tracing is enabled")
+	return tp.Shutdown, nil
+}
+
+// startSpan starts a span as a child of the span in ctx.
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan records the error to the span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (d *App) spanAttributes() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("ecspresso.cluster", d.Cluster),
+		attribute.String("ecspresso.service", d.Service),
+	}
+}
+
+// tracingMiddleware is an AWS SDK API option that wraps each AWS API call in a span.
+// It is inserted after RegisterServiceMetadata to know the service and the operation names.
+func tracingMiddleware(stack *middleware.Stack) error {
+	mw := middleware.InitializeMiddlewareFunc(
+		tracingMiddlewareID,
+		func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (out middleware.InitializeOutput, md middleware.Metadata, err error) {
+			service := awsMiddleware.GetServiceID(ctx)
+			operation := awsMiddleware.GetOperationName(ctx)
+			ctx, span := startSpan(ctx, service+"."+operation,
+				attribute.String("rpc.system", "aws-api"),
+				attribute.String("rpc.service", service),
+				attribute.String("rpc.method", operation),
+				attribute.String("cloud.region", awsMiddleware.GetRegion(ctx)),
+			)
+			defer func() { endSpan(span, err) }()
+			out, md, err = next.HandleInitialize(ctx, in)
+			if id, ok := awsMiddleware.GetRequestIDMetadata(md); ok {
+				span.SetAttributes(attribute.String("aws.request_id", id))
+			}
+			return out, md, err
+		},
+	)
+	if _, ok := stack.Initialize.Get(serviceMetadataMiddlewareID); ok {
+		return stack.Initialize.Insert(mw, serviceMetadataMiddlewareID, middleware.After)
+	}
+	return stack.Initialize.Add(mw, middleware.Before)
+}
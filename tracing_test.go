@@ -0,0 +1,134 @@
+package ecspresso_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/kayac/ecspresso/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// otlpCollector is a stand-in of OpenTelemetry collector receiving traces over OTLP/HTTP.
+type otlpCollector struct {
+	mu       sync.Mutex
+	spans    map[string]int
+	services []string
+}
+
+func (c *otlpCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/v1/traces" {
+		http.NotFound(w, r)
+		return
+	}
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := &coltracepb.ExportTraceServiceRequest{}
+	if err := proto.Unmarshal(b, req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, rs := range req.ResourceSpans {
+		for _, attr := range rs.GetResource().GetAttributes() {
+			if attr.Key == "service.name" {
+				c.services = append(c.services, attr.GetValue().GetStringValue())
+			}
+		}
+		for _, ss := range rs.ScopeSpans {
+			for _, span := range ss.Spans {
+				c.spans[span.Name]++
+			}
+		}
+	}
+	b, _ = proto.Marshal(&coltracepb.ExportTraceServiceResponse{})
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Write(b)
+}
+
+// describeAlarmsStubMiddleware returns no alarms for DescribeAlarms.
+// It is added at the end of the initialize step to be called inside the tracing middleware.
+func describeAlarmsStubMiddleware(stack *middleware.Stack) error {
+	return stack.Initialize.Add(
+		middleware.InitializeMiddlewareFunc(
+			"test",
+			func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+				if _, ok := in.Parameters.(*cloudwatch.DescribeAlarmsInput); !ok {
+					return next.HandleInitialize(ctx, in)
+				}
+				return middleware.InitializeOutput{Result: &cloudwatch.DescribeAlarmsOutput{}}, middleware.Metadata{}, nil
+			},
+		),
+		middleware.After,
+	)
+}
+
+func TestTracing(t *testing.T) {
+	ctx := context.Background()
+	collector := &otlpCollector{spans: map[string]int{}}
+	srv := httptest.NewServer(collector)
+	defer srv.Close()
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	shutdown, err := ecspresso.SetupTracing(ctx, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecspresso.SetAlarmCheckInterval(10 * time.Millisecond)
+	defer ecspresso.SetAlarmCheckInterval(10 * time.Second)
+	defer ecspresso.ResetAWSV2ConfigLoadOptionsFunc()
+	ecspresso.SetAWSV2ConfigLoadOptionsFunc([]func(*config.LoadOptions) error{
+		config.WithRegion("ap-northeast-1"),
+		config.WithAPIOptions([]func(*middleware.Stack) error{
+			describeAlarmsStubMiddleware,
+		}),
+	})
+	app, err := ecspresso.New(ctx, &ecspresso.CLIOptions{ConfigFilePath: "tests/alarms.yml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.WatchAlarms(ctx, 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	for _, name := range []string{"load config", "setup plugins", "CloudWatch.DescribeAlarms"} {
+		if collector.spans[name] == 0 {
+			names := make([]string, 0, len(collector.spans))
+			for n := range collector.spans {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			t.Errorf("span %s is not exported: %v", name, names)
+		}
+	}
+	if len(collector.services) == 0 || collector.services[0] != "ecspresso" {
+		t.Errorf("unexpected service.name: %v", collector.services)
+	}
+}
+
+func TestSetupTracingInvalidEndpoint(t *testing.T) {
+	if _, err := ecspresso.SetupTracing(context.Background(), "localhost:4318"); err == nil {
+		t.Error("expected an error for the endpoint without scheme")
+	}
+}
@@ -22,22 +22,20 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
-	"github.com/aws/aws-sdk-go-v2/service/ssm"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/fatih/color"
 	"github.com/kayac/ecspresso/v2/registry"
 )
 
 type verifier struct {
-	cwl            *cloudwatchlogs.Client
-	ssm            *ssm.Client
-	secretsmanager *secretsmanager.Client
-	ecr            map[string]*ecr.Client
-	s3             *s3.Client
-	opt            *VerifyOption
-	isAssumed      bool
-	execCfg        *aws.Config
+	cwl       *cloudwatchlogs.Client
+	secrets   *secretResolver
+	ecr       map[string]*ecr.Client
+	s3        *s3.Client
+	opt       *VerifyOption
+	isAssumed bool
+	execCfg   *aws.Config
+	report    []string // the results without colors for the summary
 }
 
 func (v *verifier) IsAssumed() bool {
@@ -46,9 +44,8 @@ func (v *verifier) IsAssumed() bool {
 
 func newVerifier(execCfg, appCfg *aws.Config, opt *VerifyOption) *verifier {
 	return &verifier{
-		cwl:            cloudwatchlogs.NewFromConfig(*execCfg),
-		ssm:            ssm.NewFromConfig(*execCfg),
-		secretsmanager: secretsmanager.NewFromConfig(*execCfg),
+		cwl:     cloudwatchlogs.NewFromConfig(*execCfg),
+		secrets: newSecretResolver(*execCfg),
 		ecr: map[string]*ecr.Client{
 			execCfg.Region: ecr.NewFromConfig(*execCfg),
 		},
@@ -75,55 +72,8 @@ func (v *verifier) existsSecretValue(ctx context.Context, from string) error {
 		return ErrSkipVerify(fmt.Sprintf("get a secret value for %s", from))
 	}
 
-	// secrets manager
-	if strings.HasPrefix(from, "arn:aws:secretsmanager:") {
-		// https://docs.aws.amazon.com/ja_jp/AmazonECS/latest/developerguide/specifying-sensitive-data-secrets.html
-		// Truncate additional params in secretsmanager Arn.
-		part := strings.Split(from, ":")
-		if len(part) < 7 {
-			return errors.New("invalid arn format")
-		}
-		secretArn := strings.Join(part[0:7], ":")
-		res, err := v.secretsmanager.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
-			SecretId: &secretArn,
-		})
-		if err != nil {
-			return fmt.Errorf("failed to get secret value from %s secret id %s: %w", from, secretArn, err)
-		}
-		if len(part) < 8 {
-			return nil
-		}
-		key := part[7]
-		if key == "" {
-			return nil
-		}
-		var m map[string]interface{}
-		if err := json.Unmarshal([]byte(*res.SecretString), &m); err != nil {
-			return fmt.Errorf("failed to parse secret string from %s secret id %s: %w", from, secretArn, err)
-		}
-
-		if _, ok := m[key]; !ok {
-			return fmt.Errorf("failed to find key %s on secret json value from %s secret id %s", key, from, secretArn)
-		}
-		return nil
-	}
-
-	// ssm
-	var name string
-	if strings.HasPrefix(from, "arn:aws:ssm:") {
-		ns := strings.Split(from, ":")
-		name = strings.TrimPrefix(ns[len(ns)-1], "parameter")
-	} else {
-		name = from
-	}
-	_, err := v.ssm.GetParameters(ctx, &ssm.GetParametersInput{
-		Names:          []string{name},
-		WithDecryption: aws.Bool(true),
-	})
-	if err != nil {
-		return fmt.Errorf("failed to get ssm parameter %s: %w", name, err)
-	}
-	return nil
+	_, err := v.secrets.value(ctx, from)
+	return err
 }
 
 func (v *verifier) existsEnvironmentFile(ctx context.Context, envFile types.EnvironmentFile) error {
@@ -187,8 +137,15 @@ type VerifyOption struct {
 type verifyResourceFunc func(context.Context) error
 
 // Verify verifies service / task definitions related resources are valid.
-func (d *App) Verify(ctx context.Context, opt VerifyOption) error {
+func (d *App) Verify(ctx context.Context, opt VerifyOption) (err error) {
 	initVerifyState(opt.Cache)
+	defer func() {
+		var report []string
+		if d.verifier != nil {
+			report = d.verifier.report
+		}
+		d.summarizeVerify(report, err)
+	}()
 
 	td, err := d.LoadTaskDefinition(d.config.TaskDefinitionPath)
 	if err != nil {
@@ -210,9 +167,10 @@ func (d *App) Verify(ctx context.Context, opt VerifyOption) error {
 		{name: "TaskDefinition", fn: d.verifyTaskDefinition},
 		{name: "ServiceDefinition", fn: d.verifyServiceDefinition},
 		{name: "Cluster", fn: d.verifyCluster},
+		{name: "Schedules", fn: d.verifySchedules},
 	}
 	for _, r := range resources {
-		if err := verifyResource(ctx, r.name, r.fn); err != nil {
+		if err := d.verifyResource(ctx, r.name, r.fn); err != nil {
 			return err
 		}
 	}
@@ -251,28 +209,40 @@ func (v verifyCache) Do(ctx context.Context, name string, fn verifyResourceFunc)
 	return err, false
 }
 
-func verifyResource(ctx context.Context, name string, verifyFunc func(context.Context) error) error {
+func (d *App) verifyResource(ctx context.Context, name string, verifyFunc func(context.Context) error) error {
 	verifyState.level++
 	defer func() { verifyState.level-- }()
 	indent := strings.Repeat("  ", verifyState.level)
 	print := func(f string, args ...interface{}) {
 		fmt.Printf(indent+f+"\n", args...)
 	}
+	report := func(result, cached, msg string) {
+		line := indent + "--> [" + result + "]" + cached
+		if msg != "" {
+			line += " " + msg
+		}
+		d.verifier.report = append(d.verifier.report, line)
+	}
 	print("%s", name)
-	var cached string
+	d.verifier.report = append(d.verifier.report, indent+name)
+	var cached, coloredCached string
 	verifyErr, hit := verifyState.cache.Do(ctx, name, verifyFunc)
 	if hit {
-		cached = color.CyanString("(cached)")
+		cached = "(cached)"
+		coloredCached = color.CyanString(cached)
 	}
 	if verifyErr != nil {
 		if errors.As(verifyErr, &errSkipVerify) {
-			print("--> [%s]%s %s", color.CyanString("SKIP"), cached, color.CyanString(verifyErr.Error()))
+			print("--> [%s]%s %s", color.CyanString("SKIP"), coloredCached, color.CyanString(verifyErr.Error()))
+			report("SKIP", cached, verifyErr.Error())
 			return nil
 		}
-		print("--> [%s]%s %s", color.RedString("NG"), cached, color.RedString(verifyErr.Error()))
+		print("--> [%s]%s %s", color.RedString("NG"), coloredCached, color.RedString(verifyErr.Error()))
+		report("NG", cached, verifyErr.Error())
 		return fmt.Errorf("verify %s failed: %w", name, verifyErr)
 	}
-	print("--> [%s]%s", color.GreenString("OK"), cached)
+	print("--> [%s]%s", color.GreenString("OK"), coloredCached)
+	report("OK", cached, "")
 	return nil
 }
 
@@ -314,7 +284,7 @@ func (d *App) verifyServiceDefinition(ctx context.Context) error {
 	// LB
 	for i, lb := range sv.LoadBalancers {
 		name := fmt.Sprintf("LoadBalancer[%d]", i)
-		err := verifyResource(ctx, name, func(context.Context) error {
+		err := d.verifyResource(ctx, name, func(context.Context) error {
 			out, err := d.elbv2.DescribeTargetGroups(ctx, &elasticloadbalancingv2.DescribeTargetGroupsInput{
 				TargetGroupArns: []string{*lb.TargetGroupArn},
 			})
@@ -354,7 +324,7 @@ func (d *App) verifyServiceDefinition(ctx context.Context) error {
 
 	for i, vc := range sv.VolumeConfigurations {
 		name := fmt.Sprintf("VolumeConfigurations[%d]", i)
-		err := verifyResource(ctx, name, func(context.Context) error {
+		err := d.verifyResource(ctx, name, func(context.Context) error {
 			if ebs := vc.ManagedEBSVolume; ebs != nil {
 				if len(ebs.TagSpecifications) > 1 {
 					d.Log("[WARNING] %s has more than one tag specifications. Only the first tag specification is used.", name)
@@ -378,7 +348,7 @@ func (d *App) verifyTaskDefinition(ctx context.Context) error {
 
 	if execRole := td.ExecutionRoleArn; execRole != nil {
 		name := fmt.Sprintf("ExecutionRole[%s]", *execRole)
-		err := verifyResource(ctx, name, func(ctx context.Context) error {
+		err := d.verifyResource(ctx, name, func(ctx context.Context) error {
 			return d.verifyRole(ctx, *execRole)
 		})
 		if err != nil {
@@ -387,7 +357,7 @@ func (d *App) verifyTaskDefinition(ctx context.Context) error {
 	}
 	if taskRole := td.TaskRoleArn; taskRole != nil {
 		name := fmt.Sprintf("TaskRole[%s]", *taskRole)
-		err := verifyResource(ctx, name, func(ctx context.Context) error {
+		err := d.verifyResource(ctx, name, func(ctx context.Context) error {
 			return d.verifyRole(ctx, *taskRole)
 		})
 		if err != nil {
@@ -397,7 +367,7 @@ func (d *App) verifyTaskDefinition(ctx context.Context) error {
 
 	for _, c := range td.ContainerDefinitions {
 		name := fmt.Sprintf("ContainerDefinition[%s]", aws.ToString(c.Name))
-		err := verifyResource(ctx, name, func(ctx context.Context) error {
+		err := d.verifyResource(ctx, name, func(ctx context.Context) error {
 			return d.verifyContainer(ctx, &c, td)
 		})
 		if err != nil {
@@ -535,7 +505,7 @@ func (d *App) verifyImage(ctx context.Context, image string) error {
 func (d *App) verifyContainer(ctx context.Context, c *types.ContainerDefinition, td *ecs.RegisterTaskDefinitionInput) error {
 	image := aws.ToString(c.Image)
 	name := fmt.Sprintf("Image[%s]", image)
-	err := verifyResource(ctx, name, func(ctx context.Context) error {
+	err := d.verifyResource(ctx, name, func(ctx context.Context) error {
 		return d.verifyImage(ctx, image)
 	})
 	if err != nil {
@@ -543,7 +513,7 @@ func (d *App) verifyContainer(ctx context.Context, c *types.ContainerDefinition,
 	}
 	for _, secret := range c.Secrets {
 		name := fmt.Sprintf("Secret %s[%s]", *secret.Name, *secret.ValueFrom)
-		err := verifyResource(ctx, name, func(ctx context.Context) error {
+		err := d.verifyResource(ctx, name, func(ctx context.Context) error {
 			return d.verifier.existsSecretValue(ctx, *secret.ValueFrom)
 		})
 		if err != nil {
@@ -552,7 +522,7 @@ func (d *App) verifyContainer(ctx context.Context, c *types.ContainerDefinition,
 	}
 	if c.LogConfiguration != nil && c.LogConfiguration.LogDriver == types.LogDriverAwslogs {
 		name := fmt.Sprintf("LogConfiguration[%s]", map2str(c.LogConfiguration.Options))
-		err := verifyResource(ctx, name, func(ctx context.Context) error {
+		err := d.verifyResource(ctx, name, func(ctx context.Context) error {
 			return d.verifyLogConfiguration(ctx, c)
 		})
 		if err != nil {
@@ -561,7 +531,7 @@ func (d *App) verifyContainer(ctx context.Context, c *types.ContainerDefinition,
 	}
 	for _, envFile := range c.EnvironmentFiles {
 		name := fmt.Sprintf("EnvironmentFile[%s %s]", envFile.Type, aws.ToString(envFile.Value))
-		if err := verifyResource(ctx, name, func(ctx context.Context) error {
+		if err := d.verifyResource(ctx, name, func(ctx context.Context) error {
 			return d.verifier.existsEnvironmentFile(ctx, envFile)
 		}); err != nil {
 			return err
@@ -658,6 +628,11 @@ func extractRoleName(roleArn string) (string, error) {
 }
 
 func (d *App) verifyRole(ctx context.Context, roleArn string) error {
+	return d.verifyRoleFor(ctx, roleArn, "ecs-tasks.amazonaws.com")
+}
+
+// verifyRoleFor verifies the role can be assumed by the service principal.
+func (d *App) verifyRoleFor(ctx context.Context, roleArn, principal string) error {
 	roleName, err := extractRoleName(roleArn)
 	if err != nil {
 		return err
@@ -673,7 +648,7 @@ func (d *App) verifyRole(ctx context.Context, roleArn string) error {
 		return fmt.Errorf("failed to parse IAM policy document: %w", err)
 	}
 	for _, st := range doc.Statement {
-		if st.Principal.Service == "ecs-tasks.amazonaws.com" && st.Action == "sts:AssumeRole" {
+		if st.Principal.Service == principal && st.Action == "sts:AssumeRole" {
 			return nil
 		}
 	}
@@ -248,6 +248,22 @@ func TestVerifySkipResource(t *testing.T) {
 	}
 }
 
+func TestVerifyResourceWithoutCachedColor(t *testing.T) {
+	color.NoColor = false
+	defer func() { color.NoColor = true }()
+	ecspresso.InitVerifyState(false)
+	out := extractStdout(t, func() {
+		if err := ecspresso.VerifyResource(context.TODO(), "ok resource", func(_ context.Context) error {
+			return nil
+		}); err != nil {
+			t.Error("unexpected error for ok resource", err)
+		}
+	})
+	if empty := color.CyanString(""); bytes.Contains(out, []byte(empty)) {
+		t.Errorf("unexpected empty colored string in the output: %q", out)
+	}
+}
+
 func TestVerifierIsAssumed(t *testing.T) {
 	cfg1 := aws.Config{}
 	cfg2 := aws.Config{}
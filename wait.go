@@ -28,6 +28,8 @@ func (d *App) WaitFunc(sv *Service) (waitFunc, error) {
 		switch dc.Type {
 		case types.DeploymentControllerTypeCodeDeploy:
 			return d.WaitForCodeDeploy, nil
+		case types.DeploymentControllerTypeExternal:
+			return d.WaitTaskSetStable, nil
 		case types.DeploymentControllerTypeEcs:
 			return d.WaitServiceStable, nil
 		default:
@@ -38,11 +40,14 @@ func (d *App) WaitFunc(sv *Service) (waitFunc, error) {
 }
 
 type WaitOption struct {
+	DiagnosticsFile string `help:"file to save the diagnostics of the stopped tasks as JSON when the service does not become stable (default: a temporary file)" default:""`
 }
 
-func (d *App) Wait(ctx context.Context, opt WaitOption) error {
+func (d *App) Wait(ctx context.Context, opt WaitOption) (err error) {
 	ctx, cancel := d.Start(ctx)
 	defer cancel()
+	ctx = d.withNotification(ctx, "wait")
+	defer func() { d.notifyResult(ctx, err) }()
 
 	d.Log("Waiting for the service stable")
 
@@ -51,6 +56,7 @@ func (d *App) Wait(ctx context.Context, opt WaitOption) error {
 		return err
 	}
 	d.LogJSON(sv.DeploymentController)
+	setNotificationTaskDefinition(ctx, aws.ToString(sv.TaskDefinition))
 	doWait, err := d.WaitFunc(sv)
 	if err != nil {
 		return err
@@ -60,6 +66,10 @@ func (d *App) Wait(ctx context.Context, opt WaitOption) error {
 			d.Log("[INFO] %s", err)
 			return d.WaitTaskSetStable(ctx, sv)
 		}
+		d.diagnoseFailedDeployment(ctx, sv, aws.ToString(sv.TaskDefinition), err, opt.DiagnosticsFile)
+		if d.shouldRollbackOnAlarm(sv, err) {
+			return d.rollbackOnAlarm(ctx, sv, err)
+		}
 		return err
 	}
 
@@ -67,13 +77,67 @@ func (d *App) Wait(ctx context.Context, opt WaitOption) error {
 	return nil
 }
 
+// rollbackOnAlarm rolls back the service when the alarms fired while waiting.
+// It takes the deployment lock, records the history and notifies as same as the rollback command.
+func (d *App) rollbackOnAlarm(ctx context.Context, sv *Service, cause error) (err error) {
+	unlock, err := d.lock(ctx, "rollback")
+	if err != nil {
+		return fmt.Errorf("%w: failed to roll back: %s", cause, err)
+	}
+	defer unlock()
+	rec := d.newHistoryRecord(historyOperationRollback)
+	defer func() { d.recordHistory(rec, err) }()
+	ctx = d.withNotification(ctx, "rollback")
+	d.notify(ctx, NotificationEventStarted, nil)
+	defer func() { d.notifyResult(ctx, err) }()
+
+	currentArn := aws.ToString(sv.TaskDefinition)
+	targetArn, err := d.rollbackTarget(ctx, sv, currentArn, RollbackOption{NoSelect: true})
+	if err != nil {
+		return fmt.Errorf("%w: failed to roll back: %s", cause, err)
+	}
+	if rec != nil {
+		rec.TaskDefinitionArn = targetArn
+		rec.PreviousTaskDefinitionArn = currentArn
+	}
+	return d.rollbackFailedDeployment(ctx, cause, currentArn, targetArn, RollbackOption{Wait: true})
+}
+
 func (d *App) WaitServiceStable(ctx context.Context, sv *Service) error {
+	if err := d.waitServiceStable(ctx, sv, d.config.Alarms != nil); err != nil {
+		return err
+	}
+	d.notify(ctx, NotificationEventStable, nil)
+	return nil
+}
+
+// waitServiceStableWithoutAlarms waits for the service stable without watching alarms.
+func (d *App) waitServiceStableWithoutAlarms(ctx context.Context, sv *Service) error {
+	return d.waitServiceStable(ctx, sv, false)
+}
+
+func (d *App) waitServiceStable(ctx context.Context, sv *Service, withAlarms bool) (err error) {
+	ctx, span := startSpan(ctx, "wait for service stable", d.spanAttributes()...)
+	defer func() { endSpan(span, err) }()
 	d.Log("Waiting for service stable...(it will take a few minutes)")
+	d.emitPhase("wait_service_stable", phaseStatusStarted, nil)
+	defer func() { d.emitPhaseResult("wait_service_stable", err) }()
 	waitCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	alarmCh := make(chan error, 1)
+	if withAlarms {
+		go func() {
+			if err := d.watchAlarms(waitCtx, 0); err != nil {
+				alarmCh <- err
+				cancel() // stop the waiter
+			}
+		}()
+	}
+
 	tick := time.NewTicker(10 * time.Second)
 	st := &showState{lastEventAt: time.Now()}
+	lst := &lifecycleStageState{}
 	go func() {
 		for {
 			select {
@@ -84,28 +148,101 @@ func (d *App) WaitServiceStable(ctx context.Context, sv *Service) error {
 					d.Log("[WARNING] %s", err.Error())
 					continue
 				}
+				if sv.isNativeBlueGreen() {
+					if err := d.showLifecycleStage(waitCtx, lst); err != nil {
+						d.Log("[WARNING] %s", err.Error())
+					}
+				}
 			}
 		}
 	}()
 
 	waiter := ecs.NewServicesStableWaiter(d.ecs, func(o *ecs.ServicesStableWaiterOptions) {
 		o.MaxDelay = waiterMaxDelay
+		retryable := o.Retryable
+		o.Retryable = func(ctx context.Context, in *ecs.DescribeServicesInput, out *ecs.DescribeServicesOutput, err error) (bool, error) {
+			if err == nil {
+				if ferr := failedRollout(out); ferr != nil {
+					return false, ferr
+				}
+			}
+			return retryable(ctx, in, out, err)
+		}
 	})
-	if err := waiter.Wait(ctx, d.DescribeServicesInput(), d.Timeout()); err != nil {
+	if err := waiter.Wait(waitCtx, d.DescribeServicesInput(), d.Timeout()); err != nil {
+		select {
+		case aerr := <-alarmCh:
+			return aerr
+		default:
+		}
 		return fmt.Errorf("failed to wait for service stable: %w", err)
 	}
-	cancel() // stop the showServiceStatus
+	cancel() // stop the showServiceStatus and watching alarms
 
 	<-time.After(delayForServiceChanged)
 	// show the service status once more (correct all logs)
 	if err := d.showServiceStatus(ctx, st); err != nil {
 		d.Log("[WARNING] %s", err.Error())
 	}
+	if withAlarms {
+		return d.bakeAlarms(ctx)
+	}
 	return nil
 }
 
-func (d *App) WaitForCodeDeploy(ctx context.Context, sv *Service) error {
+// failedRollout returns an error when the rollout of the primary deployment failed (e.g. the deployment circuit breaker tripped).
+func failedRollout(out *ecs.DescribeServicesOutput) error {
+	if out == nil {
+		return nil
+	}
+	for _, sv := range out.Services {
+		for _, dp := range sv.Deployments {
+			if aws.ToString(dp.Status) == "PRIMARY" && dp.RolloutState == types.DeploymentRolloutStateFailed {
+				return fmt.Errorf("deployment %s failed: %s", aws.ToString(dp.Id), aws.ToString(dp.RolloutStateReason))
+			}
+		}
+	}
+	return nil
+}
+
+// rolledBackRollout returns an error when the deployment of tdArn was rolled back (e.g. by the deployment circuit breaker with rollback).
+// The service becomes stable by the rollback, so the waiter can't detect it.
+func rolledBackRollout(out *ecs.DescribeServicesOutput, tdArn string) error {
+	if out == nil {
+		return nil
+	}
+	name := arnToName(tdArn)
+	for _, sv := range out.Services {
+		for _, dp := range sv.Deployments {
+			if arnToName(aws.ToString(dp.TaskDefinition)) == name && dp.RolloutState == types.DeploymentRolloutStateFailed {
+				return ErrRolledBack(fmt.Sprintf("deployment %s of %s was rolled back: %s", aws.ToString(dp.Id), name, aws.ToString(dp.RolloutStateReason)))
+			}
+		}
+		for _, dp := range sv.Deployments {
+			if aws.ToString(dp.Status) == "PRIMARY" && arnToName(aws.ToString(dp.TaskDefinition)) != name {
+				return ErrRolledBack(fmt.Sprintf("deployment of %s was rolled back to %s", name, arnToName(aws.ToString(dp.TaskDefinition))))
+			}
+		}
+	}
+	return nil
+}
+
+// checkRolledBack checks the service after waiting is not rolled back from tdArn.
+func (d *App) checkRolledBack(ctx context.Context, tdArn string) error {
+	out, err := d.ecs.DescribeServices(ctx, d.DescribeServicesInput())
+	if err != nil {
+		d.Log("[WARNING] failed to describe the service to check rollback: %s", err)
+		return nil
+	}
+	return rolledBackRollout(out, tdArn)
+}
+
+func (d *App) WaitForCodeDeploy(ctx context.Context, sv *Service) (err error) {
+	ctx, span := startSpan(ctx, "wait for CodeDeploy", d.spanAttributes()...)
+	defer func() { endSpan(span, err) }()
 	d.Log("[DEBUG] wait for CodeDeploy")
+	d.emitPhase("wait_codedeploy", phaseStatusStarted, nil)
+	defer func() { d.emitPhaseResult("wait_codedeploy", err) }()
 	dp, err := d.findDeploymentInfo(ctx)
 	if err != nil {
 		return err
@@ -132,21 +269,27 @@ func (d *App) WaitForCodeDeploy(ctx context.Context, sv *Service) error {
 
 	dpID := out.Deployments[0]
 	d.Log("Waiting for a deployment successful ID: " + dpID)
+	setNotificationCodeDeployment(ctx, dpID, fmt.Sprintf(CodeDeployConsoleURLFmt, d.config.Region, dpID, d.config.Region))
 	go d.codeDeployProgressBar(ctx, dpID)
 
 	waiter := codedeploy.NewDeploymentSuccessfulWaiter(d.codedeploy, func(o *codedeploy.DeploymentSuccessfulWaiterOptions) {
 		o.MaxDelay = waiterMaxDelay
 	})
-	return waiter.Wait(
+	if err := waiter.Wait(
 		ctx,
 		&codedeploy.GetDeploymentInput{DeploymentId: &dpID},
 		d.Timeout(),
-	)
+	); err != nil {
+		return err
+	}
+	d.notify(ctx, NotificationEventStable, nil)
+	return nil
 }
 
 type showState struct {
 	lastEventAt     time.Time
 	deploymentsHash []byte
+	targetStates    map[string]string
 }
 
 func (d *App) showServiceStatus(ctx context.Context, st *showState) error {
@@ -165,7 +308,8 @@ func (d *App) showServiceStatus(ctx context.Context, st *showState) error {
 	})
 	for _, event := range sv.Events {
 		if (*event.CreatedAt).After(st.lastEventAt) {
-			fmt.Println(formatEvent(event))
+			fmt.Fprintln(d.humanOutput(), formatEvent(event))
+			d.emitEvent(serviceEventEvent(event))
 			st.lastEventAt = *event.CreatedAt
 		}
 	}
@@ -184,8 +328,21 @@ func (d *App) showServiceStatus(ctx context.Context, st *showState) error {
 		for _, line := range lines {
 			d.Log(line)
 		}
+		for _, dep := range sv.Deployments {
+			d.emitEvent(deploymentEvent(dep))
+		}
 	}
 	st.deploymentsHash = hash
+
+	// show target health
+	if len(sv.LoadBalancers) > 0 {
+		if st.targetStates == nil {
+			st.targetStates = map[string]string{}
+		}
+		if err := d.showTargetHealth(ctx, &Service{Service: sv}, st.targetStates); err != nil {
+			d.Log("[WARNING] %s", err)
+		}
+	}
 	return nil
 }
 
@@ -193,9 +350,11 @@ func (d *App) codeDeployProgressBar(ctx context.Context, dpID string) error {
 	bar := progressbar.NewOptions(100,
 		progressbar.OptionSetDescription("Traffic shifted"),
 		progressbar.OptionSetWidth(20),
+		progressbar.OptionSetWriter(d.humanOutput()),
 	)
 	t := time.NewTicker(10 * time.Second)
 	lcEvents := map[string]cdTypes.LifecycleEventStatus{}
+	weights := map[string]float64{}
 	for {
 		select {
 		case <-ctx.Done():
@@ -221,6 +380,12 @@ func (d *App) codeDeployProgressBar(ctx context.Context, dpID string) error {
 				if ev.Status != cdTypes.LifecycleEventStatusPending {
 					d.Log("%s: %s", name, ev.Status)
 				}
+				d.emitEvent(&OutputEvent{
+					Type:           OutputEventTypeCodeDeployLifecycle,
+					ID:             dpID,
+					LifecycleEvent: name,
+					Status:         string(ev.Status),
+				})
 				lcEvents[name] = ev.Status
 			}
 		}
@@ -229,14 +394,27 @@ func (d *App) codeDeployProgressBar(ctx context.Context, dpID string) error {
 			if *element.Status == "ACTIVE" {
 				bar.Set(int(element.TrafficWeight))
 			}
+			label := string(element.TaskSetLabel)
+			if w, ok := weights[label]; !ok || w != element.TrafficWeight {
+				d.emitEvent(&OutputEvent{
+					Type:          OutputEventTypeCodeDeployTraffic,
+					ID:            dpID,
+					TaskSetLabel:  label,
+					Status:        aws.ToString(element.Status),
+					TrafficWeight: aws.Float64(element.TrafficWeight),
+				})
+				weights[label] = element.TrafficWeight
+			}
 		}
 	}
 	bar.Set(100)
-	fmt.Println()
+	fmt.Fprintln(d.humanOutput())
 	return nil
 }
 
-func (d *App) WaitTaskSetStable(ctx context.Context, sv *Service) error {
+func (d *App) WaitTaskSetStable(ctx context.Context, sv *Service) (err error) {
+	ctx, span := startSpan(ctx, "wait for task set stable", d.spanAttributes()...)
+	defer func() { endSpan(span, err) }()
 	var prev types.StabilityStatus
 	for {
 		sv, err := d.DescribeService(ctx)
@@ -262,6 +440,6 @@ func (d *App) WaitTaskSetStable(ctx context.Context, sv *Service) error {
 				prev = ts.StabilityStatus
 			}
 		}
-		time.Sleep(10 * time.Second)
+		time.Sleep(taskSetCheckInterval)
 	}
 }
@@ -0,0 +1,104 @@
+package ecspresso_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+	"github.com/kayac/ecspresso/v2"
+)
+
+func TestFailedRollout(t *testing.T) {
+	out := func(dps ...types.Deployment) *ecs.DescribeServicesOutput {
+		return &ecs.DescribeServicesOutput{
+			Services: []types.Service{{Deployments: dps}},
+		}
+	}
+	if err := ecspresso.FailedRollout(nil); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	inProgress := out(
+		types.Deployment{Id: aws.String("ecs-svc/2"), Status: aws.String("PRIMARY"), RolloutState: types.DeploymentRolloutStateInProgress},
+		types.Deployment{Id: aws.String("ecs-svc/1"), Status: aws.String("ACTIVE"), RolloutState: types.DeploymentRolloutStateFailed},
+	)
+	if err := ecspresso.FailedRollout(inProgress); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	failed := out(
+		types.Deployment{
+			Id:                 aws.String("ecs-svc/2"),
+			Status:             aws.String("PRIMARY"),
+			RolloutState:       types.DeploymentRolloutStateFailed,
+			RolloutStateReason: aws.String("ECS deployment circuit breaker: tasks failed to start."),
+		},
+	)
+	err := ecspresso.FailedRollout(failed)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if s := err.Error(); s != "deployment ecs-svc/2 failed: ECS deployment circuit breaker: tasks failed to start." {
+		t.Errorf("unexpected error: %s", s)
+	}
+}
+
+func TestRolledBackRollout(t *testing.T) {
+	const (
+		newTdArn = "arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:2"
+		oldTdArn = "arn:aws:ecs:ap-northeast-1:123456789012:task-definition/test:1"
+	)
+	out := func(dps ...types.Deployment) *ecs.DescribeServicesOutput {
+		return &ecs.DescribeServicesOutput{
+			Services: []types.Service{{Deployments: dps}},
+		}
+	}
+	deployed := out(
+		types.Deployment{Id: aws.String("ecs-svc/2"), Status: aws.String("PRIMARY"), TaskDefinition: aws.String(newTdArn), RolloutState: types.DeploymentRolloutStateCompleted},
+	)
+	for _, td := range []string{newTdArn, "test:2"} {
+		if err := ecspresso.RolledBackRollout(deployed, td); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		out    *ecs.DescribeServicesOutput
+		expect string
+	}{
+		{
+			name: "rolling back",
+			out: out(
+				types.Deployment{Id: aws.String("ecs-svc/3"), Status: aws.String("PRIMARY"), TaskDefinition: aws.String(oldTdArn), RolloutState: types.DeploymentRolloutStateCompleted},
+				types.Deployment{
+					Id:                 aws.String("ecs-svc/2"),
+					Status:             aws.String("ACTIVE"),
+					TaskDefinition:     aws.String(newTdArn),
+					RolloutState:       types.DeploymentRolloutStateFailed,
+					RolloutStateReason: aws.String("ECS deployment circuit breaker: tasks failed to start."),
+				},
+			),
+			expect: "deployment ecs-svc/2 of test:2 was rolled back: ECS deployment circuit breaker: tasks failed to start.",
+		},
+		{
+			name: "rolled back",
+			out: out(
+				types.Deployment{Id: aws.String("ecs-svc/3"), Status: aws.String("PRIMARY"), TaskDefinition: aws.String(oldTdArn), RolloutState: types.DeploymentRolloutStateCompleted},
+			),
+			expect: "deployment of test:2 was rolled back to test:1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ecspresso.RolledBackRollout(tt.out, newTdArn)
+			var rerr ecspresso.ErrRolledBack
+			if !errors.As(err, &rerr) {
+				t.Fatalf("expected rolled back error, got %v", err)
+			}
+			if err.Error() != tt.expect {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}